@@ -1,17 +1,24 @@
 package config
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server     ServerConfig
-	Database   DatabaseConfig
-	Logger     LoggerConfig
-	JWT        JWTConfig
-	Cloudflare CloudflareConfig
+	Environment string
+	Server      ServerConfig
+	Database    DatabaseConfig
+	Logger      LoggerConfig
+	JWT         JWTConfig
+	Cloudflare  CloudflareConfig
+	Storage     StorageConfig
+	Upload      UploadConfig
+	Images      ImageConfig
+	Pagination  PaginationConfig
 }
 
 type ServerConfig struct {
@@ -45,16 +52,101 @@ type CloudflareConfig struct {
 	AccountId  string
 	AccessKey  string
 	SecretKey  string
-	Endpoint   string
+	// Endpoint overrides the provider endpoint, e.g. http://localhost:9000 for MinIO
+	Endpoint     string
+	Region       string
+	UsePathStyle bool
+	TLS          TLSConfig
 }
 
+type TLSConfig struct {
+	InsecureSkipVerify bool
+	CAFile             string
+}
+
+type StorageConfig struct {
+	Driver    string
+	LocalPath string
+	// Bucket falls back to Cloudflare.BucketName when empty
+	Bucket string
+	// KeyTemplate supports {user_id}, {uuid}, {unix}, {date} and {ext}
+	KeyTemplate   string
+	PublicBaseURL string
+}
+
+type UploadConfig struct {
+	// MaxSize is the largest accepted file in bytes
+	MaxSize int64
+	// TusExpiration is how long an unfinished resumable upload is kept
+	TusExpiration time.Duration
+	// PresignExpiration is how long a presigned upload URL and its ticket stay valid
+	PresignExpiration time.Duration
+	// MetadataPolicy is the default scrubbing policy: keep, strip_gps or strip_all
+	MetadataPolicy string
+	// KeepOriginal stores the unscrubbed original privately by default
+	KeepOriginal bool
+	// AllowedTypes lists the MIME types accepted after content sniffing
+	AllowedTypes []string
+	// Timeout replaces the server read and write timeouts on routes that
+	// transfer whole files, which take far longer than other requests
+	Timeout time.Duration
+}
+
+type ImageConfig struct {
+	// Variants are the widths in pixels of the resized copies made on upload
+	Variants    []int
+	JPEGQuality int
+	// MaxProcessSize is the largest original in bytes that is decoded for processing
+	MaxProcessSize int64
+	// MaxTransformDimension bounds the width and height of on-the-fly renderings
+	MaxTransformDimension int
+	// MaxDimension is the largest width or height of an accepted image
+	MaxDimension int
+	// MaxPixels is the largest width times height of an accepted image
+	MaxPixels int64
+	// MaxFrames is the most frames an animated GIF may have
+	MaxFrames int
+	// MaxDecodedBytes bounds the memory decoding an image may take
+	MaxDecodedBytes int64
+	// SigningSecret signs transformation URLs, keep it separate from the JWT secret
+	SigningSecret string
+	// RequireSignature rejects unsigned transformation URLs
+	RequireSignature bool
+	// BaseURL prefixes minted transformation URLs, e.g. https://api.imgupper.web.id
+	BaseURL string
+	// SimilarDistance is the default Hamming distance within which two
+	// perceptual hashes count as near-duplicates
+	SimilarDistance int
+	// SimilarLimit caps the near-duplicates returned for an image
+	SimilarLimit int
+	// LQIPSize is the longer side in pixels of the inline placeholder image
+	LQIPSize int
+	// AutoOrient applies the EXIF orientation to variants and renderings,
+	// which are stored without EXIF and would otherwise display sideways
+	AutoOrient bool
+}
+
+type PaginationConfig struct {
+	// DefaultLimit is the page size of listings that do not ask for one
+	DefaultLimit int
+	// MaxLimit caps the page size a client may ask for
+	MaxLimit int
+}
+
+// defaultSigningSecret is the placeholder image signing secret, only
+// accepted in development
+const defaultSigningSecret = "your_image_signing_secret_"
+
 func Load() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
 	viper.AddConfigPath("./config")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
+	viper.SetDefault("environment", "development")
+
 	viper.SetDefault("server.address", ":8000")
 	viper.SetDefault("server.readTimeout", 10*time.Second)
 	viper.SetDefault("server.writeTimeout", 10*time.Second)
@@ -77,7 +169,48 @@ func Load() (*Config, error) {
 	viper.SetDefault("cloudflare.accountId", "your_cloudflare_accId")
 	viper.SetDefault("cloudflare.accessKey", "your_cloudflare_ak")
 	viper.SetDefault("cloudflare.secretKey", "your_cloudflare_sak")
-	viper.SetDefault("cloudflare.endpoints", "endpoint")
+	viper.SetDefault("cloudflare.endpoint", "")
+	viper.SetDefault("cloudflare.region", "")
+	viper.SetDefault("cloudflare.usePathStyle", false)
+	viper.SetDefault("cloudflare.tls.insecureSkipVerify", false)
+	viper.SetDefault("cloudflare.tls.caFile", "")
+
+	viper.SetDefault("storage.driver", "r2")
+	viper.SetDefault("storage.localPath", "./data/objects")
+	viper.SetDefault("storage.bucket", "")
+	viper.SetDefault("storage.keyTemplate", "u/{user_id}/uploads/{uuid}-{unix}{ext}")
+	viper.SetDefault("storage.publicBaseURL", "https://cdn.imgupper.web.id/")
+
+	viper.SetDefault("upload.maxSize", 300<<20)
+	viper.SetDefault("upload.tusExpiration", 24*time.Hour)
+	viper.SetDefault("upload.presignExpiration", 15*time.Minute)
+	viper.SetDefault("upload.metadataPolicy", "strip_gps")
+	viper.SetDefault("upload.keepOriginal", false)
+	viper.SetDefault("upload.timeout", 30*time.Minute)
+	viper.SetDefault("upload.allowedTypes", []string{
+		"image/jpeg", "image/png", "image/gif", "image/webp", "image/tiff", "image/heic", "image/avif",
+		"image/x-canon-cr2", "image/x-nikon-nef", "image/x-sony-arw", "image/x-adobe-dng",
+		"video/mp4", "video/quicktime", "video/webm",
+	})
+
+	viper.SetDefault("images.variants", []int{150, 640, 1280})
+	viper.SetDefault("images.jpegQuality", 85)
+	viper.SetDefault("images.maxProcessSize", 50<<20)
+	viper.SetDefault("images.maxTransformDimension", 4096)
+	viper.SetDefault("images.maxDimension", 20000)
+	viper.SetDefault("images.maxPixels", 100_000_000)
+	viper.SetDefault("images.maxFrames", 1000)
+	viper.SetDefault("images.maxDecodedBytes", 512<<20)
+	viper.SetDefault("images.signingSecret", defaultSigningSecret)
+	viper.SetDefault("images.requireSignature", true)
+	viper.SetDefault("images.baseURL", "")
+	viper.SetDefault("images.similarDistance", 10)
+	viper.SetDefault("images.similarLimit", 100)
+	viper.SetDefault("images.lqipSize", 16)
+	viper.SetDefault("images.autoOrient", false)
+
+	viper.SetDefault("pagination.defaultLimit", 50)
+	viper.SetDefault("pagination.maxLimit", 200)
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -85,11 +218,30 @@ func Load() (*Config, error) {
 		}
 	}
 
+	// Merge per-environment overrides, e.g. config.staging.yaml
+	viper.SetConfigName("config." + viper.GetString("environment"))
+	if err := viper.MergeInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return nil, err
+		}
+	}
+
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, err
 	}
 
+	if config.Storage.Bucket == "" {
+		config.Storage.Bucket = config.Cloudflare.BucketName
+	}
+
+	// Anyone knowing the secret can sign URLs to private files, so only a
+	// local development setup may run with the placeholder
+	if config.Environment != "development" && config.Images.RequireSignature &&
+		(config.Images.SigningSecret == "" || config.Images.SigningSecret == defaultSigningSecret) {
+		return nil, errors.New("images.signingSecret must be set when images.requireSignature is enabled")
+	}
+
 	return &config, nil
 
 }
@@ -1,15 +1,17 @@
 package app
 
 import (
+	"context"
+	"time"
+
 	"github.com/adorufus/imgupper/config"
 	"github.com/adorufus/imgupper/internal/handler"
 	"github.com/adorufus/imgupper/internal/repository"
 	"github.com/adorufus/imgupper/internal/service"
-	"github.com/adorufus/imgupper/pkg/cloudflare"
 	"github.com/adorufus/imgupper/pkg/database"
 	"github.com/adorufus/imgupper/pkg/logger"
 	"github.com/adorufus/imgupper/pkg/middleware"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/adorufus/imgupper/pkg/storage"
 	"github.com/gorilla/mux"
 )
 
@@ -18,10 +20,12 @@ type App struct {
 	Config     *config.Config
 	Logger     logger.Logger
 	DB         *database.Database
-	Cr2        *s3.Client
+	Storage    storage.Backend
 	Handlers   *handler.Handlers
 	Services   *service.Services
 	Repository *repository.Repositories
+
+	stopJobs context.CancelFunc
 }
 
 // NewApp creates a new application with all dependencies
@@ -38,18 +42,21 @@ func NewApp(cfg *config.Config) (*App, error) {
 		return nil, err
 	}
 
-	cr2, err := cloudflare.NewR2Client(cfg.Cloudflare)
+	// Initialize object storage
+	store, err := storage.New(cfg.Storage, cfg.Cloudflare)
 	if err != nil {
 		return nil, err
 	}
 
 	// Initialize repositories
-	repos := repository.NewRepositories(db, cr2)
+	repos := repository.NewRepositories(db, store, cfg.Storage)
 
 	// Initialize services with repositories
 	services := service.NewServices(service.Deps{
-		Repos:  repos,
-		Logger: log,
+		Repos:   repos,
+		Logger:  log,
+		Config:  cfg,
+		Storage: store,
 	}, cfg.JWT.Secret)
 
 	// Configure JWT middleware
@@ -63,24 +70,59 @@ func NewApp(cfg *config.Config) (*App, error) {
 		Services:  services,
 		Logger:    log,
 		JWTConfig: jwtConfig,
+		Config:    cfg,
 	})
 
 	// Initialize router with handlers
 	router := mux.NewRouter()
 	handlers.RegisterRoutes(router)
 
+	// Start background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	go purgeExpiredUploads(jobsCtx, services, log)
+
 	return &App{
 		Router:     router,
 		Config:     cfg,
 		Logger:     log,
 		DB:         db,
-		Cr2:        cr2,
+		Storage:    store,
 		Handlers:   handlers,
 		Services:   services,
 		Repository: repos,
+		stopJobs:   stopJobs,
 	}, nil
 }
 
 func (a *App) Close() error {
+	a.stopJobs()
 	return a.DB.Close()
 }
+
+// purgeExpiredUploads discards expired resumable uploads and presigned
+// upload tickets every hour
+func purgeExpiredUploads(ctx context.Context, services *service.Services, log logger.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := services.Tus.PurgeExpired(ctx)
+			if err != nil {
+				log.Error("Failed to purge expired uploads", "error", err)
+			} else if purged > 0 {
+				log.Info("Purged expired uploads", "count", purged)
+			}
+
+			purged, err = services.Presign.PurgeExpired(ctx)
+			if err != nil {
+				log.Error("Failed to purge expired upload tickets", "error", err)
+			} else if purged > 0 {
+				log.Info("Purged expired upload tickets", "count", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/httputil"
+	"github.com/gorilla/mux"
+)
+
+// AlbumHandler handles albums and their files
+type AlbumHandler struct {
+	deps Deps
+}
+
+// NewAlbumHandler creates a new AlbumHandler
+func NewAlbumHandler(deps Deps) *AlbumHandler {
+	return &AlbumHandler{
+		deps: deps,
+	}
+}
+
+// Create creates an album
+func (h *AlbumHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var album model.Album
+	if err := json.NewDecoder(r.Body).Decode(&album); err != nil {
+		httputil.ErrorResponse(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.deps.Services.Album.Create(r.Context(), album)
+	if err != nil {
+		h.albumError(w, err, "Failed to create album")
+		return
+	}
+
+	httputil.JSONResponse(w, created, http.StatusCreated)
+}
+
+// List lists the current user's albums, or the public albums of the user
+// given by the user_id query parameter
+func (h *AlbumHandler) List(w http.ResponseWriter, r *http.Request) {
+	var userID int64
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		var err error
+		userID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || userID < 1 {
+			httputil.ErrorResponse(w, "Invalid user_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	albums, err := h.deps.Services.Album.List(r.Context(), userID)
+	if err != nil {
+		h.albumError(w, err, "Failed to get albums")
+		return
+	}
+
+	httputil.JSONResponse(w, albums, http.StatusOK)
+}
+
+// Get gets an album
+func (h *AlbumHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid album ID", http.StatusBadRequest)
+		return
+	}
+
+	album, err := h.deps.Services.Album.Get(r.Context(), id)
+	if err != nil {
+		h.albumError(w, err, "Failed to get album")
+		return
+	}
+
+	httputil.JSONResponse(w, album, http.StatusOK)
+}
+
+// Update updates an album
+func (h *AlbumHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid album ID", http.StatusBadRequest)
+		return
+	}
+
+	var album model.Album
+	if err := json.NewDecoder(r.Body).Decode(&album); err != nil {
+		httputil.ErrorResponse(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.deps.Services.Album.Update(r.Context(), id, album)
+	if err != nil {
+		h.albumError(w, err, "Failed to update album")
+		return
+	}
+
+	httputil.JSONResponse(w, updated, http.StatusOK)
+}
+
+// Delete deletes an album
+func (h *AlbumHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid album ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.deps.Services.Album.Delete(r.Context(), id); err != nil {
+		h.albumError(w, err, "Failed to delete album")
+		return
+	}
+
+	httputil.JSONResponse(w, map[string]string{"message": "Album deleted successfully"}, http.StatusOK)
+}
+
+// ListFiles lists a page of an album's files in their manual order, with
+// the limit and cursor query parameters
+func (h *AlbumHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid album ID", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			httputil.ErrorResponse(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	files, err := h.deps.Services.Album.ListFiles(r.Context(), id, limit, q.Get("cursor"))
+	if err != nil {
+		h.albumError(w, err, "Failed to get album files")
+		return
+	}
+
+	httputil.JSONResponse(w, files, http.StatusOK)
+}
+
+// AddFiles appends files to an album
+func (h *AlbumHandler) AddFiles(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid album ID", http.StatusBadRequest)
+		return
+	}
+
+	var files model.AlbumFiles
+	if err := json.NewDecoder(r.Body).Decode(&files); err != nil {
+		httputil.ErrorResponse(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.deps.Services.Album.AddFiles(r.Context(), id, files); err != nil {
+		h.albumError(w, err, "Failed to add files to album")
+		return
+	}
+
+	httputil.JSONResponse(w, map[string]string{"message": "Files added to album"}, http.StatusOK)
+}
+
+// RemoveFile removes a file from an album
+func (h *AlbumHandler) RemoveFile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid album ID", http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.ParseInt(vars["file_id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.deps.Services.Album.RemoveFile(r.Context(), id, fileID); err != nil {
+		h.albumError(w, err, "Failed to remove file from album")
+		return
+	}
+
+	httputil.JSONResponse(w, map[string]string{"message": "File removed from album"}, http.StatusOK)
+}
+
+// Reorder sets the order of an album's files
+func (h *AlbumHandler) Reorder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid album ID", http.StatusBadRequest)
+		return
+	}
+
+	var files model.AlbumFiles
+	if err := json.NewDecoder(r.Body).Decode(&files); err != nil {
+		httputil.ErrorResponse(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.deps.Services.Album.Reorder(r.Context(), id, files); err != nil {
+		h.albumError(w, err, "Failed to reorder album")
+		return
+	}
+
+	httputil.JSONResponse(w, map[string]string{"message": "Album reordered"}, http.StatusOK)
+}
+
+// albumError maps album failures to HTTP responses
+func (h *AlbumHandler) albumError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, model.ErrInvalidAlbum), errors.Is(err, model.ErrInvalidListOptions):
+		httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, model.ErrNotFound):
+		httputil.ErrorResponse(w, "Album or file not found", http.StatusNotFound)
+	case errors.Is(err, model.ErrForbidden):
+		httputil.ErrorResponse(w, "You do not have access to this album", http.StatusForbidden)
+	default:
+		h.deps.Logger.Error(message, "error", err)
+		httputil.ErrorResponse(w, message, http.StatusInternalServerError)
+	}
+}
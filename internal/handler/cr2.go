@@ -1,11 +1,22 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/filetype"
 	"github.com/adorufus/imgupper/pkg/httputil"
+	"github.com/gorilla/mux"
 )
 
 type Cr2Handler struct {
@@ -18,66 +29,451 @@ func NewCr2Handler(deps Deps) *Cr2Handler {
 	}
 }
 
+// multipartOverhead is the slack allowed on top of the file size for
+// multipart boundaries, part headers and form fields
+const multipartOverhead = 1 << 20
+
+// ObjectUpload streams a multipart upload straight into storage. Form fields
+// must precede the file part because the body is read only once.
 func (h *Cr2Handler) ObjectUpload(w http.ResponseWriter, r *http.Request) {
 	var req model.CR2UploadRequest
 
-	if userIDStr := r.FormValue("user_id"); userIDStr != "" {
-		userId, err := strconv.ParseInt(userIDStr, 10, 64)
+	r.Body = http.MaxBytesReader(w, r.Body, h.deps.Config.Upload.MaxSize+multipartOverhead)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		httputil.ErrorResponse(w, "Expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			httputil.ErrorResponse(w, "Missing file field", http.StatusBadRequest)
+			return
+		}
 		if err != nil {
-			httputil.ErrorResponse(w, "Invalid user_id format", http.StatusBadRequest)
+			h.uploadError(w, err)
+			return
+		}
+
+		switch part.FormName() {
+		case "on_behalf_of":
+			value, err := readFormField(part)
+			if err != nil {
+				h.uploadError(w, err)
+				return
+			}
+
+			onBehalfOf, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				httputil.ErrorResponse(w, "Invalid on_behalf_of format", http.StatusBadRequest)
+				return
+			}
+
+			req.OnBehalfOf = onBehalfOf
+		case "public":
+			value, err := readFormField(part)
+			if err != nil {
+				h.uploadError(w, err)
+				return
+			}
+
+			isPublic, err := strconv.ParseBool(value)
+			if err != nil {
+				httputil.ErrorResponse(w, "Invalid public flag", http.StatusBadRequest)
+				return
+			}
+
+			req.IsPublic = isPublic
+		case "metadata_policy":
+			value, err := readFormField(part)
+			if err != nil {
+				h.uploadError(w, err)
+				return
+			}
+
+			req.MetadataPolicy = value
+		case "keep_original":
+			value, err := readFormField(part)
+			if err != nil {
+				h.uploadError(w, err)
+				return
+			}
+
+			keepOriginal, err := strconv.ParseBool(value)
+			if err != nil {
+				httputil.ErrorResponse(w, "Invalid keep_original flag", http.StatusBadRequest)
+				return
+			}
+
+			req.KeepOriginal = &keepOriginal
+		case "file":
+			req.Filename = part.FileName()
+			req.ContentType = part.Header.Get("Content-Type")
+
+			response, err := h.deps.Services.Cr2.ObjectUpload(r.Context(), req, part)
+			if err != nil {
+				h.uploadError(w, err)
+				return
+			}
+
+			httputil.JSONResponse(w, response, http.StatusCreated)
 			return
 		}
 
-		req.UserID = userId
-	} else {
-		httputil.ErrorResponse(w, "Missing user_id", http.StatusBadRequest)
+		part.Close()
+	}
+}
+
+// uploadError maps upload failures to HTTP responses
+func (h *Cr2Handler) uploadError(w http.ResponseWriter, err error) {
+	var maxBytes *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, model.ErrFileTooLarge), errors.As(err, &maxBytes):
+		httputil.ErrorResponse(w, "File exceeds the maximum upload size", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, model.ErrForbidden):
+		httputil.ErrorResponse(w, "Only admins can upload on behalf of another user", http.StatusForbidden)
+	case errors.Is(err, model.ErrInvalidMetadataPolicy):
+		httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, model.ErrFileType):
+		fileTypeError(w, err)
+	case errors.Is(err, model.ErrImageTooLarge), errors.Is(err, model.ErrMetadataNotScrubbable):
+		httputil.ErrorResponse(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, model.ErrUnsupportedImage):
+		httputil.ErrorResponse(w, "Image could not be read", http.StatusUnsupportedMediaType)
+	default:
+		h.deps.Logger.Error("Unable to upload file", "error", err)
+		httputil.ErrorResponse(w, "Unable to upload file "+err.Error(), http.StatusBadRequest)
+	}
+}
+
+// fileTypeError reports an upload rejected by content sniffing
+func fileTypeError(w http.ResponseWriter, err error) {
+	var typeErr *model.FileTypeError
+	if !errors.As(err, &typeErr) {
+		httputil.ErrorResponse(w, err.Error(), http.StatusUnsupportedMediaType)
 		return
 	}
 
-	err := r.ParseMultipartForm(300 << 20) // 10MB limit
+	message := "File type is not allowed"
+	if errors.Is(typeErr.Err, filetype.ErrMismatch) {
+		message = "File content does not match its declared type"
+	}
+
+	httputil.JSONResponse(w, map[string]interface{}{
+		"error":   message,
+		"details": typeErr,
+	}, http.StatusUnsupportedMediaType)
+}
+
+// readFormField reads a small, non-file form value
+func readFormField(part *multipart.Part) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(part, 1024))
 	if err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return "", err
+	}
+	return strings.TrimSpace(string(value)), nil
+}
+
+func (h *Cr2Handler) ObjectFetchById(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid object ID", http.StatusBadRequest)
 		return
 	}
 
-	// Get file from form
-	object, handler, err := r.FormFile("file")
+	response, err := h.deps.Services.Cr2.ObjectFetchById(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Error retrieving file", http.StatusBadRequest)
+		switch {
+		case errors.Is(err, model.ErrNotFound):
+			httputil.ErrorResponse(w, "Object not found", http.StatusNotFound)
+		case errors.Is(err, model.ErrForbidden):
+			httputil.ErrorResponse(w, "You do not have access to this object", http.StatusForbidden)
+		default:
+			h.deps.Logger.Error("Unable to fetch object", "error", err, "id", id)
+			httputil.ErrorResponse(w, "Unable to fetch object", http.StatusInternalServerError)
+		}
 		return
 	}
-	defer object.Close()
 
-	response, err := h.deps.Services.Cr2.ObjectUpload(r.Context(), req, object, handler)
+	httputil.JSONResponse(w, response, http.StatusOK)
+}
+
+// ObjectFetchByUserId lists the current user's files a page at a time.
+// Query parameters: sort (date, size, name), order (asc, desc), limit,
+// cursor (next_cursor of the previous page), mime_type, created_after and
+// created_before (RFC 3339 or YYYY-MM-DD), min_size and max_size in bytes.
+func (h *Cr2Handler) ObjectFetchByUserId(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r.URL.Query())
 	if err != nil {
-		h.deps.Logger.Error("Unable to upload file", "error", err)
-		httputil.ErrorResponse(w, "Unable to upload file "+err.Error(), http.StatusBadRequest)
+		httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	httputil.JSONResponse(w, response, http.StatusCreated)
+	response, err := h.deps.Services.Cr2.ObjectFetchByUserId(r.Context(), opts)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidListOptions) {
+			httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.deps.Logger.Error("Unable to fetch objects from user", "error", err)
+		httputil.ErrorResponse(w, "Unable to fetch objects from user", http.StatusInternalServerError)
+		return
+	}
+
+	httputil.JSONResponse(w, response, http.StatusOK)
 }
 
-func (h *Cr2Handler) ObjectFetchById(w http.ResponseWriter, r *http.Request) {
+func (h *Cr2Handler) ObjectDelete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid object ID", http.StatusBadRequest)
+		return
+	}
 
-	response, err := h.deps.Services.Cr2.ObjectFetchById(r.Context(), 0)
+	err = h.deps.Services.Cr2.ObjectDelete(r.Context(), id)
 	if err != nil {
-		h.deps.Logger.Error("Unable to fetch object", "error", err)
-		httputil.ErrorResponse(w, "Unable to fetch object: "+err.Error(), http.StatusNotFound)
+		var partial *model.PartialDeleteError
+
+		switch {
+		case errors.Is(err, model.ErrNotFound):
+			httputil.ErrorResponse(w, "Object not found", http.StatusNotFound)
+		case errors.Is(err, model.ErrForbidden):
+			httputil.ErrorResponse(w, "You do not have access to this object", http.StatusForbidden)
+		case errors.As(err, &partial):
+			httputil.JSONResponse(w, map[string]interface{}{
+				"error":   "Object was only partially deleted, retry the request",
+				"details": partial,
+			}, http.StatusInternalServerError)
+		default:
+			h.deps.Logger.Error("Unable to delete object", "error", err, "id", id)
+			httputil.ErrorResponse(w, "Unable to delete object", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	httputil.JSONResponse(w, map[string]string{"message": "Object deleted successfully"}, http.StatusOK)
+}
+
+// ObjectDownload streams a stored file to its owner
+func (h *Cr2Handler) ObjectDownload(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid object ID", http.StatusBadRequest)
+		return
+	}
+
+	content, err := h.deps.Services.Cr2.ObjectDownload(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrNotFound):
+			httputil.ErrorResponse(w, "Object not found", http.StatusNotFound)
+		case errors.Is(err, model.ErrForbidden):
+			httputil.ErrorResponse(w, "You do not have access to this object", http.StatusForbidden)
+		default:
+			h.deps.Logger.Error("Unable to download object", "error", err, "id", id)
+			httputil.ErrorResponse(w, "Unable to download object", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer content.Body.Close()
+
+	w.Header().Set("Content-Type", content.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(content.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": content.Filename}))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content.Body); err != nil {
+		h.deps.Logger.Warn("Failed to stream object", "error", err, "id", id)
+	}
+}
+
+func (h *Cr2Handler) ObjectMetadata(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid object ID", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.deps.Services.Cr2.ObjectMetadata(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrNotFound):
+			httputil.ErrorResponse(w, "Object or metadata not found", http.StatusNotFound)
+		case errors.Is(err, model.ErrForbidden):
+			httputil.ErrorResponse(w, "You do not have access to this object", http.StatusForbidden)
+		default:
+			h.deps.Logger.Error("Unable to fetch object metadata", "error", err, "id", id)
+			httputil.ErrorResponse(w, "Unable to fetch object metadata", http.StatusInternalServerError)
+		}
 		return
 	}
 
 	httputil.JSONResponse(w, response, http.StatusOK)
 }
 
-func (h *Cr2Handler) ObjectFetchByUserId(w http.ResponseWriter, r *http.Request) {
+func (h *Cr2Handler) ObjectSimilar(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid object ID", http.StatusBadRequest)
+		return
+	}
 
-	response, err := h.deps.Services.Cr2.ObjectFetchByUserId(r.Context())
+	q := r.URL.Query()
+	distance, limit := -1, 0
+	if v := q.Get("distance"); v != "" {
+		distance, err = strconv.Atoi(v)
+		if err != nil || distance < 0 || distance > 64 {
+			httputil.ErrorResponse(w, "Invalid distance parameter, expected 0 to 64", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			httputil.ErrorResponse(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	response, err := h.deps.Services.Cr2.ObjectSimilar(r.Context(), id, distance, limit)
 	if err != nil {
-		h.deps.Logger.Error("Unable to fetch objects from user", "error", err)
-		httputil.ErrorResponse(w, "Unable to fetch objects from user: "+err.Error(), http.StatusNotFound)
+		switch {
+		case errors.Is(err, model.ErrNotFound):
+			httputil.ErrorResponse(w, "Object not found", http.StatusNotFound)
+		case errors.Is(err, model.ErrForbidden):
+			httputil.ErrorResponse(w, "You do not have access to this object", http.StatusForbidden)
+		case errors.Is(err, model.ErrUnsupportedImage):
+			httputil.ErrorResponse(w, "Object is not an image that can be compared", http.StatusUnprocessableEntity)
+		default:
+			h.deps.Logger.Error("Unable to find similar objects", "error", err, "id", id)
+			httputil.ErrorResponse(w, "Unable to find similar objects", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	httputil.JSONResponse(w, response, http.StatusOK)
+}
+
+// ObjectSetTags replaces the tags of a file
+func (h *Cr2Handler) ObjectSetTags(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid object ID", http.StatusBadRequest)
+		return
+	}
+
+	var tags model.FileTags
+	if err := json.NewDecoder(r.Body).Decode(&tags); err != nil {
+		httputil.ErrorResponse(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.deps.Services.Cr2.ObjectSetTags(r.Context(), id, tags)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrInvalidTags):
+			httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, model.ErrNotFound):
+			httputil.ErrorResponse(w, "Object not found", http.StatusNotFound)
+		case errors.Is(err, model.ErrForbidden):
+			httputil.ErrorResponse(w, "You do not have access to this object", http.StatusForbidden)
+		default:
+			h.deps.Logger.Error("Unable to update object tags", "error", err, "id", id)
+			httputil.ErrorResponse(w, "Unable to update object tags", http.StatusInternalServerError)
+		}
 		return
 	}
 
 	httputil.JSONResponse(w, response, http.StatusOK)
 }
+
+// ObjectSearch searches the current user's files. Query parameters: q, a
+// full-text query over filenames, tags and camera metadata; tag, repeatable,
+// to require tags; limit and cursor to page through the results.
+func (h *Cr2Handler) ObjectSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := model.SearchOptions{
+		Query:  q.Get("q"),
+		Tags:   q["tag"],
+		Cursor: q.Get("cursor"),
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			httputil.ErrorResponse(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		opts.Limit = limit
+	}
+
+	response, err := h.deps.Services.Cr2.ObjectSearch(r.Context(), opts)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidListOptions) || errors.Is(err, model.ErrInvalidTags) {
+			httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.deps.Logger.Error("Unable to search objects", "error", err)
+		httputil.ErrorResponse(w, "Unable to search objects", http.StatusInternalServerError)
+		return
+	}
+
+	httputil.JSONResponse(w, response, http.StatusOK)
+}
+
+// parseListOptions reads file listing parameters from a query string,
+// leaving their validation to model.FileListOptions
+func parseListOptions(q url.Values) (model.FileListOptions, error) {
+	opts := model.FileListOptions{
+		Sort:     q.Get("sort"),
+		Order:    q.Get("order"),
+		Cursor:   q.Get("cursor"),
+		MimeType: q.Get("mime_type"),
+	}
+
+	var err error
+	if v := q.Get("limit"); v != "" {
+		opts.Limit, err = strconv.Atoi(v)
+		if err != nil || opts.Limit < 1 {
+			return opts, fmt.Errorf("%w: limit must be a positive integer", model.ErrInvalidListOptions)
+		}
+	}
+
+	for name, dst := range map[string]*time.Time{
+		"created_after":  &opts.CreatedAfter,
+		"created_before": &opts.CreatedBefore,
+	} {
+		if v := q.Get(name); v != "" {
+			if *dst, err = parseListTime(v); err != nil {
+				return opts, fmt.Errorf("%w: %s must be RFC 3339 or YYYY-MM-DD", model.ErrInvalidListOptions, name)
+			}
+		}
+	}
+
+	for name, dst := range map[string]*int64{
+		"min_size": &opts.MinSize,
+		"max_size": &opts.MaxSize,
+	} {
+		if v := q.Get(name); v != "" {
+			if *dst, err = strconv.ParseInt(v, 10, 64); err != nil || *dst < 0 {
+				return opts, fmt.Errorf("%w: %s must be a byte count", model.ErrInvalidListOptions, name)
+			}
+		}
+	}
+
+	return opts, nil
+}
+
+// parseListTime accepts a full timestamp or a date, read as midnight UTC
+func parseListTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"net/http"
+
+	"github.com/adorufus/imgupper/config"
 	"github.com/adorufus/imgupper/internal/service"
 	"github.com/adorufus/imgupper/pkg/logger"
 	"github.com/adorufus/imgupper/pkg/middleware"
@@ -12,30 +15,45 @@ type Deps struct {
 	Services  *service.Services
 	Logger    logger.Logger
 	JWTConfig middleware.JWTConfig
+	Config    *config.Config
 }
 
 // Handlers contains all HTTP handlers
 type Handlers struct {
-	deps   Deps
-	user   *UserHandler
-	health *HealthHandler
-	auth   *AuthHandler
-	cr2    *Cr2Handler
+	deps      Deps
+	user      *UserHandler
+	health    *HealthHandler
+	auth      *AuthHandler
+	cr2       *Cr2Handler
+	tus       *TusHandler
+	image     *ImageHandler
+	watermark *WatermarkHandler
+	album     *AlbumHandler
 }
 
 // NewHandlers creates a new Handlers instance
 func NewHandlers(deps Deps) *Handlers {
 	return &Handlers{
-		deps:   deps,
-		user:   NewUserHandler(deps),
-		health: NewHealthHandler(deps),
-		auth:   NewAuthHandler(deps),
-		cr2:    NewCr2Handler(deps),
+		deps:      deps,
+		user:      NewUserHandler(deps),
+		health:    NewHealthHandler(deps),
+		auth:      NewAuthHandler(deps),
+		cr2:       NewCr2Handler(deps),
+		tus:       NewTusHandler(deps),
+		image:     NewImageHandler(deps),
+		watermark: NewWatermarkHandler(deps),
+		album:     NewAlbumHandler(deps),
 	}
 }
 
 // RegisterRoutes registers all routes to the router
 func (h *Handlers) RegisterRoutes(router *mux.Router) {
+	// Routes that move whole files outlive the server timeouts
+	transfer := middleware.Deadline(h.deps.Config.Upload.Timeout)
+
+	// On-the-fly image transformations, public so they work in <img> tags
+	router.HandleFunc("/i/{id:[0-9]+}", h.image.Render).Methods("GET")
+
 	// API v1 routes
 	api := router.PathPrefix("/api/v1").Subrouter()
 
@@ -52,12 +70,58 @@ func (h *Handlers) RegisterRoutes(router *mux.Router) {
 	users.Use(middleware.JWTAuth(h.deps.JWTConfig))
 	users.HandleFunc("", h.user.Create).Methods("POST")
 	users.HandleFunc("", h.user.GetAll).Methods("GET")
+	users.HandleFunc("/me/privacy", h.user.GetPrivacy).Methods("GET")
+	users.HandleFunc("/me/privacy", h.user.UpdatePrivacy).Methods("PUT")
+	users.HandleFunc("/me/watermark", h.watermark.GetDefault).Methods("GET")
+	users.HandleFunc("/me/watermark", h.watermark.SetDefault).Methods("PUT")
 	users.HandleFunc("/{id}", h.user.GetByID).Methods("GET")
 	users.HandleFunc("/{id}", h.user.Update).Methods("PUT")
 	users.HandleFunc("/{id}", h.user.Delete).Methods("DELETE")
 
+	// Resumable uploads (tus 1.0), OPTIONS is open so clients can discover the server
+	api.HandleFunc("/object/tus", h.tus.Options).Methods("OPTIONS")
+	tus := api.PathPrefix("/object/tus").Subrouter()
+	tus.Use(middleware.JWTAuth(h.deps.JWTConfig))
+	tus.HandleFunc("", h.tus.Create).Methods("POST")
+	tus.HandleFunc("/{id}", h.tus.Head).Methods("HEAD")
+	tus.Handle("/{id}", transfer(http.HandlerFunc(h.tus.Patch))).Methods("PATCH")
+	tus.HandleFunc("/{id}", h.tus.Terminate).Methods("DELETE")
+
+	// Watermark templates drawn over display variants
+	watermarks := api.PathPrefix("/watermarks").Subrouter()
+	watermarks.Use(middleware.JWTAuth(h.deps.JWTConfig))
+	watermarks.HandleFunc("", h.watermark.Create).Methods("POST")
+	watermarks.HandleFunc("", h.watermark.List).Methods("GET")
+	watermarks.HandleFunc("/{id:[0-9]+}", h.watermark.Get).Methods("GET")
+	watermarks.HandleFunc("/{id:[0-9]+}", h.watermark.Update).Methods("PUT")
+	watermarks.HandleFunc("/{id:[0-9]+}", h.watermark.Delete).Methods("DELETE")
+	watermarks.Handle("/{id:[0-9]+}/logo", transfer(http.HandlerFunc(h.watermark.UploadLogo))).Methods("PUT")
+
+	// Albums, ordered collections of a user's files
+	albums := api.PathPrefix("/albums").Subrouter()
+	albums.Use(middleware.JWTAuth(h.deps.JWTConfig))
+	albums.HandleFunc("", h.album.Create).Methods("POST")
+	albums.HandleFunc("", h.album.List).Methods("GET")
+	albums.HandleFunc("/{id:[0-9]+}", h.album.Get).Methods("GET")
+	albums.HandleFunc("/{id:[0-9]+}", h.album.Update).Methods("PUT")
+	albums.HandleFunc("/{id:[0-9]+}", h.album.Delete).Methods("DELETE")
+	albums.HandleFunc("/{id:[0-9]+}/files", h.album.ListFiles).Methods("GET")
+	albums.HandleFunc("/{id:[0-9]+}/files", h.album.AddFiles).Methods("POST")
+	albums.HandleFunc("/{id:[0-9]+}/files/order", h.album.Reorder).Methods("PUT")
+	albums.HandleFunc("/{id:[0-9]+}/files/{file_id:[0-9]+}", h.album.RemoveFile).Methods("DELETE")
+
 	object := api.PathPrefix("/object").Subrouter()
 	object.Use(middleware.JWTAuth(h.deps.JWTConfig))
-	object.HandleFunc("/upload", h.cr2.ObjectUpload).Methods("POST")
+	object.Handle("/upload", transfer(http.HandlerFunc(h.cr2.ObjectUpload))).Methods("POST")
 	object.HandleFunc("/mine", h.cr2.ObjectFetchByUserId).Methods("GET")
+	object.HandleFunc("/search", h.cr2.ObjectSearch).Methods("GET")
+	object.HandleFunc("/presign", h.cr2.ObjectPresign).Methods("POST")
+	object.HandleFunc("/{ticket:[0-9a-f-]{36}}/complete", h.cr2.ObjectComplete).Methods("POST")
+	object.HandleFunc("/{id:[0-9]+}", h.cr2.ObjectFetchById).Methods("GET")
+	object.HandleFunc("/{id:[0-9]+}/url", h.image.SignURL).Methods("GET")
+	object.Handle("/{id:[0-9]+}/download", transfer(http.HandlerFunc(h.cr2.ObjectDownload))).Methods("GET")
+	object.HandleFunc("/{id:[0-9]+}/metadata", h.cr2.ObjectMetadata).Methods("GET")
+	object.HandleFunc("/{id:[0-9]+}/similar", h.cr2.ObjectSimilar).Methods("GET")
+	object.HandleFunc("/{id:[0-9]+}/tags", h.cr2.ObjectSetTags).Methods("PUT")
+	object.HandleFunc("/{id:[0-9]+}", h.cr2.ObjectDelete).Methods("DELETE")
 }
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/httputil"
+	"github.com/adorufus/imgupper/pkg/imaging"
+	"github.com/gorilla/mux"
+)
+
+// ImageHandler serves on-the-fly image transformations
+type ImageHandler struct {
+	deps Deps
+}
+
+// NewImageHandler creates a new ImageHandler
+func NewImageHandler(deps Deps) *ImageHandler {
+	return &ImageHandler{
+		deps: deps,
+	}
+}
+
+// Render handles GET /i/{id}?w=&h=&fit=&crop=&q=&format=&rotate=&exp=&sig=
+func (h *ImageHandler) Render(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid image ID", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseTransformOptions(r.URL.Query())
+	if err != nil {
+		httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sig, err := parseImageSignature(r.URL.Query())
+	if err != nil {
+		httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rendered, err := h.deps.Services.Image.Render(r.Context(), id, opts, sig)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrNotFound), errors.Is(err, model.ErrForbidden):
+			httputil.ErrorResponse(w, "Image not found", http.StatusNotFound)
+		case errors.Is(err, model.ErrInvalidSignature):
+			httputil.ErrorResponse(w, "Invalid or expired signature", http.StatusForbidden)
+		case errors.Is(err, model.ErrInvalidTransform):
+			httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, model.ErrUnsupportedImage):
+			httputil.ErrorResponse(w, "File cannot be transformed", http.StatusUnsupportedMediaType)
+		case errors.Is(err, model.ErrImageTooLarge):
+			httputil.ErrorResponse(w, "Image is too large to transform", http.StatusUnprocessableEntity)
+		default:
+			h.deps.Logger.Error("Unable to render image", "error", err, "id", id)
+			httputil.ErrorResponse(w, "Unable to render image", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer rendered.Body.Close()
+
+	etag := `"` + rendered.ETag + `"`
+	w.Header().Set("ETag", etag)
+	scope := "public"
+	if !rendered.Public {
+		scope = "private"
+	}
+	if sig.Expires != 0 {
+		maxAge := max(sig.Expires-time.Now().Unix(), 0)
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.FormatInt(maxAge, 10))
+	} else if rendered.Watermarked {
+		// The ETag changes with the watermark, clients revalidate every time
+		w.Header().Set("Cache-Control", scope+", no-cache")
+	} else {
+		w.Header().Set("Cache-Control", scope+", max-age=31536000, immutable")
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", rendered.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(rendered.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, rendered.Body); err != nil {
+		h.deps.Logger.Warn("Failed to stream rendered image", "error", err, "id", id)
+	}
+}
+
+// SignURL handles GET /api/v1/object/{id}/url, minting a signed
+// transformation URL. expires_in is the lifetime in seconds, 0 never expires.
+func (h *ImageHandler) SignURL(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid object ID", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	opts, err := parseTransformOptions(q)
+	if err != nil {
+		httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if v := q.Get("expires_in"); v != "" {
+		seconds, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || seconds < 0 {
+			httputil.ErrorResponse(w, "Invalid expires_in parameter", http.StatusBadRequest)
+			return
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+
+	response, err := h.deps.Services.Image.SignURL(r.Context(), id, opts, ttl)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrNotFound):
+			httputil.ErrorResponse(w, "Object not found", http.StatusNotFound)
+		case errors.Is(err, model.ErrForbidden):
+			httputil.ErrorResponse(w, "You do not have access to this object", http.StatusForbidden)
+		case errors.Is(err, model.ErrInvalidTransform):
+			httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		default:
+			h.deps.Logger.Error("Unable to sign image URL", "error", err, "id", id)
+			httputil.ErrorResponse(w, "Unable to sign image URL", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	httputil.JSONResponse(w, response, http.StatusOK)
+}
+
+// parseImageSignature reads the exp and sig parameters of a signed URL
+func parseImageSignature(q url.Values) (model.ImageSignature, error) {
+	sig := model.ImageSignature{Value: q.Get("sig")}
+
+	if v := q.Get("exp"); v != "" {
+		expires, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return sig, errors.New("invalid exp parameter")
+		}
+		sig.Expires = expires
+	}
+
+	return sig, nil
+}
+
+// parseTransformOptions reads transformation parameters from the query string
+func parseTransformOptions(q url.Values) (imaging.TransformOptions, error) {
+	var opts imaging.TransformOptions
+	var err error
+
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"w", &opts.Width},
+		{"h", &opts.Height},
+		{"q", &opts.Quality},
+		{"rotate", &opts.Rotate},
+	}
+	for _, p := range ints {
+		if v := q.Get(p.name); v != "" {
+			if *p.dst, err = strconv.Atoi(v); err != nil {
+				return opts, fmt.Errorf("invalid %s parameter", p.name)
+			}
+		}
+	}
+
+	opts.Fit = q.Get("fit")
+
+	switch format := strings.ToLower(q.Get("format")); format {
+	case "jpg":
+		opts.Format = imaging.FormatJPEG
+	default:
+		opts.Format = format
+	}
+
+	if crop := q.Get("crop"); crop != "" {
+		parts := strings.Split(crop, ",")
+		if len(parts) != 4 {
+			return opts, errors.New("crop must be x,y,width,height")
+		}
+
+		var v [4]int
+		for i, part := range parts {
+			if v[i], err = strconv.Atoi(strings.TrimSpace(part)); err != nil {
+				return opts, errors.New("crop must be x,y,width,height")
+			}
+		}
+		opts.Crop = image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3])
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/httputil"
+	"github.com/adorufus/imgupper/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// ObjectPresign issues a presigned URL for uploading straight to the bucket
+func (h *Cr2Handler) ObjectPresign(w http.ResponseWriter, r *http.Request) {
+	var req model.PresignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.ErrorResponse(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.deps.Services.Presign.Presign(r.Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrFileTooLarge):
+			httputil.ErrorResponse(w, "File exceeds the maximum upload size", http.StatusRequestEntityTooLarge)
+		case errors.Is(err, storage.ErrNotSupported):
+			httputil.ErrorResponse(w, "Direct uploads are not available on this server", http.StatusNotImplemented)
+		case errors.Is(err, model.ErrFileType):
+			fileTypeError(w, err)
+		default:
+			h.deps.Logger.Error("Unable to presign upload", "error", err)
+			httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	httputil.JSONResponse(w, response, http.StatusCreated)
+}
+
+// ObjectComplete finalizes a presigned upload
+func (h *Cr2Handler) ObjectComplete(w http.ResponseWriter, r *http.Request) {
+	ticket := mux.Vars(r)["ticket"]
+
+	response, err := h.deps.Services.Presign.Complete(r.Context(), ticket)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrNotFound), errors.Is(err, model.ErrForbidden):
+			httputil.ErrorResponse(w, "Upload ticket not found", http.StatusNotFound)
+		case errors.Is(err, model.ErrUploadExpired):
+			httputil.ErrorResponse(w, "Upload ticket has expired", http.StatusGone)
+		case errors.Is(err, model.ErrUploadIncomplete):
+			httputil.ErrorResponse(w, "Object has not been uploaded yet", http.StatusConflict)
+		case errors.Is(err, model.ErrUploadInvalid):
+			httputil.ErrorResponse(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, model.ErrFileType):
+			fileTypeError(w, err)
+		case errors.Is(err, model.ErrImageTooLarge), errors.Is(err, model.ErrMetadataNotScrubbable):
+			httputil.ErrorResponse(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, model.ErrUnsupportedImage):
+			httputil.ErrorResponse(w, "Image could not be read", http.StatusUnsupportedMediaType)
+		default:
+			h.deps.Logger.Error("Unable to complete upload", "error", err, "ticket", ticket)
+			httputil.ErrorResponse(w, "Unable to complete upload", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	httputil.JSONResponse(w, response, http.StatusCreated)
+}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/httputil"
+	"github.com/gorilla/mux"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+	tusBasePath   = "/api/v1/object/tus"
+)
+
+// TusHandler implements the tus 1.0 resumable upload protocol
+type TusHandler struct {
+	deps Deps
+}
+
+// NewTusHandler creates a new TusHandler
+func NewTusHandler(deps Deps) *TusHandler {
+	return &TusHandler{
+		deps: deps,
+	}
+}
+
+// Options advertises the supported protocol version and extensions
+func (h *TusHandler) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.deps.Config.Upload.MaxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create handles the creation extension
+func (h *TusHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		httputil.ErrorResponse(w, "Invalid Upload-Length header", http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid Upload-Metadata header", http.StatusBadRequest)
+		return
+	}
+
+	req := model.TusCreateRequest{
+		UploadLength: length,
+		Filename:     firstNonEmpty(metadata["filename"], metadata["name"]),
+		MimeType:     firstNonEmpty(metadata["filetype"], metadata["type"], "application/octet-stream"),
+	}
+	if public := metadata["public"]; public != "" {
+		req.IsPublic, err = strconv.ParseBool(public)
+		if err != nil {
+			httputil.ErrorResponse(w, "Invalid public metadata", http.StatusBadRequest)
+			return
+		}
+	}
+
+	upload, err := h.deps.Services.Tus.Create(r.Context(), req)
+	if err != nil {
+		h.tusError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", tusBasePath+"/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Head reports the current offset of an upload
+func (h *TusHandler) Head(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+
+	upload, err := h.deps.Services.Tus.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		// HEAD responses carry no body
+		w.WriteHeader(tusErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.UploadOffset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.UploadLength, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+// Patch appends a chunk to an upload
+func (h *TusHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		httputil.ErrorResponse(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		httputil.ErrorResponse(w, "Invalid Upload-Offset header", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.deps.Services.Tus.Patch(r.Context(), mux.Vars(r)["id"], offset, r.Body)
+	if err != nil {
+		h.tusError(w, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(result.Upload.UploadOffset, 10))
+	if result.File != nil {
+		w.Header().Set("Upload-File-Id", strconv.FormatInt(result.File.ID, 10))
+	} else {
+		w.Header().Set("Upload-Expires", result.Upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Terminate handles the termination extension
+func (h *TusHandler) Terminate(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+
+	if err := h.deps.Services.Tus.Terminate(r.Context(), mux.Vars(r)["id"]); err != nil {
+		h.tusError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkVersion sets the protocol header and rejects unsupported clients
+func (h *TusHandler) checkVersion(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		httputil.ErrorResponse(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return false
+	}
+
+	return true
+}
+
+func (h *TusHandler) tusError(w http.ResponseWriter, err error) {
+	status := tusErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		h.deps.Logger.Error("Resumable upload failed", "error", err)
+	}
+
+	httputil.ErrorResponse(w, err.Error(), status)
+}
+
+func tusErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, model.ErrNotFound), errors.Is(err, model.ErrForbidden):
+		// Do not reveal uploads belonging to other users
+		return http.StatusNotFound
+	case errors.Is(err, model.ErrUploadExpired):
+		return http.StatusGone
+	case errors.Is(err, model.ErrOffsetMismatch), errors.Is(err, model.ErrUploadLocked):
+		return http.StatusConflict
+	case errors.Is(err, model.ErrFileTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, model.ErrFileType), errors.Is(err, model.ErrUnsupportedImage):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, model.ErrImageTooLarge), errors.Is(err, model.ErrMetadataNotScrubbable):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// parseTusMetadata decodes "key base64value,key2 base64value2" pairs
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if header == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("empty metadata key")
+		}
+
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -112,3 +113,37 @@ func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	httputil.JSONResponse(w, map[string]string{"message": "User deleted successfully"}, http.StatusOK)
 }
+
+// GetPrivacy returns the upload privacy settings of the current user
+func (h *UserHandler) GetPrivacy(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.deps.Services.User.GetPrivacy(r.Context())
+	if err != nil {
+		h.deps.Logger.Error("Failed to get privacy settings", "error", err)
+		httputil.ErrorResponse(w, "Failed to get privacy settings", http.StatusInternalServerError)
+		return
+	}
+
+	httputil.JSONResponse(w, settings, http.StatusOK)
+}
+
+// UpdatePrivacy updates the upload privacy settings of the current user
+func (h *UserHandler) UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
+	var settings model.PrivacySettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		httputil.ErrorResponse(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.deps.Services.User.UpdatePrivacy(r.Context(), settings)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidMetadataPolicy) {
+			httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.deps.Logger.Error("Failed to update privacy settings", "error", err)
+		httputil.ErrorResponse(w, "Failed to update privacy settings", http.StatusInternalServerError)
+		return
+	}
+
+	httputil.JSONResponse(w, updated, http.StatusOK)
+}
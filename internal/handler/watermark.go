@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/httputil"
+	"github.com/gorilla/mux"
+)
+
+// WatermarkHandler handles the watermark templates of the current user
+type WatermarkHandler struct {
+	deps Deps
+}
+
+// NewWatermarkHandler creates a new WatermarkHandler
+func NewWatermarkHandler(deps Deps) *WatermarkHandler {
+	return &WatermarkHandler{
+		deps: deps,
+	}
+}
+
+// Create creates a watermark
+func (h *WatermarkHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var watermark model.Watermark
+	if err := json.NewDecoder(r.Body).Decode(&watermark); err != nil {
+		httputil.ErrorResponse(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.deps.Services.Watermark.Create(r.Context(), watermark)
+	if err != nil {
+		h.watermarkError(w, err, "Failed to create watermark")
+		return
+	}
+
+	httputil.JSONResponse(w, created, http.StatusCreated)
+}
+
+// List lists the watermarks of the current user
+func (h *WatermarkHandler) List(w http.ResponseWriter, r *http.Request) {
+	watermarks, err := h.deps.Services.Watermark.List(r.Context())
+	if err != nil {
+		h.watermarkError(w, err, "Failed to get watermarks")
+		return
+	}
+
+	httputil.JSONResponse(w, watermarks, http.StatusOK)
+}
+
+// Get gets a watermark
+func (h *WatermarkHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid watermark ID", http.StatusBadRequest)
+		return
+	}
+
+	watermark, err := h.deps.Services.Watermark.Get(r.Context(), id)
+	if err != nil {
+		h.watermarkError(w, err, "Failed to get watermark")
+		return
+	}
+
+	httputil.JSONResponse(w, watermark, http.StatusOK)
+}
+
+// Update updates a watermark
+func (h *WatermarkHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid watermark ID", http.StatusBadRequest)
+		return
+	}
+
+	var watermark model.Watermark
+	if err := json.NewDecoder(r.Body).Decode(&watermark); err != nil {
+		httputil.ErrorResponse(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.deps.Services.Watermark.Update(r.Context(), id, watermark)
+	if err != nil {
+		h.watermarkError(w, err, "Failed to update watermark")
+		return
+	}
+
+	httputil.JSONResponse(w, updated, http.StatusOK)
+}
+
+// Delete deletes a watermark
+func (h *WatermarkHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid watermark ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.deps.Services.Watermark.Delete(r.Context(), id); err != nil {
+		h.watermarkError(w, err, "Failed to delete watermark")
+		return
+	}
+
+	httputil.JSONResponse(w, map[string]string{"message": "Watermark deleted successfully"}, http.StatusOK)
+}
+
+// UploadLogo stores the PNG logo of an image watermark, sent as the raw
+// request body
+func (h *WatermarkHandler) UploadLogo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.ErrorResponse(w, "Invalid watermark ID", http.StatusBadRequest)
+		return
+	}
+
+	watermark, err := h.deps.Services.Watermark.UploadLogo(r.Context(), id, r.Body)
+	if err != nil {
+		h.watermarkError(w, err, "Failed to upload watermark logo")
+		return
+	}
+
+	httputil.JSONResponse(w, watermark, http.StatusOK)
+}
+
+// GetDefault returns the watermark applied to the current user's uploads
+func (h *WatermarkHandler) GetDefault(w http.ResponseWriter, r *http.Request) {
+	def, err := h.deps.Services.Watermark.GetDefault(r.Context())
+	if err != nil {
+		h.watermarkError(w, err, "Failed to get default watermark")
+		return
+	}
+
+	httputil.JSONResponse(w, def, http.StatusOK)
+}
+
+// SetDefault selects the watermark applied to the current user's uploads,
+// a null watermark_id turns watermarking off
+func (h *WatermarkHandler) SetDefault(w http.ResponseWriter, r *http.Request) {
+	var def model.WatermarkDefault
+	if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+		httputil.ErrorResponse(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.deps.Services.Watermark.SetDefault(r.Context(), def)
+	if err != nil {
+		h.watermarkError(w, err, "Failed to set default watermark")
+		return
+	}
+
+	httputil.JSONResponse(w, updated, http.StatusOK)
+}
+
+// watermarkError maps watermark failures to HTTP responses
+func (h *WatermarkHandler) watermarkError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, model.ErrInvalidWatermark):
+		httputil.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, model.ErrNotFound):
+		httputil.ErrorResponse(w, "Watermark not found", http.StatusNotFound)
+	case errors.Is(err, model.ErrForbidden):
+		httputil.ErrorResponse(w, "You do not have access to this watermark", http.StatusForbidden)
+	case errors.Is(err, model.ErrFileTooLarge):
+		httputil.ErrorResponse(w, "Logo exceeds the maximum size", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, model.ErrFileType):
+		fileTypeError(w, err)
+	case errors.Is(err, model.ErrImageTooLarge):
+		httputil.ErrorResponse(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, model.ErrUnsupportedImage):
+		httputil.ErrorResponse(w, "Image could not be read", http.StatusUnsupportedMediaType)
+	default:
+		h.deps.Logger.Error(message, "error", err)
+		httputil.ErrorResponse(w, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxAlbumFiles bounds the files of an album, so a reorder can always list
+// all of them, and the file IDs accepted by one album request
+const MaxAlbumFiles = 5000
+
+// Album is an ordered collection of a user's files. Only public albums are
+// visible to other users, and only with the files that are public themselves.
+type Album struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	IsPublic    bool      `json:"is_public"`
+	CoverFileID *int64    `json:"cover_file_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// AlbumFiles lists files to add to an album, or all of its files in their
+// new order
+type AlbumFiles struct {
+	FileIDs []int64 `json:"file_ids"`
+}
+
+// Validate validates an album
+func (a *Album) Validate() error {
+	if a.Name == "" || len([]rune(a.Name)) > 255 {
+		return fmt.Errorf("%w: name must be 1 to 255 characters", ErrInvalidAlbum)
+	}
+
+	return nil
+}
+
+// Validate validates a list of album files, which must be non-empty and
+// free of duplicates
+func (f AlbumFiles) Validate() error {
+	if len(f.FileIDs) == 0 || len(f.FileIDs) > MaxAlbumFiles {
+		return fmt.Errorf("%w: file_ids must list 1 to %d files", ErrInvalidAlbum, MaxAlbumFiles)
+	}
+
+	seen := make(map[int64]bool, len(f.FileIDs))
+	for _, id := range f.FileIDs {
+		if seen[id] {
+			return fmt.Errorf("%w: file %d is listed twice", ErrInvalidAlbum, id)
+		}
+		seen[id] = true
+	}
+
+	return nil
+}
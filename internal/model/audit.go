@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Audit actions
+const (
+	AuditUploadOnBehalf         = "upload_on_behalf"
+	AuditUploadOnBehalfRejected = "upload_on_behalf_rejected"
+)
+
+// AuditEntry records a privileged action taken by a user
+type AuditEntry struct {
+	ID            int64     `json:"id"`
+	ActorID       int64     `json:"actor_id"`
+	Action        string    `json:"action"`
+	SubjectUserID int64     `json:"subject_user_id"`
+	ResourceID    int64     `json:"resource_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"io"
+	"time"
+)
 
 type CR2Backup struct {
 	Status    string    `json:"status"`
@@ -11,19 +14,53 @@ type CR2Backup struct {
 }
 
 type CR2UploadRequest struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID             int64  `json:"id"`
+	UserID         int64  `json:"user_id"`
+	IsPublic       bool   `json:"is_public"`
+	OnBehalfOf     int64  `json:"on_behalf_of"`
+	Filename       string `json:"filename"`
+	ContentType    string `json:"content_type"`
+	MetadataPolicy string `json:"metadata_policy"`
+	KeepOriginal   *bool  `json:"keep_original"`
+	Watermarked    bool   `json:"-"`
+	// UploadedBy is the admin uploading on behalf of UserID, 0 otherwise
+	UploadedBy int64     `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 type CR2UploadResponse struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	Filename  string    `json:"filename"`
-	Filesize  int64     `json:"filesize"`
-	MimeType  string    `json:"mime_type"`
-	BucketURL string    `json:"bucket_url"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            int64             `json:"id"`
+	UserID        int64             `json:"user_id"`
+	Filename      string            `json:"filename"`
+	Filesize      int64             `json:"filesize"`
+	MimeType      string            `json:"mime_type"`
+	BucketURL     string            `json:"bucket_url"`
+	Bucket        string            `json:"bucket"`
+	ObjectKey     string            `json:"object_key"`
+	SHA256        string            `json:"sha256,omitempty"`
+	PHash         string            `json:"phash,omitempty"`
+	Placeholder   *Placeholder      `json:"placeholder,omitempty"`
+	Watermarked   bool              `json:"watermarked"`
+	Tags          []string          `json:"tags"`
+	PublicBaseURL string            `json:"public_base_url"`
+	IsPublic      bool              `json:"is_public"`
+	Variants      map[string]string `json:"variants,omitempty"`
+	VariantKeys   map[string]string `json:"-"`
+	OriginalKey   string            `json:"-"`
+	// UploadedBy is the admin who uploaded the file on behalf of UserID,
+	// audited together with the new record
+	UploadedBy int64     `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	ImageInfo
+}
+
+// FileContent is a stored file ready to be streamed to its owner
+type FileContent struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+	Filename    string
 }
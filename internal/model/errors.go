@@ -0,0 +1,88 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when a requested entity does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrForbidden is returned when the caller may not access an entity
+	ErrForbidden = errors.New("forbidden")
+	// ErrFileTooLarge is returned when an upload exceeds the configured size limit
+	ErrFileTooLarge = errors.New("file exceeds maximum upload size")
+	// ErrOffsetMismatch is returned when a resumed upload does not continue at the stored offset
+	ErrOffsetMismatch = errors.New("upload offset does not match")
+	// ErrUploadLocked is returned when another request is writing to a resumable upload
+	ErrUploadLocked = errors.New("upload is being written by another request")
+	// ErrUploadExpired is returned when a resumable upload is past its expiry
+	ErrUploadExpired = errors.New("upload has expired")
+	// ErrUploadIncomplete is returned when finalizing an upload whose object is missing
+	ErrUploadIncomplete = errors.New("object has not been uploaded")
+	// ErrUploadInvalid is returned when an uploaded object does not match what was announced
+	ErrUploadInvalid = errors.New("uploaded object does not match the request")
+	// ErrUnsupportedImage is returned when a file cannot be processed as an image
+	ErrUnsupportedImage = errors.New("file is not a supported image")
+	// ErrImageTooLarge is returned for images whose dimensions, frame count or
+	// decoded size exceed the configured limits
+	ErrImageTooLarge = errors.New("image exceeds the configured limits")
+	// ErrInvalidTransform is returned for malformed image transformation parameters
+	ErrInvalidTransform = errors.New("invalid transformation")
+	// ErrInvalidSignature is returned for missing, forged or expired URL signatures
+	ErrInvalidSignature = errors.New("invalid or expired signature")
+	// ErrInvalidMetadataPolicy is returned for unknown metadata scrubbing policies
+	ErrInvalidMetadataPolicy = errors.New("metadata_policy must be keep, strip_gps or strip_all")
+	// ErrInvalidWatermark is returned for malformed watermark templates
+	ErrInvalidWatermark = errors.New("invalid watermark")
+	// ErrInvalidAlbum is returned for malformed albums and album file lists
+	ErrInvalidAlbum = errors.New("invalid album")
+	// ErrInvalidTags is returned for tag lists that break the tag limits
+	ErrInvalidTags = errors.New("invalid tags")
+	// ErrInvalidListOptions is returned for malformed listing parameters or cursors
+	ErrInvalidListOptions = errors.New("invalid list options")
+	// ErrMetadataNotScrubbable is returned when metadata should be removed
+	// from a file that cannot be scrubbed
+	ErrMetadataNotScrubbable = errors.New("metadata cannot be removed from this file, upload it with metadata_policy keep")
+	// ErrFileType is matched by every FileTypeError
+	ErrFileType = errors.New("file type rejected")
+)
+
+// FileTypeError reports an upload rejected by content sniffing, either
+// because its type is not allowed or because it contradicts the declared one
+type FileTypeError struct {
+	Detected string `json:"detected,omitempty"`
+	Declared string `json:"declared,omitempty"`
+	Err      error  `json:"-"`
+}
+
+func (e *FileTypeError) Error() string {
+	return fmt.Sprintf("file type rejected (detected: %s, declared: %s): %v", e.Detected, e.Declared, e.Err)
+}
+
+func (e *FileTypeError) Is(target error) bool {
+	return target == ErrFileType
+}
+
+func (e *FileTypeError) Unwrap() error {
+	return e.Err
+}
+
+// PartialDeleteError reports a delete that only partly succeeded. The file
+// record is kept until every object is gone, so the delete can be retried.
+type PartialDeleteError struct {
+	FileID      int64    `json:"file_id"`
+	DeletedKeys []string `json:"deleted_keys"`
+	FailedKeys  []string `json:"failed_keys"`
+	Err         error    `json:"-"`
+}
+
+func (e *PartialDeleteError) Error() string {
+	return fmt.Sprintf("partial delete of file %d (failed objects: %s): %v",
+		e.FileID, strings.Join(e.FailedKeys, ", "), e.Err)
+}
+
+func (e *PartialDeleteError) Unwrap() error {
+	return e.Err
+}
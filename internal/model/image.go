@@ -0,0 +1,62 @@
+package model
+
+import (
+	"io"
+	"time"
+)
+
+// VariantPreview names the full-size JPEG extracted from a camera RAW file,
+// used in place of the RAW wherever a displayable image is needed
+const VariantPreview = "preview"
+
+// RenderedImage is an on-the-fly rendering ready to be streamed to a client.
+// Only renderings of public files may be kept by shared caches, watermarked
+// ones change with the watermark and must be revalidated.
+type RenderedImage struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+	ETag        string
+	Public      bool
+	Watermarked bool
+}
+
+// ImageSignature is the signature part of a signed transformation URL,
+// Expires is a unix timestamp or 0 for URLs that never expire
+type ImageSignature struct {
+	Expires int64
+	Value   string
+}
+
+// ImageInfo describes the pixels of an image file. Width and height are
+// the displayed size, with the EXIF orientation applied; zero values mean
+// the file was not decoded.
+type ImageInfo struct {
+	Width       int  `json:"width,omitempty"`
+	Height      int  `json:"height,omitempty"`
+	Orientation int  `json:"orientation,omitempty"`
+	Animated    bool `json:"animated"`
+	DurationMS  int  `json:"duration_ms,omitempty"`
+}
+
+// Placeholder lets clients show something while an image loads
+type Placeholder struct {
+	BlurHash string `json:"blurhash"`
+	// LQIP is a tiny JPEG of the image as a data URI
+	LQIP          string `json:"lqip"`
+	DominantColor string `json:"dominant_color"`
+	AverageColor  string `json:"average_color"`
+}
+
+// SimilarFile is a near-duplicate of an image, Distance is the Hamming
+// distance between their perceptual hashes
+type SimilarFile struct {
+	CR2UploadResponse
+	Distance int `json:"distance"`
+}
+
+// SignedURL is a minted transformation URL
+type SignedURL struct {
+	URL       string     `json:"url"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
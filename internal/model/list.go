@@ -0,0 +1,80 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// File listing sort keys
+const (
+	SortDate = "date"
+	SortSize = "size"
+	SortName = "name"
+)
+
+// File listing sort orders
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// FileListOptions selects a page of a user's files. Cursor continues a
+// previous listing and is only valid with the same sort and order. Zero
+// filters are not applied.
+type FileListOptions struct {
+	Sort   string
+	Order  string
+	Limit  int
+	Cursor string
+	// MimeType matches exactly, or a whole family when it ends in /*,
+	// e.g. image/*
+	MimeType      string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	MinSize       int64
+	MaxSize       int64
+}
+
+// FileList is a page of files, NextCursor is empty on the last page
+type FileList struct {
+	Files      []CR2UploadResponse `json:"files"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// Validate validates listing options, filling in the default sort and
+// order: newest first, names from A to Z
+func (o *FileListOptions) Validate() error {
+	switch o.Sort {
+	case "":
+		o.Sort = SortDate
+	case SortDate, SortSize, SortName:
+	default:
+		return fmt.Errorf("%w: sort must be date, size or name", ErrInvalidListOptions)
+	}
+
+	switch o.Order {
+	case "":
+		o.Order = OrderDesc
+		if o.Sort == SortName {
+			o.Order = OrderAsc
+		}
+	case OrderAsc, OrderDesc:
+	default:
+		return fmt.Errorf("%w: order must be asc or desc", ErrInvalidListOptions)
+	}
+
+	if o.MimeType != "" && !strings.Contains(o.MimeType, "/") {
+		return fmt.Errorf("%w: mime_type must look like image/png or image/*", ErrInvalidListOptions)
+	}
+
+	if !o.CreatedAfter.IsZero() && !o.CreatedBefore.IsZero() && !o.CreatedAfter.Before(o.CreatedBefore) {
+		return fmt.Errorf("%w: created_after must be before created_before", ErrInvalidListOptions)
+	}
+
+	if o.MinSize < 0 || o.MaxSize < 0 || (o.MaxSize > 0 && o.MinSize > o.MaxSize) {
+		return fmt.Errorf("%w: invalid size range", ErrInvalidListOptions)
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// FileMetadata is the camera metadata extracted from a file's EXIF and XMP
+// blocks, unknown values are omitted
+type FileMetadata struct {
+	FileID       int64      `json:"file_id"`
+	CameraMake   string     `json:"camera_make,omitempty"`
+	CameraModel  string     `json:"camera_model,omitempty"`
+	LensModel    string     `json:"lens_model,omitempty"`
+	Software     string     `json:"software,omitempty"`
+	ExposureTime string     `json:"exposure_time,omitempty"`
+	FNumber      *float64   `json:"f_number,omitempty"`
+	FocalLength  *float64   `json:"focal_length,omitempty"`
+	ISO          *int       `json:"iso,omitempty"`
+	CapturedAt   *time.Time `json:"captured_at,omitempty"`
+	GPS          *GPS       `json:"gps,omitempty"`
+	XMP          string     `json:"xmp,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// GPS is a capture position in decimal degrees
+type GPS struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"`
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// PresignRequest asks for a direct-to-bucket upload URL
+type PresignRequest struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Filesize    int64  `json:"filesize"`
+	IsPublic    bool   `json:"is_public"`
+}
+
+// PresignResponse carries the presigned URL and the ticket used to finalize it
+type PresignResponse struct {
+	Ticket    string            `json:"ticket"`
+	UploadURL string            `json:"upload_url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// UploadTicket records a pending direct-to-bucket upload
+type UploadTicket struct {
+	ID        string    `json:"id"`
+	UserID    int64     `json:"user_id"`
+	ObjectKey string    `json:"object_key"`
+	Filename  string    `json:"filename"`
+	MimeType  string    `json:"mime_type"`
+	Filesize  int64     `json:"filesize"`
+	IsPublic  bool      `json:"is_public"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// ClaimedAt is set once the upload was completed, the ticket is kept
+	// until it expires so the purge removes objects PUT after completion
+	ClaimedAt *time.Time `json:"claimed_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Validate validates presign request data
+func (r *PresignRequest) Validate() error {
+	if r.Filename == "" {
+		return errors.New("filename is required")
+	}
+
+	if r.ContentType == "" {
+		return errors.New("content_type is required")
+	}
+
+	if r.Filesize <= 0 {
+		return errors.New("filesize must be positive")
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package model
+
+// Metadata scrubbing policies
+const (
+	MetadataKeep     = "keep"
+	MetadataStripGPS = "strip_gps"
+	MetadataStripAll = "strip_all"
+)
+
+// PrivacySettings controls how uploads are scrubbed before storage. An empty
+// MetadataPolicy falls back to the server default.
+type PrivacySettings struct {
+	MetadataPolicy string `json:"metadata_policy"`
+	KeepOriginal   bool   `json:"keep_original"`
+}
+
+// Validate validates privacy settings
+func (p *PrivacySettings) Validate() error {
+	switch p.MetadataPolicy {
+	case "", MetadataKeep, MetadataStripGPS, MetadataStripAll:
+		return nil
+	default:
+		return ErrInvalidMetadataPolicy
+	}
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tag limits
+const (
+	MaxTags      = 50
+	MaxTagLength = 64
+)
+
+// FileTags replaces the tags of a file
+type FileTags struct {
+	Tags []string `json:"tags"`
+}
+
+// Normalize trims, lower-cases and de-duplicates tags, collapsing inner
+// whitespace and dropping empty ones, then checks them against the limits
+func (t *FileTags) Normalize() error {
+	tags := make([]string, 0, len(t.Tags))
+	seen := make(map[string]bool, len(t.Tags))
+	for _, tag := range t.Tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len([]rune(tag)) > MaxTagLength {
+			return fmt.Errorf("%w: tags must be at most %d characters", ErrInvalidTags, MaxTagLength)
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	if len(tags) > MaxTags {
+		return fmt.Errorf("%w: a file can have at most %d tags", ErrInvalidTags, MaxTags)
+	}
+
+	t.Tags = tags
+	return nil
+}
+
+// SearchOptions selects a page of full-text search results over a user's
+// files. Query uses web search syntax: quoted phrases, OR and -exclusions.
+// Every tag in Tags must be present on a result.
+type SearchOptions struct {
+	Query  string
+	Tags   []string
+	Limit  int
+	Cursor string
+}
+
+// Validate validates search options, a query or a tag is required
+func (o *SearchOptions) Validate() error {
+	o.Query = strings.TrimSpace(o.Query)
+	if o.Query == "" && len(o.Tags) == 0 {
+		return fmt.Errorf("%w: q or tag is required", ErrInvalidListOptions)
+	}
+
+	tags := FileTags{Tags: o.Tags}
+	if err := tags.Normalize(); err != nil {
+		return err
+	}
+	o.Tags = tags.Tags
+
+	return nil
+}
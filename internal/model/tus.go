@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+// TusUpload tracks a resumable upload made through the tus protocol
+type TusUpload struct {
+	ID           string    `json:"id"`
+	UserID       int64     `json:"user_id"`
+	UploadLength int64     `json:"upload_length"`
+	UploadOffset int64     `json:"upload_offset"`
+	Filename     string    `json:"filename"`
+	MimeType     string    `json:"mime_type"`
+	IsPublic     bool      `json:"is_public"`
+	ObjectKey    string    `json:"-"`
+	MultipartID  string    `json:"-"`
+	Parts        []TusPart `json:"-"`
+	// PendingSize is the number of received bytes not yet uploaded as a
+	// part, they are kept in a staging object until a full part is available
+	PendingSize int64     `json:"-"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TusPart is a completed part of the backing multipart upload
+type TusPart struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// TusCreateRequest represents a tus creation request
+type TusCreateRequest struct {
+	UploadLength int64
+	Filename     string
+	MimeType     string
+	IsPublic     bool
+}
+
+// TusPatchResult is the outcome of a tus PATCH request, File is set once
+// the final byte has been received
+type TusPatchResult struct {
+	Upload TusUpload
+	File   *CR2UploadResponse
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Watermark kinds
+const (
+	WatermarkText  = "text"
+	WatermarkImage = "image"
+)
+
+// Watermark positions
+const (
+	PositionTopLeft     = "top_left"
+	PositionTopRight    = "top_right"
+	PositionBottomLeft  = "bottom_left"
+	PositionBottomRight = "bottom_right"
+	PositionCenter      = "center"
+)
+
+// MaxWatermarkText bounds the length of a text watermark
+const MaxWatermarkText = 100
+
+// Watermark is a template drawn over the display variants of a user's
+// uploads. Image watermarks use a PNG logo uploaded separately.
+type Watermark struct {
+	ID       int64   `json:"id"`
+	UserID   int64   `json:"user_id"`
+	Name     string  `json:"name"`
+	Kind     string  `json:"kind"`
+	Text     string  `json:"text,omitempty"`
+	ImageKey string  `json:"-"`
+	HasLogo  bool    `json:"has_logo"`
+	Position string  `json:"position"`
+	Opacity  float64 `json:"opacity"`
+	// Scale is the watermark width as a fraction of the image width
+	Scale     float64   `json:"scale"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WatermarkDefault selects the watermark applied to a user's uploads, nil
+// for none. Watermarks are only chosen per user, albums have none of their
+// own as files are watermarked on upload, before they are in any album.
+type WatermarkDefault struct {
+	WatermarkID *int64 `json:"watermark_id"`
+}
+
+// Validate validates a watermark, filling in the default position,
+// opacity and scale
+func (w *Watermark) Validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidWatermark)
+	}
+
+	switch w.Kind {
+	case WatermarkText:
+		if w.Text == "" || len([]rune(w.Text)) > MaxWatermarkText {
+			return fmt.Errorf("%w: text must be 1 to %d characters", ErrInvalidWatermark, MaxWatermarkText)
+		}
+	case WatermarkImage:
+		w.Text = ""
+	default:
+		return fmt.Errorf("%w: kind must be text or image", ErrInvalidWatermark)
+	}
+
+	switch w.Position {
+	case "":
+		w.Position = PositionBottomRight
+	case PositionTopLeft, PositionTopRight, PositionBottomLeft, PositionBottomRight, PositionCenter:
+	default:
+		return fmt.Errorf("%w: unknown position %q", ErrInvalidWatermark, w.Position)
+	}
+
+	if w.Opacity == 0 {
+		w.Opacity = 0.5
+	}
+	if w.Opacity < 0 || w.Opacity > 1 {
+		return fmt.Errorf("%w: opacity must be between 0 and 1", ErrInvalidWatermark)
+	}
+
+	if w.Scale == 0 {
+		w.Scale = 0.2
+	}
+	if w.Scale < 0 || w.Scale > 1 {
+		return fmt.Errorf("%w: scale must be between 0 and 1", ErrInvalidWatermark)
+	}
+
+	return nil
+}
@@ -0,0 +1,393 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/database"
+	"github.com/lib/pq"
+)
+
+// AlbumRepository defines the album repository interface
+type AlbumRepository interface {
+	Create(ctx context.Context, album model.Album) (model.Album, error)
+	GetByID(ctx context.Context, id int64) (model.Album, error)
+	GetByUserID(ctx context.Context, userID int64, publicOnly bool) ([]model.Album, error)
+	Update(ctx context.Context, album model.Album) (model.Album, error)
+	Delete(ctx context.Context, id int64) error
+	HasFile(ctx context.Context, albumID, fileID int64) (bool, error)
+	AddFiles(ctx context.Context, album model.Album, fileIDs []int64) error
+	RemoveFile(ctx context.Context, albumID, fileID int64) error
+	Reorder(ctx context.Context, albumID int64, fileIDs []int64) error
+	ListFiles(ctx context.Context, albumID int64, publicOnly bool, limit int, cursor string) (model.FileList, error)
+}
+
+// albumRepository implements AlbumRepository
+type albumRepository struct {
+	db *database.Database
+}
+
+// NewAlbumRepository creates a new AlbumRepository
+func NewAlbumRepository(db *database.Database) AlbumRepository {
+	return &albumRepository{
+		db: db,
+	}
+}
+
+const albumColumns = `id, user_id, name, description, is_public, cover_file_id, created_at, updated_at`
+
+func scanAlbum(row rowScanner) (model.Album, error) {
+	var album model.Album
+	var cover sql.NullInt64
+	err := row.Scan(
+		&album.ID,
+		&album.UserID,
+		&album.Name,
+		&album.Description,
+		&album.IsPublic,
+		&cover,
+		&album.CreatedAt,
+		&album.UpdatedAt,
+	)
+	if cover.Valid {
+		album.CoverFileID = &cover.Int64
+	}
+	return album, err
+}
+
+// Create creates a new, empty album
+func (r *albumRepository) Create(ctx context.Context, album model.Album) (model.Album, error) {
+	query := `
+		INSERT INTO albums (user_id, name, description, is_public, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING ` + albumColumns
+
+	created, err := scanAlbum(r.db.QueryRowContext(ctx, query, album.UserID, album.Name, album.Description, album.IsPublic))
+	if err != nil {
+		return model.Album{}, fmt.Errorf("failed to create album: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetByID gets an album by ID
+func (r *albumRepository) GetByID(ctx context.Context, id int64) (model.Album, error) {
+	query := `
+		SELECT ` + albumColumns + `
+		FROM albums
+		WHERE id = $1
+	`
+
+	album, err := scanAlbum(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Album{}, fmt.Errorf("album %d: %w", id, model.ErrNotFound)
+		}
+		return model.Album{}, fmt.Errorf("failed to get album: %w", err)
+	}
+
+	return album, nil
+}
+
+// GetByUserID lists the albums of a user, newest first
+func (r *albumRepository) GetByUserID(ctx context.Context, userID int64, publicOnly bool) ([]model.Album, error) {
+	query := `
+		SELECT ` + albumColumns + `
+		FROM albums
+		WHERE user_id = $1 AND (is_public OR NOT $2)
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, publicOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query albums: %w", err)
+	}
+	defer rows.Close()
+
+	albums := []model.Album{}
+	for rows.Next() {
+		album, err := scanAlbum(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan album: %w", err)
+		}
+		albums = append(albums, album)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating album rows: %w", err)
+	}
+
+	return albums, nil
+}
+
+// Update updates the name, description, visibility and cover of an album
+func (r *albumRepository) Update(ctx context.Context, album model.Album) (model.Album, error) {
+	query := `
+		UPDATE albums
+		SET name = $1, description = $2, is_public = $3, cover_file_id = $4, updated_at = NOW()
+		WHERE id = $5
+		RETURNING ` + albumColumns
+
+	updated, err := scanAlbum(r.db.QueryRowContext(
+		ctx,
+		query,
+		album.Name,
+		album.Description,
+		album.IsPublic,
+		album.CoverFileID,
+		album.ID,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Album{}, fmt.Errorf("album %d: %w", album.ID, model.ErrNotFound)
+		}
+		return model.Album{}, fmt.Errorf("failed to update album: %w", err)
+	}
+
+	return updated, nil
+}
+
+// Delete deletes an album, its files are kept
+func (r *albumRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM albums WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete album: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("album %d: %w", id, model.ErrNotFound)
+	}
+
+	return nil
+}
+
+// HasFile reports whether a file is in an album
+func (r *albumRepository) HasFile(ctx context.Context, albumID, fileID int64) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM album_files WHERE album_id = $1 AND file_id = $2)",
+		albumID, fileID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check album file: %w", err)
+	}
+
+	return exists, nil
+}
+
+// AddFiles appends files of the album's owner to the end of the album in
+// the given order, skipping those already in it. The album row is locked
+// so concurrent additions get distinct positions and cannot together grow
+// the album past MaxAlbumFiles.
+func (r *albumRepository) AddFiles(ctx context.Context, album model.Album, fileIDs []int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE albums SET updated_at = NOW() WHERE id = $1", album.ID)
+	if err != nil {
+		return fmt.Errorf("failed to lock album: %w", err)
+	}
+
+	var owned int
+	err = tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM files WHERE id = ANY($1) AND user_id = $2",
+		pq.Array(fileIDs), album.UserID,
+	).Scan(&owned)
+	if err != nil {
+		return fmt.Errorf("failed to check album files: %w", err)
+	}
+	if owned != len(fileIDs) {
+		return fmt.Errorf("%w: albums can only hold their owner's files", model.ErrInvalidAlbum)
+	}
+
+	query := `
+		INSERT INTO album_files (album_id, file_id, position, added_at)
+		SELECT $1::int, t.file_id,
+			(SELECT COALESCE(MAX(position), -1) FROM album_files WHERE album_id = $1::int) + t.ord,
+			NOW()
+		FROM unnest($2::int[]) WITH ORDINALITY AS t(file_id, ord)
+		ON CONFLICT (album_id, file_id) DO NOTHING
+	`
+
+	if _, err := tx.ExecContext(ctx, query, album.ID, pq.Array(fileIDs)); err != nil {
+		return fmt.Errorf("failed to add album files: %w", err)
+	}
+
+	// Counted under the album lock, files already in the album included
+	var total int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM album_files WHERE album_id = $1", album.ID).Scan(&total)
+	if err != nil {
+		return fmt.Errorf("failed to count album files: %w", err)
+	}
+	if total > model.MaxAlbumFiles {
+		return fmt.Errorf("%w: albums can hold at most %d files", model.ErrInvalidAlbum, model.MaxAlbumFiles)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveFile removes a file from an album, clearing the cover when it was
+// that file
+func (r *albumRepository) RemoveFile(ctx context.Context, albumID, fileID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM album_files WHERE album_id = $1 AND file_id = $2", albumID, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to remove album file: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("file %d in album %d: %w", fileID, albumID, model.ErrNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE albums
+		SET cover_file_id = CASE WHEN cover_file_id = $2 THEN NULL ELSE cover_file_id END, updated_at = NOW()
+		WHERE id = $1
+	`, albumID, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to update album: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Reorder sets the order of an album's files, fileIDs must list every file
+// of the album exactly once
+func (r *albumRepository) Reorder(ctx context.Context, albumID int64, fileIDs []int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE albums SET updated_at = NOW() WHERE id = $1", albumID)
+	if err != nil {
+		return fmt.Errorf("failed to lock album: %w", err)
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM album_files WHERE album_id = $1", albumID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to count album files: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE album_files
+		SET position = t.ord - 1
+		FROM unnest($2::int[]) WITH ORDINALITY AS t(file_id, ord)
+		WHERE album_files.album_id = $1 AND album_files.file_id = t.file_id
+	`, albumID, pq.Array(fileIDs))
+	if err != nil {
+		return fmt.Errorf("failed to reorder album files: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if int(rowsAffected) != count || count != len(fileIDs) {
+		return fmt.Errorf("%w: file_ids must list every file of the album exactly once", model.ErrInvalidAlbum)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// albumCursor is the position after the last file of a page of an album
+type albumCursor struct {
+	Position int   `json:"p"`
+	FileID   int64 `json:"id"`
+}
+
+// ListFiles returns a page of an album's files in their manual order,
+// publicOnly leaves out private files
+func (r *albumRepository) ListFiles(ctx context.Context, albumID int64, publicOnly bool, limit int, cursor string) (model.FileList, error) {
+	after := albumCursor{Position: -1}
+	if cursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err == nil {
+			err = json.Unmarshal(data, &after)
+		}
+		if err != nil {
+			return model.FileList{}, fmt.Errorf("%w: malformed cursor", model.ErrInvalidListOptions)
+		}
+	}
+
+	// One extra row tells whether there is a next page
+	query := `
+		SELECT ` + fileColumns + `, album_files.position
+		FROM album_files
+		JOIN files ON files.id = album_files.file_id
+		WHERE album_files.album_id = $1
+			AND (files.is_public OR NOT $2)
+			AND (album_files.position, album_files.file_id) > ($3, $4)
+		ORDER BY album_files.position, album_files.file_id
+		LIMIT $5
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, albumID, publicOnly, after.Position, after.FileID, limit+1)
+	if err != nil {
+		return model.FileList{}, fmt.Errorf("failed to query album files: %w", err)
+	}
+	defer rows.Close()
+
+	list := model.FileList{Files: []model.CR2UploadResponse{}}
+	var positions []int
+	for rows.Next() {
+		var position int
+		file, err := scanFile(withColumns(rows, &position))
+		if err != nil {
+			return model.FileList{}, fmt.Errorf("failed to scan file: %w", err)
+		}
+		list.Files = append(list.Files, file)
+		positions = append(positions, position)
+	}
+
+	if err := rows.Err(); err != nil {
+		return model.FileList{}, fmt.Errorf("error iterating album file rows: %w", err)
+	}
+
+	if len(list.Files) > limit {
+		list.Files = list.Files[:limit]
+		last := albumCursor{Position: positions[limit-1], FileID: list.Files[limit-1].ID}
+		data, _ := json.Marshal(last)
+		list.NextCursor = base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/database"
+)
+
+// AuditRepository defines the audit log repository interface
+type AuditRepository interface {
+	Record(ctx context.Context, entry model.AuditEntry) error
+}
+
+// auditRepository implements AuditRepository
+type auditRepository struct {
+	db *database.Database
+}
+
+// NewAuditRepository creates a new AuditRepository
+func NewAuditRepository(db *database.Database) AuditRepository {
+	return &auditRepository{
+		db: db,
+	}
+}
+
+// Record appends an entry to the audit log
+func (r *auditRepository) Record(ctx context.Context, entry model.AuditEntry) error {
+	return insertAudit(ctx, r.db, entry)
+}
+
+// execer runs a statement on the database or inside a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertAudit appends an entry to the audit log, a zero resource ID is
+// stored as NULL
+func insertAudit(ctx context.Context, db execer, entry model.AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (actor_id, action, subject_user_id, resource_id, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+	`
+
+	resourceID := sql.NullInt64{Int64: entry.ResourceID, Valid: entry.ResourceID != 0}
+	_, err := db.ExecContext(ctx, query, entry.ActorID, entry.Action, entry.SubjectUserID, resourceID)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/filetype"
+	"github.com/adorufus/imgupper/pkg/storage"
+)
+
+// blobObjectKey is the content-addressed key of a blob, fanned out by the
+// first byte of the hash to keep listings short
+func blobObjectKey(sum, mimeType string) string {
+	return "blobs/" + sum[:2] + "/" + sum + filetype.Extension(mimeType)
+}
+
+// hashingReader computes the SHA-256 and size of what is read through it
+type hashingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	n    int64
+}
+
+func newHashingReader(r io.Reader) *hashingReader {
+	return &hashingReader{r: r, hash: sha256.New()}
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	h.n += int64(n)
+	return n, err
+}
+
+// Sum returns the hex encoded SHA-256 of everything read so far
+func (h *hashingReader) Sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
+
+// hashObject reads a stored object to compute its SHA-256
+func (r *cr2Repository) hashObject(ctx context.Context, key string) (string, error) {
+	object, _, err := r.store.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	hashing := newHashingReader(object)
+	if _, err := io.Copy(io.Discard, hashing); err != nil {
+		return "", fmt.Errorf("failed to hash object %s: %w", key, err)
+	}
+
+	return hashing.Sum(), nil
+}
+
+// stageBlob copies the object of file to its content-addressed key when no
+// blob holds that content yet, before acquireBlob locks the blob row, so
+// concurrent uploads of the same content do not wait on the copy. It
+// reports whether it copied; a staged copy is never removed on failure, as
+// an upload racing this one may already reference it.
+func (r *cr2Repository) stageBlob(ctx context.Context, file model.CR2UploadResponse) (bool, error) {
+	key := blobObjectKey(file.SHA256, file.MimeType)
+	if key == file.ObjectKey {
+		return false, nil
+	}
+
+	var exists bool
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM blobs WHERE sha256 = $1)", file.SHA256).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up blob: %w", err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	err = r.store.Copy(ctx, file.ObjectKey, key, storage.PutOptions{
+		ContentType: file.MimeType,
+		Public:      !file.Watermarked,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// acquireBlob takes a reference on the blob holding the content of file,
+// whose object is at file.ObjectKey, and returns the blob's object key and
+// whether this reference created the blob. staged tells whether stageBlob
+// already copied the object; the copy is only repeated here, under the
+// row lock, when the blob was released and its object deleted in between.
+// Watermarked files keep a new blob private, it is published by the
+// first reference of a file without a watermark.
+func (r *cr2Repository) acquireBlob(ctx context.Context, tx *sql.Tx, file model.CR2UploadResponse, staged bool) (string, bool, error) {
+	query := `
+		INSERT INTO blobs (sha256, object_key, size, mime_type, ref_count, is_public, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, 1, $5, NOW(), NOW())
+		ON CONFLICT (sha256) DO UPDATE
+		SET ref_count = blobs.ref_count + 1, updated_at = NOW()
+		RETURNING object_key, ref_count, is_public
+	`
+
+	public := !file.Watermarked
+
+	var key string
+	var refs int
+	var published bool
+	err := tx.QueryRowContext(ctx, query, file.SHA256, blobObjectKey(file.SHA256, file.MimeType), file.Filesize, file.MimeType, public).Scan(&key, &refs, &published)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to reference blob: %w", err)
+	}
+
+	if refs > 1 || key == file.ObjectKey {
+		switch {
+		case public && !published:
+			if err := r.publishBlob(ctx, tx, file.SHA256, key, file.MimeType); err != nil {
+				return "", false, err
+			}
+		case staged && published && !public:
+			// The private staged copy replaced the published object
+			err := r.store.Copy(ctx, key, key, storage.PutOptions{
+				ContentType: file.MimeType,
+				Public:      true,
+			})
+			if err != nil {
+				return "", false, err
+			}
+		}
+		return key, false, nil
+	}
+
+	if staged {
+		_, err := r.store.Head(ctx, key)
+		if err == nil {
+			return key, true, nil
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return "", false, err
+		}
+	}
+
+	err = r.store.Copy(ctx, file.ObjectKey, key, storage.PutOptions{
+		ContentType: file.MimeType,
+		Public:      public,
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	return key, true, nil
+}
+
+// publishBlob makes the object of a private blob publicly readable by
+// copying it onto itself
+func (r *cr2Repository) publishBlob(ctx context.Context, tx *sql.Tx, sum, key, mimeType string) error {
+	if _, err := tx.ExecContext(ctx, "UPDATE blobs SET is_public = TRUE WHERE sha256 = $1", sum); err != nil {
+		return fmt.Errorf("failed to publish blob: %w", err)
+	}
+
+	return r.store.Copy(ctx, key, key, storage.PutOptions{
+		ContentType: mimeType,
+		Public:      true,
+	})
+}
+
+// derivedColumns are the files columns computed from the content alone,
+// shared by every file of a blob
+const derivedColumns = `phash, blurhash, lqip, dominant_color, average_color, width, height, orientation, animated, duration_ms`
+
+// inheritDerived copies the derived columns of the oldest other file of
+// the same blob onto file, so a duplicate upload needs no processing.
+// Variants are only shared when they carry no watermark, and never with a
+// watermarked file.
+func (r *cr2Repository) inheritDerived(ctx context.Context, tx *sql.Tx, file model.CR2UploadResponse) (model.CR2UploadResponse, error) {
+	query := `
+		UPDATE files
+		SET (` + derivedColumns + `) = (
+			SELECT ` + derivedColumns + `
+			FROM files
+			WHERE blob_sha256 = $1 AND id <> $2
+			ORDER BY id
+			LIMIT 1
+		),
+		variants = CASE WHEN watermarked THEN variants ELSE COALESCE((
+			SELECT variants
+			FROM files
+			WHERE blob_sha256 = $1 AND id <> $2 AND NOT watermarked
+			ORDER BY id
+			LIMIT 1
+		), '{}') END
+		WHERE id = $2 AND EXISTS (SELECT 1 FROM files WHERE blob_sha256 = $1 AND id <> $2)
+		RETURNING ` + fileColumns
+
+	inherited, err := scanFile(tx.QueryRowContext(ctx, query, file.SHA256, file.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		// No other file of the blob is left to copy from
+		return file, nil
+	}
+	if err != nil {
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to share derived data: %w", err)
+	}
+
+	return inherited, nil
+}
+
+// releaseBlob drops a reference on a blob and returns how many remain. The
+// row is deleted with the last reference, the caller removes its objects.
+func (r *cr2Repository) releaseBlob(ctx context.Context, tx *sql.Tx, sum string) (int, error) {
+	query := `
+		UPDATE blobs
+		SET ref_count = ref_count - 1, updated_at = NOW()
+		WHERE sha256 = $1
+		RETURNING ref_count
+	`
+
+	var refs int
+	if err := tx.QueryRowContext(ctx, query, sum).Scan(&refs); err != nil {
+		return 0, fmt.Errorf("failed to release blob: %w", err)
+	}
+
+	if refs > 0 {
+		return refs, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM blobs WHERE sha256 = $1", sum); err != nil {
+		return 0, fmt.Errorf("failed to delete blob: %w", err)
+	}
+
+	return 0, nil
+}
@@ -3,48 +3,140 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"mime/multipart"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/adorufus/imgupper/config"
 	"github.com/adorufus/imgupper/internal/model"
 	"github.com/adorufus/imgupper/pkg/database"
-	"github.com/adorufus/imgupper/pkg/middleware"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/adorufus/imgupper/pkg/exif"
+	"github.com/adorufus/imgupper/pkg/filetype"
+	"github.com/adorufus/imgupper/pkg/storage"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // Cr2Repository defines the file repository interface
 type Cr2Repository interface {
-	Create(ctx context.Context, file model.CR2UploadRequest, object multipart.File, handler *multipart.FileHeader) (model.CR2UploadResponse, error)
+	Create(ctx context.Context, file model.CR2UploadRequest, body io.Reader, privacy model.PrivacySettings) (model.CR2UploadResponse, error)
+	CreateRecord(ctx context.Context, file model.CR2UploadResponse) (model.CR2UploadResponse, error)
+	SetVariants(ctx context.Context, id int64, keys map[string]string, watermarked bool) (model.CR2UploadResponse, error)
+	SetMimeType(ctx context.Context, id int64, mimeType string) (model.CR2UploadResponse, error)
+	SetPHash(ctx context.Context, id int64, hash uint64) (model.CR2UploadResponse, error)
+	SetPlaceholder(ctx context.Context, id int64, placeholder model.Placeholder) (model.CR2UploadResponse, error)
+	SetImageInfo(ctx context.Context, id int64, info model.ImageInfo) (model.CR2UploadResponse, error)
+	FindSimilar(ctx context.Context, userID int64, hash uint64, maxDistance, limit int) ([]model.SimilarFile, error)
+	SetTags(ctx context.Context, id int64, tags []string) (model.CR2UploadResponse, error)
+	Search(ctx context.Context, userID int64, opts model.SearchOptions) (model.FileList, error)
+	NewObjectKey(userID int64, mimeType string) string
 	GetByID(ctx context.Context, id int64) (model.CR2UploadResponse, error)
-	GetByUserID(ctx context.Context) ([]model.CR2UploadResponse, error)
+	List(ctx context.Context, userID int64, opts model.FileListOptions) (model.FileList, error)
 	// GetAll(ctx context.Context) ([]model.File, error)
 	// Update(ctx context.Context, file model.File) (model.File, error)
-	// Delete(ctx context.Context, id int64) error
+	Delete(ctx context.Context, file model.CR2UploadResponse) error
 }
 
 // cr2Repository implements FileRepository
 type cr2Repository struct {
-	db       *database.Database
-	s3Client *s3.Client
+	db    *database.Database
+	store storage.Backend
+	cfg   config.StorageConfig
 }
 
 // NewFileRepository creates a new FileRepository
-func NewCr2Repository(db *database.Database, s3Client *s3.Client) Cr2Repository {
+func NewCr2Repository(db *database.Database, store storage.Backend, cfg config.StorageConfig) Cr2Repository {
 	return &cr2Repository{
-		db:       db,
-		s3Client: s3Client,
+		db:    db,
+		store: store,
+		cfg:   cfg,
 	}
 }
 
-// Create creates a new file record
-func (r *cr2Repository) Create(ctx context.Context, file model.CR2UploadRequest, object multipart.File, handler *multipart.FileHeader) (model.CR2UploadResponse, error) {
+// fileColumns lists the files columns in the order scanFile expects them
+const fileColumns = `id, user_id, filename, filesize, mime_type, bucket_url, bucket, object_key, public_base_url, is_public, variants, original_key, blob_sha256, phash, blurhash, lqip, dominant_color, average_color, width, height, orientation, animated, duration_ms, watermarked, tags, created_at, updated_at`
 
-	print("user id", file.UserID)
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFile(row rowScanner) (model.CR2UploadResponse, error) {
+	var file model.CR2UploadResponse
+	var variants []byte
+	var sum sql.NullString
+	var phash sql.NullInt64
+	var placeholder model.Placeholder
+	err := row.Scan(
+		&file.ID,
+		&file.UserID,
+		&file.Filename,
+		&file.Filesize,
+		&file.MimeType,
+		&file.BucketURL,
+		&file.Bucket,
+		&file.ObjectKey,
+		&file.PublicBaseURL,
+		&file.IsPublic,
+		&variants,
+		&file.OriginalKey,
+		&sum,
+		&phash,
+		&placeholder.BlurHash,
+		&placeholder.LQIP,
+		&placeholder.DominantColor,
+		&placeholder.AverageColor,
+		&file.Width,
+		&file.Height,
+		&file.Orientation,
+		&file.Animated,
+		&file.DurationMS,
+		&file.Watermarked,
+		pq.Array(&file.Tags),
+		&file.CreatedAt,
+		&file.UpdatedAt,
+	)
+	if err != nil {
+		return file, err
+	}
+	file.SHA256 = sum.String
+	if phash.Valid {
+		file.PHash = formatPHash(uint64(phash.Int64))
+	}
+	if placeholder.BlurHash != "" {
+		file.Placeholder = &placeholder
+	}
+	if file.Tags == nil {
+		file.Tags = []string{}
+	}
+
+	if err := json.Unmarshal(variants, &file.VariantKeys); err != nil {
+		return file, fmt.Errorf("failed to decode variants: %w", err)
+	}
+
+	if len(file.VariantKeys) > 0 {
+		file.Variants = make(map[string]string, len(file.VariantKeys))
+		for name, key := range file.VariantKeys {
+			file.Variants[name] = joinURL(file.PublicBaseURL, key)
+		}
+	}
+
+	return file, nil
+}
+
+// Create streams body into storage and creates a new file record. JPEG and
+// PNG metadata is scrubbed on the way according to privacy; when the
+// original is kept it is stored privately first and scrubbed from there.
+// The stored content is hashed as it streams so CreateRecord can
+// deduplicate it without reading it back.
+func (r *cr2Repository) Create(ctx context.Context, file model.CR2UploadRequest, body io.Reader, privacy model.PrivacySettings) (model.CR2UploadResponse, error) {
 	// First, check if user exists
 	var userExists bool
 	err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", file.UserID).Scan(&userExists)
@@ -56,150 +148,371 @@ func (r *cr2Repository) Create(ctx context.Context, file model.CR2UploadRequest,
 		return model.CR2UploadResponse{}, errors.New("User Not Found")
 	}
 
-	uid := file.UserID
-
 	// Generate unique filename
-	filename := fmt.Sprintf("u/%v/uploads/%s-%d%s",
-		uid,
-		uuid.New().String(),
-		time.Now().Unix(),
-		getFileExtension(handler.Filename),
-	)
+	filename := r.NewObjectKey(file.UserID, file.ContentType)
+
+	var originalKey string
+	if privacy.MetadataPolicy != model.MetadataKeep && exif.CanScrub(file.ContentType) {
+		if privacy.KeepOriginal {
+			originalKey = OriginalObjectKey(filename)
+			err = r.store.Put(ctx, originalKey, body, storage.PutOptions{
+				ContentType:   file.ContentType,
+				ContentLength: -1,
+			})
+			if err != nil {
+				return model.CR2UploadResponse{}, err
+			}
+
+			original, _, err := r.store.Get(ctx, originalKey)
+			if err != nil {
+				return model.CR2UploadResponse{}, err
+			}
+			defer original.Close()
+			body = original
+		}
 
-	client := r.s3Client
-	_, err = client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String("ember-imgupper"),
-		Key:         aws.String(filename),
-		Body:        object,
-		ContentType: aws.String(handler.Header.Get("Content-Type")),
-		ACL:         "public-read",
+		scrubbed := exif.NewScrubReader(body, exif.Policy(privacy.MetadataPolicy))
+		defer scrubbed.Close()
+		body = scrubbed
+	}
+
+	hashing := newHashingReader(body)
+	// Only a staging copy, CreateRecord publishes the content with its blob
+	err = r.store.Put(ctx, filename, hashing, storage.PutOptions{
+		ContentType:   file.ContentType,
+		ContentLength: -1,
 	})
+	if err != nil {
+		if originalKey != "" {
+			err = errors.Join(err, r.store.Delete(ctx, originalKey))
+		}
+		return model.CR2UploadResponse{}, err
+	}
+
+	return r.CreateRecord(ctx, model.CR2UploadResponse{
+		UserID:      file.UserID,
+		Filename:    file.Filename,
+		Filesize:    hashing.n,
+		MimeType:    file.ContentType,
+		ObjectKey:   filename,
+		SHA256:      hashing.Sum(),
+		OriginalKey: originalKey,
+		IsPublic:    file.IsPublic,
+		Watermarked: file.Watermarked,
+		UploadedBy:  file.UploadedBy,
+	})
+}
+
+// CreateRecord inserts the files row for an object already in storage,
+// filling in the configured bucket and public URL. The object is moved to
+// the blob of its content, hashing it first when file.SHA256 is empty; a
+// file whose content is already stored shares the existing blob and the
+// variants and everything else computed from its pixels. A file marked
+// watermarked keeps its blob private and gets no shared variants. Uploads
+// on behalf of another user are audited in the same transaction.
+func (r *cr2Repository) CreateRecord(ctx context.Context, file model.CR2UploadResponse) (model.CR2UploadResponse, error) {
+	if file.SHA256 == "" {
+		sum, err := r.hashObject(ctx, file.ObjectKey)
+		if err != nil {
+			return model.CR2UploadResponse{}, err
+		}
+		file.SHA256 = sum
+	}
 
-	fmt.Print("hit this")
+	staged, err := r.stageBlob(ctx, file)
+	if err != nil {
+		return model.CR2UploadResponse{}, err
+	}
 
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	blobKey, created, err := r.acquireBlob(ctx, tx, file, staged)
 	if err != nil {
 		return model.CR2UploadResponse{}, err
 	}
 
-	bucketUrl := "https://cdn.imgupper.web.id/" + filename
+	// Drops the fresh blob object when the record cannot be created
+	fail := func(err error) (model.CR2UploadResponse, error) {
+		if created {
+			err = errors.Join(err, r.store.Delete(ctx, blobKey))
+		}
+		return model.CR2UploadResponse{}, err
+	}
 
 	query := `
-		INSERT INTO files (user_id, filename, filesize, mime_type, bucket_url, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
-		RETURNING id, user_id, filename, filesize, mime_type, bucket_url, created_at, updated_at
-	`
-
-	var createdFile model.CR2UploadResponse
+		INSERT INTO files (user_id, filename, filesize, mime_type, bucket_url, bucket, object_key, public_base_url, is_public, original_key, blob_sha256, watermarked, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW(), NOW())
+		RETURNING ` + fileColumns
 
-	err = r.db.QueryRowContext(
+	createdFile, err := scanFile(tx.QueryRowContext(
 		ctx,
 		query,
 		file.UserID,
-		handler.Filename,
-		handler.Size,
-		handler.Header.Get("Content-Type"),
-		bucketUrl,
-	).Scan(
-		&createdFile.ID,
-		&createdFile.UserID,
-		&createdFile.Filename,
-		&createdFile.Filesize,
-		&createdFile.MimeType,
-		&createdFile.BucketURL,
-		&createdFile.CreatedAt,
-		&createdFile.UpdatedAt,
-	)
+		file.Filename,
+		file.Filesize,
+		file.MimeType,
+		r.publicURL(blobKey),
+		r.cfg.Bucket,
+		blobKey,
+		r.cfg.PublicBaseURL,
+		file.IsPublic,
+		file.OriginalKey,
+		file.SHA256,
+		file.Watermarked,
+	))
 
 	if err != nil {
-		return model.CR2UploadResponse{}, fmt.Errorf("failed to create file record: %w", err)
+		return fail(fmt.Errorf("failed to create file record: %w", err))
+	}
+
+	if !created {
+		createdFile, err = r.inheritDerived(ctx, tx, createdFile)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	if err := refreshSearchVector(ctx, tx, createdFile.ID); err != nil {
+		return fail(err)
+	}
+
+	if file.UploadedBy != 0 {
+		err := insertAudit(ctx, tx, model.AuditEntry{
+			ActorID:       file.UploadedBy,
+			Action:        model.AuditUploadOnBehalf,
+			SubjectUserID: file.UserID,
+			ResourceID:    createdFile.ID,
+		})
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(fmt.Errorf("failed to commit file record: %w", err))
+	}
+
+	// The upload itself is only a staging copy once the blob holds it. It
+	// is private, so failing to delete it leaves the record intact and
+	// only costs the storage.
+	if file.ObjectKey != blobKey {
+		r.store.Delete(ctx, file.ObjectKey)
 	}
 
 	return createdFile, nil
 }
 
-func getFileExtension(filename string) string {
-	parts := strings.Split(filename, ".")
-	if len(parts) > 1 {
-		return "." + parts[len(parts)-1]
+// NewObjectKey renders the configured key template for a new upload, the
+// extension comes from the MIME type and never from the client filename
+func (r *cr2Repository) NewObjectKey(userID int64, mimeType string) string {
+	now := time.Now()
+	replacer := strings.NewReplacer(
+		"{user_id}", strconv.FormatInt(userID, 10),
+		"{uuid}", uuid.New().String(),
+		"{unix}", strconv.FormatInt(now.Unix(), 10),
+		"{date}", now.UTC().Format("2006/01/02"),
+		"{ext}", filetype.Extension(mimeType),
+	)
+	return strings.TrimPrefix(replacer.Replace(r.cfg.KeyTemplate), "/")
+}
+
+// OriginalObjectKey is where the unscrubbed original of an upload is kept,
+// always privately
+func OriginalObjectKey(key string) string {
+	ext := path.Ext(key)
+	return strings.TrimSuffix(key, ext) + "_original" + ext
+}
+
+// publicURL joins the configured public base URL and an object key
+func (r *cr2Repository) publicURL(key string) string {
+	return joinURL(r.cfg.PublicBaseURL, key)
+}
+
+func joinURL(base, key string) string {
+	return strings.TrimSuffix(base, "/") + "/" + key
+}
+
+// SetVariants records the object keys of a file's resized variants and
+// whether they carry a watermark, which makes them the file's own
+func (r *cr2Repository) SetVariants(ctx context.Context, id int64, keys map[string]string, watermarked bool) (model.CR2UploadResponse, error) {
+	variants, err := json.Marshal(keys)
+	if err != nil {
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to encode variants: %w", err)
 	}
-	return ""
+
+	query := `
+		UPDATE files
+		SET variants = $1, watermarked = $2, updated_at = NOW()
+		WHERE id = $3
+		RETURNING ` + fileColumns
+
+	file, err := scanFile(r.db.QueryRowContext(ctx, query, variants, watermarked, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.CR2UploadResponse{}, fmt.Errorf("file %d: %w", id, model.ErrNotFound)
+		}
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to update variants: %w", err)
+	}
+
+	return file, nil
 }
 
-// GetByID gets a file by ID
-func (r *cr2Repository) GetByID(ctx context.Context, id int64) (model.CR2UploadResponse, error) {
+// SetMimeType corrects the MIME type of a file once its content is known
+func (r *cr2Repository) SetMimeType(ctx context.Context, id int64, mimeType string) (model.CR2UploadResponse, error) {
 	query := `
-		SELECT id, user_id, filename, filesize, mime_type, bucket_url, created_at, updated_at
-		FROM files
-		WHERE id = $1
-	`
+		UPDATE files
+		SET mime_type = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING ` + fileColumns
 
-	var file model.CR2UploadResponse
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&file.ID,
-		&file.UserID,
-		&file.Filename,
-		&file.Filesize,
-		&file.MimeType,
-		&file.BucketURL,
-		&file.CreatedAt,
-		&file.UpdatedAt,
-	)
+	file, err := scanFile(r.db.QueryRowContext(ctx, query, mimeType, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.CR2UploadResponse{}, fmt.Errorf("file %d: %w", id, model.ErrNotFound)
+		}
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to update mime type: %w", err)
+	}
 
+	return file, nil
+}
+
+// SetImageInfo records the dimensions, orientation and animation of a file
+func (r *cr2Repository) SetImageInfo(ctx context.Context, id int64, info model.ImageInfo) (model.CR2UploadResponse, error) {
+	query := `
+		UPDATE files
+		SET width = $1, height = $2, orientation = $3, animated = $4, duration_ms = $5, updated_at = NOW()
+		WHERE id = $6
+		RETURNING ` + fileColumns
+
+	file, err := scanFile(r.db.QueryRowContext(ctx, query, info.Width, info.Height, info.Orientation, info.Animated, info.DurationMS, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return model.CR2UploadResponse{}, fmt.Errorf("file not found: %w", err)
+			return model.CR2UploadResponse{}, fmt.Errorf("file %d: %w", id, model.ErrNotFound)
 		}
-		return model.CR2UploadResponse{}, fmt.Errorf("failed to get file: %w", err)
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to update image info: %w", err)
 	}
 
 	return file, nil
 }
 
-// // GetByUserID gets all files for a specific user
-func (r *cr2Repository) GetByUserID(ctx context.Context) ([]model.CR2UploadResponse, error) {
-	user, err := middleware.GetUserFromContext(ctx)
+// SetPlaceholder records the placeholders clients show while an image loads
+func (r *cr2Repository) SetPlaceholder(ctx context.Context, id int64, placeholder model.Placeholder) (model.CR2UploadResponse, error) {
+	query := `
+		UPDATE files
+		SET blurhash = $1, lqip = $2, dominant_color = $3, average_color = $4, updated_at = NOW()
+		WHERE id = $5
+		RETURNING ` + fileColumns
+
+	file, err := scanFile(r.db.QueryRowContext(ctx, query, placeholder.BlurHash, placeholder.LQIP, placeholder.DominantColor, placeholder.AverageColor, id))
 	if err != nil {
-		return []model.CR2UploadResponse{}, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.CR2UploadResponse{}, fmt.Errorf("file %d: %w", id, model.ErrNotFound)
+		}
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to update placeholder: %w", err)
 	}
 
-	uid := user.UserID
+	return file, nil
+}
 
+// SetPHash records the perceptual hash of a file's pixels
+func (r *cr2Repository) SetPHash(ctx context.Context, id int64, hash uint64) (model.CR2UploadResponse, error) {
 	query := `
-		SELECT id, user_id, filename, filesize, mime_type, bucket_url, created_at, updated_at
-		FROM files
-		WHERE user_id = $1
-		ORDER BY created_at DESC
+		UPDATE files
+		SET phash = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING ` + fileColumns
+
+	file, err := scanFile(r.db.QueryRowContext(ctx, query, int64(hash), id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.CR2UploadResponse{}, fmt.Errorf("file %d: %w", id, model.ErrNotFound)
+		}
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to update perceptual hash: %w", err)
+	}
+
+	return file, nil
+}
+
+// FindSimilar returns a user's files whose perceptual hash is within
+// maxDistance bits of hash, closest first. The distance is counted in SQL
+// by casting the XOR of both hashes to a bit string.
+func (r *cr2Repository) FindSimilar(ctx context.Context, userID int64, hash uint64, maxDistance, limit int) ([]model.SimilarFile, error) {
+	query := `
+		SELECT ` + fileColumns + `, distance
+		FROM (
+			SELECT *, length(replace((phash # $2)::bit(64)::text, '0', '')) AS distance
+			FROM files
+			WHERE user_id = $1 AND phash IS NOT NULL
+		) candidates
+		WHERE distance <= $3
+		ORDER BY distance, created_at DESC
+		LIMIT $4
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, uid)
+	rows, err := r.db.QueryContext(ctx, query, userID, int64(hash), maxDistance, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query files for user: %w", err)
+		return nil, fmt.Errorf("failed to query similar files: %w", err)
 	}
 	defer rows.Close()
 
-	var files []model.CR2UploadResponse
+	similar := []model.SimilarFile{}
 	for rows.Next() {
-		var file model.CR2UploadResponse
-		if err := rows.Scan(
-			&file.ID,
-			&file.UserID,
-			&file.Filename,
-			&file.Filesize,
-			&file.MimeType,
-			&file.BucketURL,
-			&file.CreatedAt,
-			&file.UpdatedAt,
-		); err != nil {
+		var match model.SimilarFile
+		match.CR2UploadResponse, err = scanFile(withColumns(rows, &match.Distance))
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan file: %w", err)
 		}
-		files = append(files, file)
+		similar = append(similar, match)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating file rows: %w", err)
 	}
 
-	return files, nil
+	return similar, nil
+}
+
+// withColumns scans extra columns selected after fileColumns
+func withColumns(row rowScanner, extra ...interface{}) rowScanner {
+	return extraScanner{row: row, extra: extra}
+}
+
+type extraScanner struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+// formatPHash renders a perceptual hash as 16 hex digits
+func formatPHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// GetByID gets a file by ID
+func (r *cr2Repository) GetByID(ctx context.Context, id int64) (model.CR2UploadResponse, error) {
+	query := `
+		SELECT ` + fileColumns + `
+		FROM files
+		WHERE id = $1
+	`
+
+	file, err := scanFile(r.db.QueryRowContext(ctx, query, id))
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.CR2UploadResponse{}, fmt.Errorf("file %d: %w", id, model.ErrNotFound)
+		}
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	return file, nil
 }
 
 // // GetAll gets all files
@@ -280,26 +593,137 @@ func (r *cr2Repository) GetByUserID(ctx context.Context) ([]model.CR2UploadRespo
 // 	return updatedFile, nil
 // }
 
-// // Delete deletes a file record
-// func (r *fileRepository) Delete(ctx context.Context, id int64) error {
-// 	query := `
-// 		DELETE FROM files
-// 		WHERE id = $1
-// 	`
+// Delete removes a file's objects from storage and its record from the
+// database. The record is only committed as deleted once every object is
+// gone, so a failed delete can be retried safely. The objects of a blob
+// are only removed with its last reference.
+func (r *cr2Repository) Delete(ctx context.Context, file model.CR2UploadResponse) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-// 	result, err := r.db.ExecContext(ctx, query, id)
-// 	if err != nil {
-// 		return fmt.Errorf("failed to delete file: %w", err)
-// 	}
+	result, err := tx.ExecContext(ctx, "DELETE FROM files WHERE id = $1", file.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
 
-// 	rowsAffected, err := result.RowsAffected()
-// 	if err != nil {
-// 		return fmt.Errorf("failed to get rows affected: %w", err)
-// 	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
 
-// 	if rowsAffected == 0 {
-// 		return fmt.Errorf("file not found")
-// 	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("file %d: %w", file.ID, model.ErrNotFound)
+	}
 
-// 	return nil
-// }
+	shared := false
+	if file.SHA256 != "" {
+		refs, err := r.releaseBlob(ctx, tx, file.SHA256)
+		if err != nil {
+			return err
+		}
+		shared = refs > 0
+	}
+
+	partial := &model.PartialDeleteError{FileID: file.ID}
+
+	keys, prefixes := fileObjectKeys(file, shared)
+	for _, prefix := range prefixes {
+		listed, err := r.store.List(ctx, prefix)
+		if err != nil {
+			partial.FailedKeys = append(partial.FailedKeys, prefix+"*")
+			partial.Err = errors.Join(partial.Err, err)
+			continue
+		}
+		for _, obj := range listed {
+			if !slices.Contains(keys, obj.Key) {
+				keys = append(keys, obj.Key)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if err := r.store.Delete(ctx, key); err != nil {
+			partial.FailedKeys = append(partial.FailedKeys, key)
+			partial.Err = errors.Join(partial.Err, err)
+			continue
+		}
+		partial.DeletedKeys = append(partial.DeletedKeys, key)
+	}
+
+	if len(partial.FailedKeys) > 0 {
+		if len(partial.DeletedKeys) == 0 {
+			return fmt.Errorf("failed to delete file objects: %w", partial.Err)
+		}
+		return partial
+	}
+
+	if err := tx.Commit(); err != nil {
+		partial.Err = fmt.Errorf("failed to commit file deletion: %w", err)
+		return partial
+	}
+
+	return nil
+}
+
+// WatermarkScope is the key prefix of the objects a watermarked file owns
+// instead of sharing them with the other files of its blob
+func WatermarkScope(fileID int64) string {
+	return "wm/" + strconv.FormatInt(fileID, 10)
+}
+
+// WatermarkSourceKey is where a watermarked RAW file privately keeps its
+// clean embedded preview, the source of its renderings
+func WatermarkSourceKey(fileID int64) string {
+	return WatermarkScope(fileID) + "/source.jpg"
+}
+
+// RenderCacheKey is where an on-the-fly rendering of an object is cached
+func RenderCacheKey(objectKey, hash, ext string) string {
+	return renderCachePrefix(objectKey) + hash + ext
+}
+
+func renderCachePrefix(objectKey string) string {
+	return "cache/" + objectKey + "/"
+}
+
+// fileObjectKeys lists the storage objects to delete with a file, and the
+// prefixes under which further ones are found. While other files share
+// its blob only the objects the file owns go: its private original and,
+// when watermarked, everything under its scope and its renderings.
+func fileObjectKeys(file model.CR2UploadResponse, shared bool) ([]string, []string) {
+	var keys, prefixes []string
+	if !shared && file.ObjectKey != "" {
+		keys = append(keys, file.ObjectKey)
+	}
+	if file.OriginalKey != "" {
+		keys = append(keys, file.OriginalKey)
+	}
+
+	if !shared || file.Watermarked {
+		names := make([]string, 0, len(file.VariantKeys))
+		for name := range file.VariantKeys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			keys = append(keys, file.VariantKeys[name])
+		}
+	}
+
+	if file.Watermarked {
+		prefixes = append(prefixes, WatermarkScope(file.ID)+"/", renderCachePrefix(WatermarkScope(file.ID)))
+	}
+	if !shared {
+		prefixes = append(prefixes, renderCachePrefix(file.ObjectKey))
+		if file.SHA256 != "" {
+			// Variants made for other, already deleted files of the blob
+			prefixes = append(prefixes, strings.TrimSuffix(file.ObjectKey, path.Ext(file.ObjectKey))+"_")
+		}
+	}
+
+	return keys, prefixes
+}
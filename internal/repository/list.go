@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adorufus/imgupper/internal/model"
+)
+
+// listSorts maps listing sort keys to their column and the type their
+// cursor value is cast to
+var listSorts = map[string]struct {
+	column string
+	cast   string
+}{
+	model.SortDate: {"created_at", "timestamptz"},
+	model.SortSize: {"filesize", "bigint"},
+	model.SortName: {"filename", "text"},
+}
+
+// fileCursor is the position after the last file of a page: its sort value
+// and ID, which breaks ties. Sort and order are kept so a cursor cannot be
+// replayed against a different listing.
+type fileCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// encodeCursor makes an opaque cursor pointing after file
+func encodeCursor(opts model.FileListOptions, file model.CR2UploadResponse) string {
+	cursor := fileCursor{Sort: opts.Sort, Order: opts.Order, ID: file.ID}
+	switch opts.Sort {
+	case model.SortSize:
+		cursor.Value = strconv.FormatInt(file.Filesize, 10)
+	case model.SortName:
+		cursor.Value = file.Filename
+	default:
+		cursor.Value = file.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor reads a cursor made by encodeCursor for the same listing
+func decodeCursor(opts model.FileListOptions) (fileCursor, error) {
+	var cursor fileCursor
+	data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil {
+		return fileCursor{}, fmt.Errorf("%w: malformed cursor", model.ErrInvalidListOptions)
+	}
+
+	if cursor.Sort != opts.Sort || cursor.Order != opts.Order {
+		return fileCursor{}, fmt.Errorf("%w: cursor belongs to a listing with another sort or order", model.ErrInvalidListOptions)
+	}
+
+	return cursor, nil
+}
+
+// List returns a page of a user's files using keyset pagination on the
+// sort column and ID, so deep pages cost the same as the first one
+func (r *cr2Repository) List(ctx context.Context, userID int64, opts model.FileListOptions) (model.FileList, error) {
+	sort, ok := listSorts[opts.Sort]
+	if !ok {
+		return model.FileList{}, fmt.Errorf("%w: unknown sort %q", model.ErrInvalidListOptions, opts.Sort)
+	}
+
+	args := []interface{}{userID}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conditions := []string{"user_id = $1"}
+	if family, ok := strings.CutSuffix(opts.MimeType, "/*"); ok {
+		conditions = append(conditions, "starts_with(mime_type, "+arg(family+"/")+")")
+	} else if opts.MimeType != "" {
+		conditions = append(conditions, "mime_type = "+arg(opts.MimeType))
+	}
+	if !opts.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(opts.CreatedAfter))
+	}
+	if !opts.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(opts.CreatedBefore))
+	}
+	if opts.MinSize > 0 {
+		conditions = append(conditions, "filesize >= "+arg(opts.MinSize))
+	}
+	if opts.MaxSize > 0 {
+		conditions = append(conditions, "filesize <= "+arg(opts.MaxSize))
+	}
+
+	direction, compare := "ASC", ">"
+	if opts.Order == model.OrderDesc {
+		direction, compare = "DESC", "<"
+	}
+
+	if opts.Cursor != "" {
+		cursor, err := decodeCursor(opts)
+		if err != nil {
+			return model.FileList{}, err
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s::%s, %s)",
+			sort.column, compare, arg(cursor.Value), sort.cast, arg(cursor.ID)))
+	}
+
+	// One extra row tells whether there is a next page
+	query := `
+		SELECT ` + fileColumns + `
+		FROM files
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY ` + sort.column + ` ` + direction + `, id ` + direction + `
+		LIMIT ` + arg(opts.Limit+1)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return model.FileList{}, fmt.Errorf("failed to query files for user: %w", err)
+	}
+	defer rows.Close()
+
+	list := model.FileList{Files: []model.CR2UploadResponse{}}
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return model.FileList{}, fmt.Errorf("failed to scan file: %w", err)
+		}
+		list.Files = append(list.Files, file)
+	}
+
+	if err := rows.Err(); err != nil {
+		return model.FileList{}, fmt.Errorf("error iterating file rows: %w", err)
+	}
+
+	if len(list.Files) > opts.Limit {
+		list.Files = list.Files[:opts.Limit]
+		list.NextCursor = encodeCursor(opts, list.Files[len(list.Files)-1])
+	}
+
+	return list, nil
+}
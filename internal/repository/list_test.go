@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adorufus/imgupper/internal/model"
+)
+
+func TestFileCursor(t *testing.T) {
+	file := model.CR2UploadResponse{
+		ID:        42,
+		Filename:  "IMG_0001 \"copy\".CR2",
+		Filesize:  31457280,
+		CreatedAt: time.Date(2024, 5, 17, 9, 30, 15, 123456000, time.FixedZone("CEST", 2*3600)),
+	}
+
+	tests := []struct {
+		name      string
+		opts      model.FileListOptions
+		wantValue string
+	}{
+		{
+			name:      "date",
+			opts:      model.FileListOptions{Sort: model.SortDate, Order: model.OrderDesc},
+			wantValue: "2024-05-17T07:30:15.123456Z",
+		},
+		{
+			name:      "size",
+			opts:      model.FileListOptions{Sort: model.SortSize, Order: model.OrderAsc},
+			wantValue: "31457280",
+		},
+		{
+			name:      "name",
+			opts:      model.FileListOptions{Sort: model.SortName, Order: model.OrderAsc},
+			wantValue: file.Filename,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Cursor = encodeCursor(tt.opts, file)
+
+			cursor, err := decodeCursor(opts)
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+			if cursor.Value != tt.wantValue || cursor.ID != file.ID {
+				t.Errorf("decodeCursor() = %q, %d, want %q, %d", cursor.Value, cursor.ID, tt.wantValue, file.ID)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	dateDesc := model.FileListOptions{Sort: model.SortDate, Order: model.OrderDesc}
+	cursor := encodeCursor(dateDesc, model.CR2UploadResponse{ID: 7, CreatedAt: time.Now()})
+
+	tests := []struct {
+		name string
+		opts model.FileListOptions
+	}{
+		{name: "other sort", opts: model.FileListOptions{Sort: model.SortSize, Order: model.OrderDesc, Cursor: cursor}},
+		{name: "other order", opts: model.FileListOptions{Sort: model.SortDate, Order: model.OrderAsc, Cursor: cursor}},
+		{name: "not base64", opts: model.FileListOptions{Sort: model.SortDate, Order: model.OrderDesc, Cursor: "not a cursor!"}},
+		{name: "not json", opts: model.FileListOptions{Sort: model.SortDate, Order: model.OrderDesc, Cursor: "bm90IGpzb24"}},
+		{name: "padded base64", opts: model.FileListOptions{Sort: model.SortDate, Order: model.OrderDesc, Cursor: cursor + "=="}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.opts); !errors.Is(err, model.ErrInvalidListOptions) {
+				t.Errorf("decodeCursor() error = %v, want ErrInvalidListOptions", err)
+			}
+		})
+	}
+}
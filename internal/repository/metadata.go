@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/database"
+)
+
+// MetadataRepository defines the file metadata repository interface
+type MetadataRepository interface {
+	Upsert(ctx context.Context, meta model.FileMetadata) (model.FileMetadata, error)
+	GetByFileID(ctx context.Context, fileID int64) (model.FileMetadata, error)
+}
+
+// metadataRepository implements MetadataRepository
+type metadataRepository struct {
+	db *database.Database
+}
+
+// NewMetadataRepository creates a new MetadataRepository
+func NewMetadataRepository(db *database.Database) MetadataRepository {
+	return &metadataRepository{
+		db: db,
+	}
+}
+
+// metadataColumns lists the file_metadata columns in the order scanMetadata expects them
+const metadataColumns = `file_id, camera_make, camera_model, lens_model, software, exposure_time, f_number, focal_length, iso, captured_at, gps_latitude, gps_longitude, gps_altitude, xmp, created_at`
+
+func scanMetadata(row rowScanner) (model.FileMetadata, error) {
+	var meta model.FileMetadata
+	var cameraMake, cameraModel, lensModel, software, exposureTime, xmp sql.NullString
+	var fNumber, focalLength, latitude, longitude, altitude sql.NullFloat64
+	var iso sql.NullInt64
+	var capturedAt sql.NullTime
+
+	err := row.Scan(
+		&meta.FileID,
+		&cameraMake,
+		&cameraModel,
+		&lensModel,
+		&software,
+		&exposureTime,
+		&fNumber,
+		&focalLength,
+		&iso,
+		&capturedAt,
+		&latitude,
+		&longitude,
+		&altitude,
+		&xmp,
+		&meta.CreatedAt,
+	)
+	if err != nil {
+		return meta, err
+	}
+
+	meta.CameraMake = cameraMake.String
+	meta.CameraModel = cameraModel.String
+	meta.LensModel = lensModel.String
+	meta.Software = software.String
+	meta.ExposureTime = exposureTime.String
+	meta.XMP = xmp.String
+
+	if fNumber.Valid {
+		meta.FNumber = &fNumber.Float64
+	}
+	if focalLength.Valid {
+		meta.FocalLength = &focalLength.Float64
+	}
+	if iso.Valid {
+		value := int(iso.Int64)
+		meta.ISO = &value
+	}
+	if capturedAt.Valid {
+		meta.CapturedAt = &capturedAt.Time
+	}
+	if latitude.Valid && longitude.Valid {
+		meta.GPS = &model.GPS{Latitude: latitude.Float64, Longitude: longitude.Float64}
+		if altitude.Valid {
+			meta.GPS.Altitude = &altitude.Float64
+		}
+	}
+
+	return meta, nil
+}
+
+// Upsert stores the metadata of a file, replacing any earlier extraction,
+// and makes its camera fields searchable
+func (r *metadataRepository) Upsert(ctx context.Context, meta model.FileMetadata) (model.FileMetadata, error) {
+	var latitude, longitude, altitude *float64
+	if meta.GPS != nil {
+		latitude = &meta.GPS.Latitude
+		longitude = &meta.GPS.Longitude
+		altitude = meta.GPS.Altitude
+	}
+
+	query := `
+		INSERT INTO file_metadata (file_id, camera_make, camera_model, lens_model, software, exposure_time, f_number, focal_length, iso, captured_at, gps_latitude, gps_longitude, gps_altitude, xmp, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NOW())
+		ON CONFLICT (file_id) DO UPDATE SET
+			camera_make = EXCLUDED.camera_make,
+			camera_model = EXCLUDED.camera_model,
+			lens_model = EXCLUDED.lens_model,
+			software = EXCLUDED.software,
+			exposure_time = EXCLUDED.exposure_time,
+			f_number = EXCLUDED.f_number,
+			focal_length = EXCLUDED.focal_length,
+			iso = EXCLUDED.iso,
+			captured_at = EXCLUDED.captured_at,
+			gps_latitude = EXCLUDED.gps_latitude,
+			gps_longitude = EXCLUDED.gps_longitude,
+			gps_altitude = EXCLUDED.gps_altitude,
+			xmp = EXCLUDED.xmp
+		RETURNING ` + metadataColumns
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return model.FileMetadata{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stored, err := scanMetadata(tx.QueryRowContext(
+		ctx,
+		query,
+		meta.FileID,
+		nullString(meta.CameraMake),
+		nullString(meta.CameraModel),
+		nullString(meta.LensModel),
+		nullString(meta.Software),
+		nullString(meta.ExposureTime),
+		meta.FNumber,
+		meta.FocalLength,
+		meta.ISO,
+		meta.CapturedAt,
+		latitude,
+		longitude,
+		altitude,
+		nullString(meta.XMP),
+	))
+	if err != nil {
+		return model.FileMetadata{}, fmt.Errorf("failed to store file metadata: %w", err)
+	}
+
+	if err := refreshSearchVector(ctx, tx, meta.FileID); err != nil {
+		return model.FileMetadata{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.FileMetadata{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return stored, nil
+}
+
+// GetByFileID gets the metadata of a file
+func (r *metadataRepository) GetByFileID(ctx context.Context, fileID int64) (model.FileMetadata, error) {
+	query := `
+		SELECT ` + metadataColumns + `
+		FROM file_metadata
+		WHERE file_id = $1
+	`
+
+	meta, err := scanMetadata(r.db.QueryRowContext(ctx, query, fileID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.FileMetadata{}, fmt.Errorf("metadata of file %d: %w", fileID, model.ErrNotFound)
+		}
+		return model.FileMetadata{}, fmt.Errorf("failed to get file metadata: %w", err)
+	}
+
+	return meta, nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -1,20 +1,33 @@
 package repository
 
 import (
+	"github.com/adorufus/imgupper/config"
 	"github.com/adorufus/imgupper/pkg/database"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/adorufus/imgupper/pkg/storage"
 )
 
 type Repositories struct {
-	User   UserRepository
-	Health HealthRepository
-	Cr2    Cr2Repository
+	User      UserRepository
+	Health    HealthRepository
+	Cr2       Cr2Repository
+	Audit     AuditRepository
+	Tus       TusRepository
+	Ticket    TicketRepository
+	Metadata  MetadataRepository
+	Watermark WatermarkRepository
+	Album     AlbumRepository
 }
 
-func NewRepositories(db *database.Database, s3Client *s3.Client) *Repositories {
+func NewRepositories(db *database.Database, store storage.Backend, storageCfg config.StorageConfig) *Repositories {
 	return &Repositories{
-		User:   NewUserRepository(db),
-		Health: NewHealthRepository(db),
-		Cr2:    NewCr2Repository(db, s3Client),
+		User:      NewUserRepository(db),
+		Health:    NewHealthRepository(db),
+		Cr2:       NewCr2Repository(db, store, storageCfg),
+		Audit:     NewAuditRepository(db),
+		Tus:       NewTusRepository(db),
+		Ticket:    NewTicketRepository(db),
+		Metadata:  NewMetadataRepository(db),
+		Watermark: NewWatermarkRepository(db),
+		Album:     NewAlbumRepository(db),
 	}
 }
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/lib/pq"
+)
+
+// updateSearchVector recomputes the full-text document of file $1 from its
+// filename, split on separators, its tags and its camera metadata. The
+// backfill in migration 000018 uses the same expression.
+const updateSearchVector = `
+	UPDATE files f
+	SET search_vector =
+		setweight(to_tsvector('simple', regexp_replace(f.filename, '[._-]+', ' ', 'g')), 'A') ||
+		setweight(to_tsvector('simple', array_to_string(f.tags, ' ')), 'A') ||
+		setweight(to_tsvector('simple', concat_ws(' ', m.camera_make, m.camera_model, m.lens_model, m.software)), 'B')
+	FROM (SELECT $1::int AS id) target
+	LEFT JOIN file_metadata m ON m.file_id = target.id
+	WHERE f.id = target.id
+`
+
+// refreshSearchVector recomputes the full-text document of a file
+func refreshSearchVector(ctx context.Context, tx *sql.Tx, fileID int64) error {
+	if _, err := tx.ExecContext(ctx, updateSearchVector, fileID); err != nil {
+		return fmt.Errorf("failed to update search vector: %w", err)
+	}
+	return nil
+}
+
+// SetTags replaces the tags of a file
+func (r *cr2Repository) SetTags(ctx context.Context, id int64, tags []string) (model.CR2UploadResponse, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE files SET tags = $1, updated_at = NOW() WHERE id = $2", pq.Array(tags), id)
+	if err != nil {
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to update tags: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return model.CR2UploadResponse{}, fmt.Errorf("file %d: %w", id, model.ErrNotFound)
+	}
+
+	if err := refreshSearchVector(ctx, tx, id); err != nil {
+		return model.CR2UploadResponse{}, err
+	}
+
+	file, err := scanFile(tx.QueryRowContext(ctx, "SELECT "+fileColumns+" FROM files WHERE id = $1", id))
+	if err != nil {
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.CR2UploadResponse{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return file, nil
+}
+
+// searchCursor is the position after the last result of a page: its rank
+// and ID. The query and tags are kept so a cursor cannot be replayed
+// against a different search.
+type searchCursor struct {
+	Query string   `json:"q"`
+	Tags  []string `json:"t,omitempty"`
+	Rank  float32  `json:"r"`
+	ID    int64    `json:"id"`
+}
+
+// encodeSearchCursor makes an opaque cursor pointing after the result with
+// the given rank and ID
+func encodeSearchCursor(opts model.SearchOptions, rank float32, id int64) string {
+	data, _ := json.Marshal(searchCursor{Query: opts.Query, Tags: opts.Tags, Rank: rank, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeSearchCursor reads a cursor made by encodeSearchCursor for the same
+// search
+func decodeSearchCursor(opts model.SearchOptions) (searchCursor, error) {
+	var cursor searchCursor
+	data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil {
+		return searchCursor{}, fmt.Errorf("%w: malformed cursor", model.ErrInvalidListOptions)
+	}
+
+	if cursor.Query != opts.Query || !slices.Equal(cursor.Tags, opts.Tags) {
+		return searchCursor{}, fmt.Errorf("%w: cursor belongs to another search", model.ErrInvalidListOptions)
+	}
+
+	return cursor, nil
+}
+
+// Search returns a page of a user's files matching a full-text query and
+// carrying all the given tags, best matches first. Without a query every
+// tagged file matches with the same rank, newest first.
+func (r *cr2Repository) Search(ctx context.Context, userID int64, opts model.SearchOptions) (model.FileList, error) {
+	var after searchCursor
+	if opts.Cursor != "" {
+		var err error
+		if after, err = decodeSearchCursor(opts); err != nil {
+			return model.FileList{}, err
+		}
+	}
+
+	// One extra row tells whether there is a next page
+	query := `
+		SELECT ` + fileColumns + `, rank
+		FROM (
+			SELECT files.*, CASE WHEN $2 = '' THEN 0 ELSE ts_rank_cd(search_vector, query) END AS rank
+			FROM files, websearch_to_tsquery('simple', $2) AS query
+			WHERE user_id = $1
+				AND ($2 = '' OR search_vector @@ query)
+				AND tags @> $3::text[]
+		) results
+		WHERE $4 = 0 OR (rank, id) < ($5::real, $4::int)
+		ORDER BY rank DESC, id DESC
+		LIMIT $6
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, opts.Query, pq.Array(opts.Tags), after.ID, after.Rank, opts.Limit+1)
+	if err != nil {
+		return model.FileList{}, fmt.Errorf("failed to search files: %w", err)
+	}
+	defer rows.Close()
+
+	list := model.FileList{Files: []model.CR2UploadResponse{}}
+	var ranks []float32
+	for rows.Next() {
+		var rank float32
+		file, err := scanFile(withColumns(rows, &rank))
+		if err != nil {
+			return model.FileList{}, fmt.Errorf("failed to scan file: %w", err)
+		}
+		list.Files = append(list.Files, file)
+		ranks = append(ranks, rank)
+	}
+
+	if err := rows.Err(); err != nil {
+		return model.FileList{}, fmt.Errorf("error iterating file rows: %w", err)
+	}
+
+	if len(list.Files) > opts.Limit {
+		list.Files = list.Files[:opts.Limit]
+		list.NextCursor = encodeSearchCursor(opts, ranks[opts.Limit-1], list.Files[opts.Limit-1].ID)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adorufus/imgupper/internal/model"
+)
+
+func TestSearchCursor(t *testing.T) {
+	tests := []struct {
+		name string
+		opts model.SearchOptions
+		rank float32
+	}{
+		{name: "query", opts: model.SearchOptions{Query: "sunset beach"}, rank: 0.1},
+		{name: "tags", opts: model.SearchOptions{Tags: []string{"holiday", "sea"}}},
+		{name: "query and tags", opts: model.SearchOptions{Query: `"golden hour" -night`, Tags: []string{"sea"}}, rank: 0.083333336},
+		{name: "tiny rank", opts: model.SearchOptions{Query: "a"}, rank: 1e-7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Cursor = encodeSearchCursor(tt.opts, tt.rank, 42)
+
+			cursor, err := decodeSearchCursor(opts)
+			if err != nil {
+				t.Fatalf("decodeSearchCursor() error = %v", err)
+			}
+			// The rank must survive exactly, it is compared as a real
+			if cursor.Rank != tt.rank || cursor.ID != 42 {
+				t.Errorf("decodeSearchCursor() = %v, %d, want %v, 42", cursor.Rank, cursor.ID, tt.rank)
+			}
+		})
+	}
+}
+
+func TestDecodeSearchCursorRejects(t *testing.T) {
+	search := model.SearchOptions{Query: "sunset", Tags: []string{"sea"}}
+	cursor := encodeSearchCursor(search, 0.5, 7)
+
+	tests := []struct {
+		name string
+		opts model.SearchOptions
+	}{
+		{name: "other query", opts: model.SearchOptions{Query: "sunrise", Tags: []string{"sea"}, Cursor: cursor}},
+		{name: "other tags", opts: model.SearchOptions{Query: "sunset", Tags: []string{"lake"}, Cursor: cursor}},
+		{name: "tags dropped", opts: model.SearchOptions{Query: "sunset", Cursor: cursor}},
+		{name: "list cursor", opts: model.SearchOptions{Query: "sunset", Tags: []string{"sea"}, Cursor: encodeCursor(model.FileListOptions{Sort: model.SortDate}, model.CR2UploadResponse{ID: 7})}},
+		{name: "malformed", opts: model.SearchOptions{Query: "sunset", Tags: []string{"sea"}, Cursor: "%%%"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeSearchCursor(tt.opts); !errors.Is(err, model.ErrInvalidListOptions) {
+				t.Errorf("decodeSearchCursor() error = %v, want ErrInvalidListOptions", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/database"
+)
+
+// TicketRepository defines the upload ticket repository interface
+type TicketRepository interface {
+	Create(ctx context.Context, ticket model.UploadTicket) (model.UploadTicket, error)
+	GetByID(ctx context.Context, id string) (model.UploadTicket, error)
+	Claim(ctx context.Context, id string) (model.UploadTicket, error)
+	Delete(ctx context.Context, id string) error
+	ListExpired(ctx context.Context, now time.Time) ([]model.UploadTicket, error)
+}
+
+// ticketRepository implements TicketRepository
+type ticketRepository struct {
+	db *database.Database
+}
+
+// NewTicketRepository creates a new TicketRepository
+func NewTicketRepository(db *database.Database) TicketRepository {
+	return &ticketRepository{
+		db: db,
+	}
+}
+
+const ticketColumns = `id, user_id, object_key, filename, mime_type, filesize, is_public, expires_at, claimed_at, created_at`
+
+func scanTicket(row rowScanner) (model.UploadTicket, error) {
+	var ticket model.UploadTicket
+	err := row.Scan(
+		&ticket.ID,
+		&ticket.UserID,
+		&ticket.ObjectKey,
+		&ticket.Filename,
+		&ticket.MimeType,
+		&ticket.Filesize,
+		&ticket.IsPublic,
+		&ticket.ExpiresAt,
+		&ticket.ClaimedAt,
+		&ticket.CreatedAt,
+	)
+	return ticket, err
+}
+
+// Create creates a new upload ticket
+func (r *ticketRepository) Create(ctx context.Context, ticket model.UploadTicket) (model.UploadTicket, error) {
+	query := `
+		INSERT INTO upload_tickets (id, user_id, object_key, filename, mime_type, filesize, is_public, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+		RETURNING ` + ticketColumns
+
+	created, err := scanTicket(r.db.QueryRowContext(
+		ctx,
+		query,
+		ticket.ID,
+		ticket.UserID,
+		ticket.ObjectKey,
+		ticket.Filename,
+		ticket.MimeType,
+		ticket.Filesize,
+		ticket.IsPublic,
+		ticket.ExpiresAt,
+	))
+	if err != nil {
+		return model.UploadTicket{}, fmt.Errorf("failed to create upload ticket: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetByID gets an upload ticket by ID
+func (r *ticketRepository) GetByID(ctx context.Context, id string) (model.UploadTicket, error) {
+	query := `
+		SELECT ` + ticketColumns + `
+		FROM upload_tickets
+		WHERE id = $1
+	`
+
+	ticket, err := scanTicket(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.UploadTicket{}, fmt.Errorf("upload ticket %s: %w", id, model.ErrNotFound)
+		}
+		return model.UploadTicket{}, fmt.Errorf("failed to get upload ticket: %w", err)
+	}
+
+	return ticket, nil
+}
+
+// Claim marks an upload ticket as claimed and returns it, only one caller
+// can claim a ticket
+func (r *ticketRepository) Claim(ctx context.Context, id string) (model.UploadTicket, error) {
+	query := `
+		UPDATE upload_tickets
+		SET claimed_at = NOW()
+		WHERE id = $1 AND claimed_at IS NULL
+		RETURNING ` + ticketColumns
+
+	ticket, err := scanTicket(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.UploadTicket{}, fmt.Errorf("upload ticket %s: %w", id, model.ErrNotFound)
+		}
+		return model.UploadTicket{}, fmt.Errorf("failed to claim upload ticket: %w", err)
+	}
+
+	return ticket, nil
+}
+
+// Delete deletes an upload ticket
+func (r *ticketRepository) Delete(ctx context.Context, id string) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM upload_tickets WHERE id = $1", id); err != nil {
+		return fmt.Errorf("failed to delete upload ticket: %w", err)
+	}
+
+	return nil
+}
+
+// ListExpired lists tickets whose expiry is before now
+func (r *ticketRepository) ListExpired(ctx context.Context, now time.Time) ([]model.UploadTicket, error) {
+	query := `
+		SELECT ` + ticketColumns + `
+		FROM upload_tickets
+		WHERE expires_at < $1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired upload tickets: %w", err)
+	}
+	defer rows.Close()
+
+	var tickets []model.UploadTicket
+	for rows.Next() {
+		ticket, err := scanTicket(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan upload ticket: %w", err)
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating upload ticket rows: %w", err)
+	}
+
+	return tickets, nil
+}
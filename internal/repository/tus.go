@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/database"
+)
+
+// TusRepository defines the resumable upload repository interface
+type TusRepository interface {
+	Create(ctx context.Context, upload model.TusUpload) (model.TusUpload, error)
+	GetByID(ctx context.Context, id string) (model.TusUpload, error)
+	Lock(ctx context.Context, id string) (func(), error)
+	UpdateProgress(ctx context.Context, upload model.TusUpload, prevOffset int64) error
+	Finish(ctx context.Context, id string, fn func(upload model.TusUpload) error) error
+	Delete(ctx context.Context, id string) error
+	ListExpired(ctx context.Context, now time.Time) ([]model.TusUpload, error)
+}
+
+// tusRepository implements TusRepository
+type tusRepository struct {
+	db *database.Database
+}
+
+// NewTusRepository creates a new TusRepository
+func NewTusRepository(db *database.Database) TusRepository {
+	return &tusRepository{
+		db: db,
+	}
+}
+
+const tusColumns = `id, user_id, upload_length, upload_offset, filename, mime_type, is_public, object_key, multipart_id, parts, pending_size, expires_at, created_at, updated_at`
+
+func scanTusUpload(row rowScanner) (model.TusUpload, error) {
+	var upload model.TusUpload
+	var parts []byte
+
+	err := row.Scan(
+		&upload.ID,
+		&upload.UserID,
+		&upload.UploadLength,
+		&upload.UploadOffset,
+		&upload.Filename,
+		&upload.MimeType,
+		&upload.IsPublic,
+		&upload.ObjectKey,
+		&upload.MultipartID,
+		&parts,
+		&upload.PendingSize,
+		&upload.ExpiresAt,
+		&upload.CreatedAt,
+		&upload.UpdatedAt,
+	)
+	if err != nil {
+		return model.TusUpload{}, err
+	}
+
+	if err := json.Unmarshal(parts, &upload.Parts); err != nil {
+		return model.TusUpload{}, fmt.Errorf("failed to decode upload parts: %w", err)
+	}
+
+	return upload, nil
+}
+
+// Create creates a new resumable upload
+func (r *tusRepository) Create(ctx context.Context, upload model.TusUpload) (model.TusUpload, error) {
+	query := `
+		INSERT INTO tus_uploads (id, user_id, upload_length, filename, mime_type, is_public, object_key, multipart_id, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW())
+		RETURNING ` + tusColumns
+
+	created, err := scanTusUpload(r.db.QueryRowContext(
+		ctx,
+		query,
+		upload.ID,
+		upload.UserID,
+		upload.UploadLength,
+		upload.Filename,
+		upload.MimeType,
+		upload.IsPublic,
+		upload.ObjectKey,
+		upload.MultipartID,
+		upload.ExpiresAt,
+	))
+	if err != nil {
+		return model.TusUpload{}, fmt.Errorf("failed to create upload: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetByID gets a resumable upload by ID
+func (r *tusRepository) GetByID(ctx context.Context, id string) (model.TusUpload, error) {
+	query := `
+		SELECT ` + tusColumns + `
+		FROM tus_uploads
+		WHERE id = $1
+	`
+
+	upload, err := scanTusUpload(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.TusUpload{}, fmt.Errorf("upload %s: %w", id, model.ErrNotFound)
+		}
+		return model.TusUpload{}, fmt.Errorf("failed to get upload: %w", err)
+	}
+
+	return upload, nil
+}
+
+// Lock takes an exclusive advisory lock on an upload for the length of a
+// PATCH, so two requests never send the same part. It fails with
+// model.ErrUploadLocked instead of waiting when another request holds the
+// lock. The returned function releases it; the lock also goes with the
+// connection if the server dies.
+func (r *tusRepository) Lock(ctx context.Context, id string) (func(), error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	var locked bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtextextended($1, 0))", tusLockKey(id)).Scan(&locked)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to lock upload: %w", err)
+	}
+	if !locked {
+		conn.Close()
+		return nil, model.ErrUploadLocked
+	}
+
+	return func() {
+		// Unlock even when the request was cancelled
+		_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtextextended($1, 0))", tusLockKey(id))
+		if err != nil {
+			// Never hand a connection still holding the lock back to the pool
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, nil
+}
+
+// tusLockKey namespaces the advisory lock of an upload
+func tusLockKey(id string) string {
+	return "tus_uploads:" + id
+}
+
+// UpdateProgress stores the new offset and parts, failing with
+// model.ErrOffsetMismatch when another request advanced the upload first
+func (r *tusRepository) UpdateProgress(ctx context.Context, upload model.TusUpload, prevOffset int64) error {
+	parts, err := json.Marshal(upload.Parts)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload parts: %w", err)
+	}
+
+	query := `
+		UPDATE tus_uploads
+		SET upload_offset = $1, parts = $2, pending_size = $3, updated_at = NOW()
+		WHERE id = $4 AND upload_offset = $5
+	`
+
+	result, err := r.db.ExecContext(ctx, query, upload.UploadOffset, parts, upload.PendingSize, upload.ID, prevOffset)
+	if err != nil {
+		return fmt.Errorf("failed to update upload: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return model.ErrOffsetMismatch
+	}
+
+	return nil
+}
+
+// Finish locks a fully received upload while fn records it, then deletes
+// it. Concurrent calls wait for the lock and then no longer find the
+// upload; when fn fails the upload is kept so finishing can be retried.
+func (r *tusRepository) Finish(ctx context.Context, id string, fn func(upload model.TusUpload) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + tusColumns + `
+		FROM tus_uploads
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	upload, err := scanTusUpload(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("upload %s: %w", id, model.ErrNotFound)
+		}
+		return fmt.Errorf("failed to lock upload: %w", err)
+	}
+
+	if upload.UploadOffset != upload.UploadLength {
+		return model.ErrOffsetMismatch
+	}
+
+	if err := fn(upload); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tus_uploads WHERE id = $1", id); err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit upload: %w", err)
+	}
+
+	return nil
+}
+
+// Delete deletes a resumable upload
+func (r *tusRepository) Delete(ctx context.Context, id string) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM tus_uploads WHERE id = $1", id); err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+
+	return nil
+}
+
+// ListExpired lists uploads whose expiry is before now
+func (r *tusRepository) ListExpired(ctx context.Context, now time.Time) ([]model.TusUpload, error) {
+	query := `
+		SELECT ` + tusColumns + `
+		FROM tus_uploads
+		WHERE expires_at < $1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired uploads: %w", err)
+	}
+	defer rows.Close()
+
+	var uploads []model.TusUpload
+	for rows.Next() {
+		upload, err := scanTusUpload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan upload: %w", err)
+		}
+		uploads = append(uploads, upload)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating upload rows: %w", err)
+	}
+
+	return uploads, nil
+}
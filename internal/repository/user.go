@@ -19,6 +19,8 @@ type UserRepository interface {
 	GetAll(ctx context.Context) ([]model.User, error)
 	Update(ctx context.Context, user model.User) (model.User, error)
 	Delete(ctx context.Context, id int64) error
+	GetPrivacy(ctx context.Context, id int64) (model.PrivacySettings, error)
+	UpdatePrivacy(ctx context.Context, id int64, settings model.PrivacySettings) (model.PrivacySettings, error)
 }
 
 // userRepository implements UserRepository
@@ -38,7 +40,7 @@ func (r *userRepository) Create(ctx context.Context, user model.User) (model.Use
 	query := `
 		INSERT INTO users (name, email, password, created_at, updated_at)
 		VALUES ($1, $2, $3, NOW(), NOW())
-		RETURNING id, name, email, created_at, updated_at
+		RETURNING id, name, email, role, created_at, updated_at
 	`
 
 	var createdUser model.User
@@ -52,6 +54,7 @@ func (r *userRepository) Create(ctx context.Context, user model.User) (model.Use
 		&createdUser.ID,
 		&createdUser.Name,
 		&createdUser.Email,
+		&createdUser.Role,
 		&createdUser.CreatedAt,
 		&createdUser.UpdatedAt,
 	)
@@ -66,7 +69,7 @@ func (r *userRepository) Create(ctx context.Context, user model.User) (model.Use
 // GetByID gets a user by ID
 func (r *userRepository) GetByID(ctx context.Context, id int64) (model.User, error) {
 	query := `
-		SELECT id, name, email, password, created_at, updated_at
+		SELECT id, name, email, role, password, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
@@ -76,6 +79,7 @@ func (r *userRepository) GetByID(ctx context.Context, id int64) (model.User, err
 		&user.ID,
 		&user.Name,
 		&user.Email,
+		&user.Role,
 		&user.Password,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -94,7 +98,7 @@ func (r *userRepository) GetByID(ctx context.Context, id int64) (model.User, err
 // GetByEmail gets a user by email
 func (r *userRepository) GetByEmail(ctx context.Context, email string) (model.User, error) {
 	query := `
-		SELECT id, name, email, password, created_at, updated_at
+		SELECT id, name, email, role, password, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
@@ -104,6 +108,7 @@ func (r *userRepository) GetByEmail(ctx context.Context, email string) (model.Us
 		&user.ID,
 		&user.Name,
 		&user.Email,
+		&user.Role,
 		&user.Password,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -137,7 +142,7 @@ func (r *userRepository) ExistsByEmail(ctx context.Context, email string) (bool,
 // GetAll gets all users
 func (r *userRepository) GetAll(ctx context.Context) ([]model.User, error) {
 	query := `
-		SELECT id, name, email, created_at, updated_at
+		SELECT id, name, email, role, created_at, updated_at
 		FROM users
 		ORDER BY id
 	`
@@ -155,6 +160,7 @@ func (r *userRepository) GetAll(ctx context.Context) ([]model.User, error) {
 			&user.ID,
 			&user.Name,
 			&user.Email,
+			&user.Role,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		); err != nil {
@@ -176,7 +182,7 @@ func (r *userRepository) Update(ctx context.Context, user model.User) (model.Use
 		UPDATE users
 		SET name = $1, email = $2, updated_at = NOW()
 		WHERE id = $3
-		RETURNING id, name, email, created_at, updated_at
+		RETURNING id, name, email, role, created_at, updated_at
 	`
 
 	var updatedUser model.User
@@ -190,6 +196,7 @@ func (r *userRepository) Update(ctx context.Context, user model.User) (model.Use
 		&updatedUser.ID,
 		&updatedUser.Name,
 		&updatedUser.Email,
+		&updatedUser.Role,
 		&updatedUser.CreatedAt,
 		&updatedUser.UpdatedAt,
 	)
@@ -227,3 +234,44 @@ func (r *userRepository) Delete(ctx context.Context, id int64) error {
 
 	return nil
 }
+
+// GetPrivacy gets the upload privacy settings of a user
+func (r *userRepository) GetPrivacy(ctx context.Context, id int64) (model.PrivacySettings, error) {
+	query := `
+		SELECT COALESCE(metadata_policy, ''), keep_original
+		FROM users
+		WHERE id = $1
+	`
+
+	var settings model.PrivacySettings
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&settings.MetadataPolicy, &settings.KeepOriginal)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.PrivacySettings{}, fmt.Errorf("user %d: %w", id, model.ErrNotFound)
+		}
+		return model.PrivacySettings{}, fmt.Errorf("failed to get privacy settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// UpdatePrivacy updates the upload privacy settings of a user
+func (r *userRepository) UpdatePrivacy(ctx context.Context, id int64, settings model.PrivacySettings) (model.PrivacySettings, error) {
+	query := `
+		UPDATE users
+		SET metadata_policy = NULLIF($1, ''), keep_original = $2, updated_at = NOW()
+		WHERE id = $3
+		RETURNING COALESCE(metadata_policy, ''), keep_original
+	`
+
+	var updated model.PrivacySettings
+	err := r.db.QueryRowContext(ctx, query, settings.MetadataPolicy, settings.KeepOriginal, id).Scan(&updated.MetadataPolicy, &updated.KeepOriginal)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.PrivacySettings{}, fmt.Errorf("user %d: %w", id, model.ErrNotFound)
+		}
+		return model.PrivacySettings{}, fmt.Errorf("failed to update privacy settings: %w", err)
+	}
+
+	return updated, nil
+}
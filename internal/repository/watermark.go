@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/database"
+)
+
+// WatermarkRepository defines the watermark repository interface
+type WatermarkRepository interface {
+	Create(ctx context.Context, watermark model.Watermark) (model.Watermark, error)
+	GetByID(ctx context.Context, id int64) (model.Watermark, error)
+	GetByUserID(ctx context.Context, userID int64) ([]model.Watermark, error)
+	Update(ctx context.Context, watermark model.Watermark) (model.Watermark, error)
+	SetImageKey(ctx context.Context, id int64, key string) (model.Watermark, error)
+	Delete(ctx context.Context, id int64) error
+	GetDefault(ctx context.Context, userID int64) (model.Watermark, error)
+	SetDefault(ctx context.Context, userID int64, id *int64) error
+}
+
+// watermarkRepository implements WatermarkRepository
+type watermarkRepository struct {
+	db *database.Database
+}
+
+// NewWatermarkRepository creates a new WatermarkRepository
+func NewWatermarkRepository(db *database.Database) WatermarkRepository {
+	return &watermarkRepository{
+		db: db,
+	}
+}
+
+const watermarkColumns = `id, user_id, name, kind, text, image_key, position, opacity, scale, created_at, updated_at`
+
+func scanWatermark(row rowScanner) (model.Watermark, error) {
+	var watermark model.Watermark
+	err := row.Scan(
+		&watermark.ID,
+		&watermark.UserID,
+		&watermark.Name,
+		&watermark.Kind,
+		&watermark.Text,
+		&watermark.ImageKey,
+		&watermark.Position,
+		&watermark.Opacity,
+		&watermark.Scale,
+		&watermark.CreatedAt,
+		&watermark.UpdatedAt,
+	)
+	watermark.HasLogo = watermark.ImageKey != ""
+	return watermark, err
+}
+
+// Create creates a new watermark
+func (r *watermarkRepository) Create(ctx context.Context, watermark model.Watermark) (model.Watermark, error) {
+	query := `
+		INSERT INTO watermarks (user_id, name, kind, text, position, opacity, scale, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		RETURNING ` + watermarkColumns
+
+	created, err := scanWatermark(r.db.QueryRowContext(
+		ctx,
+		query,
+		watermark.UserID,
+		watermark.Name,
+		watermark.Kind,
+		watermark.Text,
+		watermark.Position,
+		watermark.Opacity,
+		watermark.Scale,
+	))
+	if err != nil {
+		return model.Watermark{}, fmt.Errorf("failed to create watermark: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetByID gets a watermark by ID
+func (r *watermarkRepository) GetByID(ctx context.Context, id int64) (model.Watermark, error) {
+	query := `
+		SELECT ` + watermarkColumns + `
+		FROM watermarks
+		WHERE id = $1
+	`
+
+	watermark, err := scanWatermark(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Watermark{}, fmt.Errorf("watermark %d: %w", id, model.ErrNotFound)
+		}
+		return model.Watermark{}, fmt.Errorf("failed to get watermark: %w", err)
+	}
+
+	return watermark, nil
+}
+
+// GetByUserID lists the watermarks of a user
+func (r *watermarkRepository) GetByUserID(ctx context.Context, userID int64) ([]model.Watermark, error) {
+	query := `
+		SELECT ` + watermarkColumns + `
+		FROM watermarks
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query watermarks: %w", err)
+	}
+	defer rows.Close()
+
+	watermarks := []model.Watermark{}
+	for rows.Next() {
+		watermark, err := scanWatermark(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan watermark: %w", err)
+		}
+		watermarks = append(watermarks, watermark)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating watermark rows: %w", err)
+	}
+
+	return watermarks, nil
+}
+
+// Update updates the settings of a watermark
+func (r *watermarkRepository) Update(ctx context.Context, watermark model.Watermark) (model.Watermark, error) {
+	query := `
+		UPDATE watermarks
+		SET name = $1, kind = $2, text = $3, position = $4, opacity = $5, scale = $6, updated_at = NOW()
+		WHERE id = $7
+		RETURNING ` + watermarkColumns
+
+	updated, err := scanWatermark(r.db.QueryRowContext(
+		ctx,
+		query,
+		watermark.Name,
+		watermark.Kind,
+		watermark.Text,
+		watermark.Position,
+		watermark.Opacity,
+		watermark.Scale,
+		watermark.ID,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Watermark{}, fmt.Errorf("watermark %d: %w", watermark.ID, model.ErrNotFound)
+		}
+		return model.Watermark{}, fmt.Errorf("failed to update watermark: %w", err)
+	}
+
+	return updated, nil
+}
+
+// SetImageKey records the object key of a watermark's logo
+func (r *watermarkRepository) SetImageKey(ctx context.Context, id int64, key string) (model.Watermark, error) {
+	query := `
+		UPDATE watermarks
+		SET image_key = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING ` + watermarkColumns
+
+	updated, err := scanWatermark(r.db.QueryRowContext(ctx, query, key, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Watermark{}, fmt.Errorf("watermark %d: %w", id, model.ErrNotFound)
+		}
+		return model.Watermark{}, fmt.Errorf("failed to update watermark logo: %w", err)
+	}
+
+	return updated, nil
+}
+
+// Delete deletes a watermark, users applying it fall back to none
+func (r *watermarkRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM watermarks WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete watermark: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("watermark %d: %w", id, model.ErrNotFound)
+	}
+
+	return nil
+}
+
+// GetDefault gets the watermark applied to a user's uploads
+func (r *watermarkRepository) GetDefault(ctx context.Context, userID int64) (model.Watermark, error) {
+	query := `
+		SELECT ` + watermarkColumns + `
+		FROM watermarks
+		WHERE id = (SELECT watermark_id FROM users WHERE id = $1)
+	`
+
+	watermark, err := scanWatermark(r.db.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Watermark{}, fmt.Errorf("watermark of user %d: %w", userID, model.ErrNotFound)
+		}
+		return model.Watermark{}, fmt.Errorf("failed to get default watermark: %w", err)
+	}
+
+	return watermark, nil
+}
+
+// SetDefault selects the watermark applied to a user's uploads, nil for none
+func (r *watermarkRepository) SetDefault(ctx context.Context, userID int64, id *int64) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE users SET watermark_id = $1, updated_at = NOW() WHERE id = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set default watermark: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user %d: %w", userID, model.ErrNotFound)
+	}
+
+	return nil
+}
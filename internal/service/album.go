@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/middleware"
+)
+
+// AlbumService manages albums. Owners manage their albums, other users can
+// only read public albums and see their public files.
+type AlbumService interface {
+	Create(ctx context.Context, album model.Album) (model.Album, error)
+	List(ctx context.Context, userID int64) ([]model.Album, error)
+	Get(ctx context.Context, id int64) (model.Album, error)
+	Update(ctx context.Context, id int64, album model.Album) (model.Album, error)
+	Delete(ctx context.Context, id int64) error
+	ListFiles(ctx context.Context, id int64, limit int, cursor string) (model.FileList, error)
+	AddFiles(ctx context.Context, id int64, files model.AlbumFiles) error
+	RemoveFile(ctx context.Context, id, fileID int64) error
+	Reorder(ctx context.Context, id int64, files model.AlbumFiles) error
+}
+
+// albumService implements AlbumService
+type albumService struct {
+	deps Deps
+}
+
+// NewAlbumService creates a new AlbumService
+func NewAlbumService(deps Deps) AlbumService {
+	return &albumService{
+		deps: deps,
+	}
+}
+
+// Create creates an album owned by the current user
+func (s *albumService) Create(ctx context.Context, album model.Album) (model.Album, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.Album{}, err
+	}
+
+	if err := album.Validate(); err != nil {
+		return model.Album{}, err
+	}
+	album.UserID = user.UserID
+
+	return s.deps.Repos.Album.Create(ctx, album)
+}
+
+// List lists the albums of a user, 0 for the current one. Only public
+// albums of other users are listed.
+func (s *albumService) List(ctx context.Context, userID int64) ([]model.Album, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if userID == 0 {
+		userID = user.UserID
+	}
+
+	return s.deps.Repos.Album.GetByUserID(ctx, userID, userID != user.UserID)
+}
+
+// Get gets an album the current user owns or that is public. Others do not
+// see the cover when it is a private file.
+func (s *albumService) Get(ctx context.Context, id int64) (model.Album, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.Album{}, err
+	}
+
+	album, err := s.deps.Repos.Album.GetByID(ctx, id)
+	if err != nil {
+		return model.Album{}, err
+	}
+
+	if album.UserID == user.UserID {
+		return album, nil
+	}
+	if !album.IsPublic {
+		return model.Album{}, model.ErrForbidden
+	}
+
+	if album.CoverFileID != nil {
+		cover, err := s.deps.Repos.Cr2.GetByID(ctx, *album.CoverFileID)
+		if err != nil || !cover.IsPublic {
+			album.CoverFileID = nil
+		}
+	}
+
+	return album, nil
+}
+
+// Update replaces the name, description, visibility and cover of an
+// album, the cover must be one of its files
+func (s *albumService) Update(ctx context.Context, id int64, album model.Album) (model.Album, error) {
+	current, err := s.owned(ctx, id)
+	if err != nil {
+		return model.Album{}, err
+	}
+
+	if err := album.Validate(); err != nil {
+		return model.Album{}, err
+	}
+
+	if album.CoverFileID != nil {
+		ok, err := s.deps.Repos.Album.HasFile(ctx, id, *album.CoverFileID)
+		if err != nil {
+			return model.Album{}, err
+		}
+		if !ok {
+			return model.Album{}, fmt.Errorf("%w: the cover must be a file of the album", model.ErrInvalidAlbum)
+		}
+	}
+
+	album.ID = current.ID
+	return s.deps.Repos.Album.Update(ctx, album)
+}
+
+// Delete deletes an album, its files are kept
+func (s *albumService) Delete(ctx context.Context, id int64) error {
+	if _, err := s.owned(ctx, id); err != nil {
+		return err
+	}
+
+	return s.deps.Repos.Album.Delete(ctx, id)
+}
+
+// ListFiles lists a page of an album's files in their manual order. The
+// page size defaults to and is capped by the pagination config.
+func (s *albumService) ListFiles(ctx context.Context, id int64, limit int, cursor string) (model.FileList, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.FileList{}, err
+	}
+
+	album, err := s.Get(ctx, id)
+	if err != nil {
+		return model.FileList{}, err
+	}
+
+	if limit <= 0 {
+		limit = s.deps.Config.Pagination.DefaultLimit
+	}
+	if limit > s.deps.Config.Pagination.MaxLimit {
+		limit = s.deps.Config.Pagination.MaxLimit
+	}
+
+	list, err := s.deps.Repos.Album.ListFiles(ctx, id, album.UserID != user.UserID, limit, cursor)
+	if err != nil {
+		return model.FileList{}, err
+	}
+
+	for i, file := range list.Files {
+		list.Files[i] = visibleFile(file, user.UserID)
+	}
+
+	return list, nil
+}
+
+// AddFiles appends some of the current user's files to one of their albums
+func (s *albumService) AddFiles(ctx context.Context, id int64, files model.AlbumFiles) error {
+	album, err := s.owned(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := files.Validate(); err != nil {
+		return err
+	}
+
+	return s.deps.Repos.Album.AddFiles(ctx, album, files.FileIDs)
+}
+
+// RemoveFile removes a file from an album, the file itself is kept
+func (s *albumService) RemoveFile(ctx context.Context, id, fileID int64) error {
+	if _, err := s.owned(ctx, id); err != nil {
+		return err
+	}
+
+	return s.deps.Repos.Album.RemoveFile(ctx, id, fileID)
+}
+
+// Reorder sets the order of an album's files
+func (s *albumService) Reorder(ctx context.Context, id int64, files model.AlbumFiles) error {
+	if _, err := s.owned(ctx, id); err != nil {
+		return err
+	}
+
+	if err := files.Validate(); err != nil {
+		return err
+	}
+
+	return s.deps.Repos.Album.Reorder(ctx, id, files.FileIDs)
+}
+
+// owned gets an album the current user owns
+func (s *albumService) owned(ctx context.Context, id int64) (model.Album, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.Album{}, err
+	}
+
+	album, err := s.deps.Repos.Album.GetByID(ctx, id)
+	if err != nil {
+		return model.Album{}, err
+	}
+
+	if album.UserID != user.UserID {
+		return model.Album{}, model.ErrForbidden
+	}
+
+	return album, nil
+}
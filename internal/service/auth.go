@@ -51,7 +51,7 @@ func (s *authService) Login(ctx context.Context, req model.LoginRequest) (model.
 	}
 
 	// Generate token
-	token, err := middleware.GenerateToken(user.ID, user.Email, s.jwtConfig)
+	token, err := middleware.GenerateToken(user.ID, user.Email, user.Role, s.jwtConfig)
 	if err != nil {
 		s.deps.Logger.Error("Failed to generate token", "error", err)
 		return model.AuthResponse{}, errors.New("failed to generate auth token")
@@ -101,7 +101,7 @@ func (s *authService) Register(ctx context.Context, req model.RegisterRequest) (
 		return model.AuthResponse{}, errors.New("Failed to create user")
 	}
 
-	token, err := middleware.GenerateToken(createdUser.ID, createdUser.Email, s.jwtConfig)
+	token, err := middleware.GenerateToken(createdUser.ID, createdUser.Email, createdUser.Role, s.jwtConfig)
 	if err != nil {
 		s.deps.Logger.Error("Failed to generate token", "error", err)
 		return model.AuthResponse{}, errors.New("failed to generate auth token")
@@ -1,35 +1,352 @@
 package service
 
 import (
+	"bufio"
+	"bytes"
 	"context"
-	"mime/multipart"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
 
 	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/imaging"
+	"github.com/adorufus/imgupper/pkg/middleware"
 )
 
 type Cr2Service interface {
-	ObjectUpload(ctx context.Context, req model.CR2UploadRequest, object multipart.File, handler *multipart.FileHeader) (model.CR2UploadResponse, error)
+	ObjectUpload(ctx context.Context, req model.CR2UploadRequest, body io.Reader) (model.CR2UploadResponse, error)
 	ObjectFetchById(ctx context.Context, id int64) (model.CR2UploadResponse, error)
-	ObjectFetchByUserId(ctx context.Context) ([]model.CR2UploadResponse, error)
+	ObjectFetchByUserId(ctx context.Context, opts model.FileListOptions) (model.FileList, error)
+	ObjectDelete(ctx context.Context, id int64) error
+	ObjectDownload(ctx context.Context, id int64) (model.FileContent, error)
+	ObjectMetadata(ctx context.Context, id int64) (model.FileMetadata, error)
+	ObjectSimilar(ctx context.Context, id int64, maxDistance, limit int) ([]model.SimilarFile, error)
+	ObjectSetTags(ctx context.Context, id int64, tags model.FileTags) (model.CR2UploadResponse, error)
+	ObjectSearch(ctx context.Context, opts model.SearchOptions) (model.FileList, error)
 }
 
 type cr2Service struct {
 	deps Deps
 }
 
-// ObjectFetchByUserId implements Cr2Service.
-func (s *cr2Service) ObjectFetchByUserId(ctx context.Context) ([]model.CR2UploadResponse, error) {
-	return s.deps.Repos.Cr2.GetByUserID(ctx)
+// ObjectFetchByUserId lists a page of the current user's files. The page
+// size defaults to and is capped by the pagination config.
+func (s *cr2Service) ObjectFetchByUserId(ctx context.Context, opts model.FileListOptions) (model.FileList, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.FileList{}, err
+	}
+
+	if err := opts.Validate(); err != nil {
+		return model.FileList{}, err
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = s.deps.Config.Pagination.DefaultLimit
+	}
+	if opts.Limit > s.deps.Config.Pagination.MaxLimit {
+		opts.Limit = s.deps.Config.Pagination.MaxLimit
+	}
+
+	return s.deps.Repos.Cr2.List(ctx, user.UserID, opts)
 }
 
 // ObjectFetchById implements Cr2Service.
 func (s *cr2Service) ObjectFetchById(ctx context.Context, id int64) (model.CR2UploadResponse, error) {
-	return s.deps.Repos.Cr2.GetByID(ctx, id)
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.CR2UploadResponse{}, err
+	}
+
+	file, err := s.deps.Repos.Cr2.GetByID(ctx, id)
+	if err != nil {
+		return model.CR2UploadResponse{}, err
+	}
+
+	if file.UserID != user.UserID && !file.IsPublic {
+		return model.CR2UploadResponse{}, model.ErrForbidden
+	}
+
+	return visibleFile(file, user.UserID), nil
+}
+
+// visibleFile hides the original of a watermarked file from everyone but
+// its owner, others only see the watermarked variants. The hash would give
+// away the blob key.
+func visibleFile(file model.CR2UploadResponse, userID int64) model.CR2UploadResponse {
+	if file.UserID != userID && file.Watermarked {
+		file.BucketURL = ""
+		file.ObjectKey = ""
+		file.SHA256 = ""
+	}
+	return file
 }
 
 // ObjectUpload implements Cr2Service.
-func (s *cr2Service) ObjectUpload(ctx context.Context, req model.CR2UploadRequest, object multipart.File, handler *multipart.FileHeader) (model.CR2UploadResponse, error) {
-	return s.deps.Repos.Cr2.Create(ctx, req, object, handler)
+func (s *cr2Service) ObjectUpload(ctx context.Context, req model.CR2UploadRequest, body io.Reader) (model.CR2UploadResponse, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.CR2UploadResponse{}, err
+	}
+
+	// The owner always comes from the token unless an admin uploads for someone else
+	req.UserID = user.UserID
+	onBehalf := req.OnBehalfOf != 0 && req.OnBehalfOf != user.UserID
+	if onBehalf {
+		if user.Role != model.RoleAdmin {
+			s.deps.Logger.Warn("Rejected upload on behalf of another user", "actor_id", user.UserID, "subject_user_id", req.OnBehalfOf)
+			err := s.deps.Repos.Audit.Record(ctx, model.AuditEntry{
+				ActorID:       user.UserID,
+				Action:        model.AuditUploadOnBehalfRejected,
+				SubjectUserID: req.OnBehalfOf,
+			})
+			if err != nil {
+				s.deps.Logger.Error("Failed to record audit entry", "error", err, "actor_id", user.UserID)
+			}
+			return model.CR2UploadResponse{}, model.ErrForbidden
+		}
+		req.UserID = req.OnBehalfOf
+		req.UploadedBy = user.UserID
+	}
+
+	privacy, err := resolvePrivacy(ctx, s.deps, req.UserID, req.MetadataPolicy, req.KeepOriginal)
+	if err != nil {
+		return model.CR2UploadResponse{}, err
+	}
+
+	req.Watermarked, err = hasWatermark(ctx, s.deps, req.UserID)
+	if err != nil {
+		return model.CR2UploadResponse{}, err
+	}
+
+	sniffer := bufio.NewReaderSize(&maxSizeReader{r: body, remaining: s.deps.Config.Upload.MaxSize}, uploadHeadLen)
+	head, err := sniffer.Peek(uploadHeadLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return model.CR2UploadResponse{}, err
+	}
+
+	// The stored type and key extension come from the content, never the client
+	req.ContentType, err = checkFileType(s.deps, head, req.ContentType)
+	if err != nil {
+		s.deps.Logger.Warn("Rejected upload by file type", "error", err, "user_id", req.UserID)
+		return model.CR2UploadResponse{}, err
+	}
+
+	if err := checkScrubbable(privacy, req.ContentType); err != nil {
+		return model.CR2UploadResponse{}, err
+	}
+
+	// Only headers are decoded here, GIF frames are counted as they stream by
+	format, err := checkImageHeader(s.deps, head)
+	if err != nil {
+		s.deps.Logger.Warn("Rejected upload by image limits", "error", err, "user_id", req.UserID)
+		return model.CR2UploadResponse{}, err
+	}
+	body = sniffer
+	if format == imaging.FormatGIF {
+		body = imaging.LimitFrames(sniffer, imageLimits(s.deps))
+	}
+
+	// Metadata is parsed from the upload as sent, only a scrubbed copy is stored
+	capture := &metadataCapture{r: body}
+	file, err := s.deps.Repos.Cr2.Create(ctx, req, capture, privacy)
+	if errors.Is(err, imaging.ErrLimitExceeded) || errors.Is(err, imaging.ErrMalformed) {
+		return model.CR2UploadResponse{}, imageLimitError(err)
+	}
+	if err != nil {
+		return model.CR2UploadResponse{}, scrubError(err)
+	}
+
+	meta, err := parseMetadata(bytes.NewReader(capture.head))
+	if err != nil {
+		s.deps.Logger.Warn("Failed to parse file metadata", "error", err, "id", file.ID)
+	}
+
+	file = processImage(ctx, s.deps, file, meta)
+
+	if onBehalf {
+		s.deps.Logger.Info("Admin upload on behalf of user", "actor_id", user.UserID, "subject_user_id", req.UserID, "file_id", file.ID)
+	}
+
+	return file, nil
+}
+
+// ObjectDownload opens the stored file for its owner, the only way to
+// reach the original of a watermarked file
+func (s *cr2Service) ObjectDownload(ctx context.Context, id int64) (model.FileContent, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.FileContent{}, err
+	}
+
+	file, err := s.deps.Repos.Cr2.GetByID(ctx, id)
+	if err != nil {
+		return model.FileContent{}, err
+	}
+
+	if file.UserID != user.UserID {
+		return model.FileContent{}, model.ErrForbidden
+	}
+
+	body, info, err := s.deps.Storage.Get(ctx, file.ObjectKey)
+	if err != nil {
+		return model.FileContent{}, err
+	}
+
+	return model.FileContent{
+		Body:        body,
+		ContentType: file.MimeType,
+		Size:        info.Size,
+		Filename:    file.Filename,
+	}, nil
+}
+
+// ObjectDelete implements Cr2Service.
+func (s *cr2Service) ObjectDelete(ctx context.Context, id int64) error {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	file, err := s.deps.Repos.Cr2.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if file.UserID != user.UserID {
+		return model.ErrForbidden
+	}
+
+	if err := s.deps.Repos.Cr2.Delete(ctx, file); err != nil {
+		var partial *model.PartialDeleteError
+		if errors.As(err, &partial) {
+			s.deps.Logger.Error("Partial file deletion", "error", err, "id", id, "failed_keys", partial.FailedKeys)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ObjectMetadata implements Cr2Service.
+func (s *cr2Service) ObjectMetadata(ctx context.Context, id int64) (model.FileMetadata, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.FileMetadata{}, err
+	}
+
+	file, err := s.ObjectFetchById(ctx, id)
+	if err != nil {
+		return model.FileMetadata{}, err
+	}
+
+	meta, err := s.deps.Repos.Metadata.GetByFileID(ctx, id)
+	if err != nil {
+		return model.FileMetadata{}, err
+	}
+
+	return visibleMetadata(meta, file, user.UserID), nil
+}
+
+// visibleMetadata hides where a photo was taken from everyone but its
+// owner. The raw XMP packet goes too, it can hold the location as well as
+// camera and lens serial numbers.
+func visibleMetadata(meta model.FileMetadata, file model.CR2UploadResponse, userID int64) model.FileMetadata {
+	if file.UserID != userID {
+		meta.GPS = nil
+		meta.XMP = ""
+	}
+	return meta
+}
+
+// ObjectSimilar implements Cr2Service. It returns the caller's images within
+// maxDistance of the perceptual hash of file id, the file itself excluded.
+// A negative maxDistance or a non-positive limit use the configured defaults.
+func (s *cr2Service) ObjectSimilar(ctx context.Context, id int64, maxDistance, limit int) ([]model.SimilarFile, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := s.ObjectFetchById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.PHash == "" {
+		return nil, fmt.Errorf("%w: file %d has no perceptual hash", model.ErrUnsupportedImage, id)
+	}
+	hash, err := strconv.ParseUint(file.PHash, 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid perceptual hash of file %d: %w", id, err)
+	}
+
+	if maxDistance < 0 {
+		maxDistance = s.deps.Config.Images.SimilarDistance
+	}
+	if limit <= 0 || limit > s.deps.Config.Images.SimilarLimit {
+		limit = s.deps.Config.Images.SimilarLimit
+	}
+
+	// One extra row makes room for the file itself
+	matches, err := s.deps.Repos.Cr2.FindSimilar(ctx, user.UserID, hash, maxDistance, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	similar := make([]model.SimilarFile, 0, len(matches))
+	for _, match := range matches {
+		if match.ID != id && len(similar) < limit {
+			similar = append(similar, match)
+		}
+	}
+
+	return similar, nil
+}
+
+// ObjectSetTags replaces the tags of one of the current user's files
+func (s *cr2Service) ObjectSetTags(ctx context.Context, id int64, tags model.FileTags) (model.CR2UploadResponse, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.CR2UploadResponse{}, err
+	}
+
+	file, err := s.deps.Repos.Cr2.GetByID(ctx, id)
+	if err != nil {
+		return model.CR2UploadResponse{}, err
+	}
+
+	if file.UserID != user.UserID {
+		return model.CR2UploadResponse{}, model.ErrForbidden
+	}
+
+	if err := tags.Normalize(); err != nil {
+		return model.CR2UploadResponse{}, err
+	}
+
+	return s.deps.Repos.Cr2.SetTags(ctx, id, tags.Tags)
+}
+
+// ObjectSearch searches the current user's files by filename, tags and
+// camera metadata. The page size defaults to and is capped by the
+// pagination config.
+func (s *cr2Service) ObjectSearch(ctx context.Context, opts model.SearchOptions) (model.FileList, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.FileList{}, err
+	}
+
+	if err := opts.Validate(); err != nil {
+		return model.FileList{}, err
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = s.deps.Config.Pagination.DefaultLimit
+	}
+	if opts.Limit > s.deps.Config.Pagination.MaxLimit {
+		opts.Limit = s.deps.Config.Pagination.MaxLimit
+	}
+
+	return s.deps.Repos.Cr2.Search(ctx, user.UserID, opts)
 }
 
 func NewCr2Srvice(deps Deps) Cr2Service {
@@ -37,3 +354,29 @@ func NewCr2Srvice(deps Deps) Cr2Service {
 		deps: deps,
 	}
 }
+
+// maxSizeReader fails with model.ErrFileTooLarge once more than remaining
+// bytes have been read, aborting the upload it feeds
+type maxSizeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	if m.remaining < 0 {
+		return 0, model.ErrFileTooLarge
+	}
+
+	// Read one byte past the limit so an exact-size file is still accepted
+	if int64(len(p)) > m.remaining+1 {
+		p = p[:m.remaining+1]
+	}
+
+	n, err := m.r.Read(p)
+	m.remaining -= int64(n)
+	if m.remaining < 0 {
+		return n, model.ErrFileTooLarge
+	}
+
+	return n, err
+}
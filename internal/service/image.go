@@ -0,0 +1,239 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"path"
+	"strings"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/internal/repository"
+	"github.com/adorufus/imgupper/pkg/exif"
+	"github.com/adorufus/imgupper/pkg/imaging"
+	"github.com/adorufus/imgupper/pkg/storage"
+)
+
+// processImage stores the metadata parsed from a freshly stored file before
+// it was scrubbed, nil when it had none, then decodes the file once and
+// derives everything that is computed from its pixels. Failures are logged
+// and leave the upload itself intact, so callers always get a usable file
+// back.
+func processImage(ctx context.Context, deps Deps, file model.CR2UploadResponse, meta *exif.Metadata) model.CR2UploadResponse {
+	var orientation int
+	if meta != nil {
+		storeMetadata(ctx, deps, file.ID, meta)
+		orientation = meta.Orientation
+	}
+
+	watermark, err := resolveWatermark(ctx, deps, file.UserID)
+	if err != nil {
+		// Display variants are never published without their watermark
+		deps.Logger.Error("Failed to load watermark", "error", err, "id", file.ID)
+		return file
+	}
+
+	// Deduplicated uploads share the variants already made for their blob,
+	// unless they need watermarked ones of their own
+	if len(file.VariantKeys) > 0 && watermark == nil {
+		return file
+	}
+
+	if imaging.FormatForMimeType(file.MimeType) == "" {
+		return processRAW(ctx, deps, file, orientation, watermark)
+	}
+
+	if file.Filesize > deps.Config.Images.MaxProcessSize {
+		return file
+	}
+
+	object, _, err := deps.Storage.Get(ctx, file.ObjectKey)
+	if err != nil {
+		deps.Logger.Error("Failed to read image for processing", "error", err, "id", file.ID)
+		return file
+	}
+	defer object.Close()
+
+	img, format, err := imaging.DecodeLimited(object, imageLimits(deps))
+	if err != nil {
+		deps.Logger.Warn("Uploaded image could not be decoded", "error", err, "id", file.ID)
+		return file
+	}
+
+	file = storeImageInfo(ctx, deps, file, img, format, orientation)
+	file, img = describeImage(ctx, deps, file, img, orientation)
+
+	keys := generateVariants(ctx, deps, file, img, format, watermark)
+	if len(keys) == 0 {
+		return file
+	}
+
+	updated, err := deps.Repos.Cr2.SetVariants(ctx, file.ID, keys, watermark != nil)
+	if err != nil {
+		deps.Logger.Error("Failed to record image variants", "error", err, "id", file.ID)
+		return file
+	}
+
+	return updated
+}
+
+// storeImageInfo records the displayed size and orientation of an image
+// and, for GIFs, walks the stream to time the animation
+func storeImageInfo(ctx context.Context, deps Deps, file model.CR2UploadResponse, img image.Image, format string, orientation int) model.CR2UploadResponse {
+	info := model.ImageInfo{Orientation: orientation}
+	info.Width, info.Height = imaging.OrientedSize(img.Bounds().Dx(), img.Bounds().Dy(), orientation)
+
+	if format == imaging.FormatGIF {
+		animation, err := inspectGIF(ctx, deps, file.ObjectKey)
+		if err != nil {
+			deps.Logger.Warn("Failed to inspect GIF animation", "error", err, "id", file.ID)
+		} else if animation.Frames > 1 {
+			info.Animated = true
+			info.DurationMS = int(animation.Duration.Milliseconds())
+		}
+	}
+
+	updated, err := deps.Repos.Cr2.SetImageInfo(ctx, file.ID, info)
+	if err != nil {
+		deps.Logger.Error("Failed to record image info", "error", err, "id", file.ID)
+		return file
+	}
+	return updated
+}
+
+func inspectGIF(ctx context.Context, deps Deps, key string) (imaging.Animation, error) {
+	object, _, err := deps.Storage.Get(ctx, key)
+	if err != nil {
+		return imaging.Animation{}, err
+	}
+	defer object.Close()
+
+	return imaging.InspectGIF(object, imageLimits(deps))
+}
+
+// describeImage stores the perceptual hash and placeholders, computed from
+// the upright image so they match what clients display. It also returns
+// the image variants are made from, upright only with auto-orientation on.
+func describeImage(ctx context.Context, deps Deps, file model.CR2UploadResponse, img image.Image, orientation int) (model.CR2UploadResponse, image.Image) {
+	upright := imaging.Orient(img, orientation)
+
+	file = storePHash(ctx, deps, file, upright)
+	file = storePlaceholder(ctx, deps, file, upright)
+
+	if deps.Config.Images.AutoOrient {
+		return file, upright
+	}
+	return file, img
+}
+
+// storePHash records the perceptual hash used to find near-duplicates
+func storePHash(ctx context.Context, deps Deps, file model.CR2UploadResponse, img image.Image) model.CR2UploadResponse {
+	updated, err := deps.Repos.Cr2.SetPHash(ctx, file.ID, imaging.DHash(img))
+	if err != nil {
+		deps.Logger.Error("Failed to record perceptual hash", "error", err, "id", file.ID)
+		return file
+	}
+	return updated
+}
+
+// placeholderSource is the width placeholders are computed from, enough
+// for their detail and cheap to scan repeatedly
+const placeholderSource = 64
+
+// storePlaceholder records the BlurHash, inline preview and colours
+// clients show while the image loads
+func storePlaceholder(ctx context.Context, deps Deps, file model.CR2UploadResponse, img image.Image) model.CR2UploadResponse {
+	small := img
+	if img.Bounds().Dx() > placeholderSource {
+		small = imaging.ResizeToWidth(img, placeholderSource)
+	}
+
+	xComponents, yComponents := imaging.BlurHashComponents(small)
+	blurHash, err := imaging.BlurHash(small, xComponents, yComponents)
+	if err != nil {
+		deps.Logger.Warn("Failed to compute BlurHash", "error", err, "id", file.ID)
+		return file
+	}
+
+	lqip, err := imaging.LQIP(small, deps.Config.Images.LQIPSize, deps.Config.Images.JPEGQuality)
+	if err != nil {
+		deps.Logger.Warn("Failed to encode placeholder image", "error", err, "id", file.ID)
+		return file
+	}
+
+	dominant, average := imaging.Colors(small)
+
+	updated, err := deps.Repos.Cr2.SetPlaceholder(ctx, file.ID, model.Placeholder{
+		BlurHash:      blurHash,
+		LQIP:          lqip,
+		DominantColor: imaging.HexColor(dominant),
+		AverageColor:  imaging.HexColor(average),
+	})
+	if err != nil {
+		deps.Logger.Error("Failed to record placeholder", "error", err, "id", file.ID)
+		return file
+	}
+	return updated
+}
+
+// generateVariants stores a resized copy for every configured width smaller
+// than the original and returns their object keys by variant name
+func generateVariants(ctx context.Context, deps Deps, file model.CR2UploadResponse, img image.Image, format string, watermark *imaging.Watermark) map[string]string {
+	outFormat := imaging.VariantFormat(format)
+	keys := make(map[string]string)
+
+	for _, width := range deps.Config.Images.Variants {
+		// Never upscale, clients fall back to the original
+		if width <= 0 || width >= img.Bounds().Dx() {
+			continue
+		}
+
+		var resized image.Image = imaging.ResizeToWidth(img, width)
+		if watermark != nil {
+			resized = watermark.Apply(resized)
+		}
+
+		name := fmt.Sprintf("w%d", width)
+		key := variantObjectKey(file, name, outFormat, watermark != nil)
+		if err := putImage(ctx, deps, key, resized, outFormat); err != nil {
+			deps.Logger.Error("Failed to store image variant", "error", err, "id", file.ID, "width", width)
+			continue
+		}
+
+		keys[name] = key
+	}
+
+	return keys
+}
+
+// putImage encodes img and stores it publicly at key
+func putImage(ctx context.Context, deps Deps, key string, img image.Image, format string) error {
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, format, deps.Config.Images.JPEGQuality); err != nil {
+		return err
+	}
+
+	return deps.Storage.Put(ctx, key, &buf, storage.PutOptions{
+		ContentType:   imaging.MimeType(format),
+		ContentLength: int64(buf.Len()),
+		Public:        true,
+	})
+}
+
+// variantObjectKey is where a variant of file is stored: next to the
+// original, shared by the files of its blob, or in the file's own scope
+// when watermarked
+func variantObjectKey(file model.CR2UploadResponse, name, format string, watermarked bool) string {
+	if watermarked {
+		return repository.WatermarkScope(file.ID) + "/" + name + imaging.Extension(format)
+	}
+	return variantKey(file.ObjectKey, name, format)
+}
+
+// variantKey derives the key of a variant stored next to the original,
+// e.g. u/1/uploads/abc.png becomes u/1/uploads/abc_w640.png
+func variantKey(originalKey, name, format string) string {
+	base := strings.TrimSuffix(originalKey, path.Ext(originalKey))
+	return base + "_" + name + imaging.Extension(format)
+}
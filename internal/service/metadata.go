@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/exif"
+)
+
+// metadataCapture keeps the leading bytes of an upload as they stream by,
+// so its metadata can be parsed although only a scrubbed copy is stored
+type metadataCapture struct {
+	r    io.Reader
+	head []byte
+}
+
+func (c *metadataCapture) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if room := exif.MaxScanSize - len(c.head); room > 0 {
+		c.head = append(c.head, p[:min(n, room)]...)
+	}
+	return n, err
+}
+
+// parseMetadata parses the EXIF and XMP blocks of an upload as it was
+// sent, before scrubbing removes them; nil for files without metadata
+func parseMetadata(r io.Reader) (*exif.Metadata, error) {
+	meta, err := exif.Decode(r)
+	if errors.Is(err, exif.ErrNoMetadata) {
+		return nil, nil
+	}
+	return meta, err
+}
+
+// readStoredMetadata parses the metadata of an upload that reached the
+// bucket directly, before it is scrubbed. Failures are only logged.
+func readStoredMetadata(ctx context.Context, deps Deps, key string) *exif.Metadata {
+	object, _, err := deps.Storage.Get(ctx, key)
+	if err != nil {
+		deps.Logger.Error("Failed to read file for metadata extraction", "error", err, "key", key)
+		return nil
+	}
+	defer object.Close()
+
+	meta, err := parseMetadata(object)
+	if err != nil {
+		deps.Logger.Warn("Failed to parse file metadata", "error", err, "key", key)
+	}
+	return meta
+}
+
+// storeMetadata records the metadata parsed from an upload in
+// file_metadata, where only the owner sees the location and XMP
+func storeMetadata(ctx context.Context, deps Deps, fileID int64, meta *exif.Metadata) {
+	if meta == nil {
+		return
+	}
+	if _, err := deps.Repos.Metadata.Upsert(ctx, toFileMetadata(fileID, meta)); err != nil {
+		deps.Logger.Error("Failed to store file metadata", "error", err, "id", fileID)
+	}
+}
+
+// toFileMetadata maps parsed metadata to its stored form, dropping unknown values
+func toFileMetadata(fileID int64, meta *exif.Metadata) model.FileMetadata {
+	stored := model.FileMetadata{
+		FileID:       fileID,
+		CameraMake:   meta.Make,
+		CameraModel:  meta.Model,
+		LensModel:    meta.LensModel,
+		Software:     meta.Software,
+		ExposureTime: meta.ExposureTime,
+		XMP:          meta.XMP,
+	}
+
+	if meta.FNumber > 0 {
+		stored.FNumber = &meta.FNumber
+	}
+	if meta.FocalLength > 0 {
+		stored.FocalLength = &meta.FocalLength
+	}
+	if meta.ISO > 0 {
+		stored.ISO = &meta.ISO
+	}
+	if !meta.CapturedAt.IsZero() {
+		stored.CapturedAt = &meta.CapturedAt
+	}
+	if meta.GPS != nil {
+		stored.GPS = &model.GPS{
+			Latitude:  meta.GPS.Latitude,
+			Longitude: meta.GPS.Longitude,
+			Altitude:  meta.GPS.Altitude,
+		}
+	}
+
+	return stored
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"time"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/middleware"
+	"github.com/adorufus/imgupper/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// PresignService defines the direct-to-bucket upload service interface
+type PresignService interface {
+	Presign(ctx context.Context, req model.PresignRequest) (model.PresignResponse, error)
+	Complete(ctx context.Context, ticketID string) (model.CR2UploadResponse, error)
+	PurgeExpired(ctx context.Context) (int, error)
+}
+
+// presignService implements PresignService
+type presignService struct {
+	deps Deps
+}
+
+// NewPresignService creates a new PresignService
+func NewPresignService(deps Deps) PresignService {
+	return &presignService{
+		deps: deps,
+	}
+}
+
+// Presign issues a presigned PUT URL and the ticket needed to finalize it
+func (s *presignService) Presign(ctx context.Context, req model.PresignRequest) (model.PresignResponse, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.PresignResponse{}, err
+	}
+
+	if err := req.Validate(); err != nil {
+		return model.PresignResponse{}, err
+	}
+
+	if req.Filesize > s.deps.Config.Upload.MaxSize {
+		return model.PresignResponse{}, model.ErrFileTooLarge
+	}
+
+	ttl := s.deps.Config.Upload.PresignExpiration
+	contentType, err := declaredContentType(s.deps, req.ContentType)
+	if err != nil {
+		return model.PresignResponse{}, err
+	}
+
+	key := s.deps.Repos.Cr2.NewObjectKey(user.UserID, contentType)
+
+	url, err := s.deps.Storage.PresignPut(ctx, key, contentType, ttl)
+	if err != nil {
+		return model.PresignResponse{}, err
+	}
+
+	ticket, err := s.deps.Repos.Ticket.Create(ctx, model.UploadTicket{
+		ID:        uuid.New().String(),
+		UserID:    user.UserID,
+		ObjectKey: key,
+		Filename:  req.Filename,
+		MimeType:  contentType,
+		Filesize:  req.Filesize,
+		IsPublic:  req.IsPublic,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return model.PresignResponse{}, err
+	}
+
+	return model.PresignResponse{
+		Ticket:    ticket.ID,
+		UploadURL: url,
+		Method:    "PUT",
+		Headers:   map[string]string{"Content-Type": contentType},
+		ExpiresAt: ticket.ExpiresAt,
+	}, nil
+}
+
+// Complete verifies the uploaded object against its ticket and records the file
+func (s *presignService) Complete(ctx context.Context, ticketID string) (model.CR2UploadResponse, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.CR2UploadResponse{}, err
+	}
+
+	ticket, err := s.deps.Repos.Ticket.GetByID(ctx, ticketID)
+	if err != nil {
+		return model.CR2UploadResponse{}, err
+	}
+
+	if ticket.UserID != user.UserID {
+		return model.CR2UploadResponse{}, model.ErrForbidden
+	}
+
+	if ticket.ClaimedAt != nil {
+		return model.CR2UploadResponse{}, fmt.Errorf("upload ticket %s: %w", ticket.ID, model.ErrNotFound)
+	}
+
+	if time.Now().After(ticket.ExpiresAt) {
+		return model.CR2UploadResponse{}, model.ErrUploadExpired
+	}
+
+	if _, err := s.deps.Storage.Head(ctx, ticket.ObjectKey); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return model.CR2UploadResponse{}, model.ErrUploadIncomplete
+		}
+		return model.CR2UploadResponse{}, err
+	}
+
+	// Claiming the ticket makes this the only completion of the upload, a
+	// failure from here on discards it and the client has to start over.
+	// The claimed ticket stays until it expires, so the purge deletes
+	// anything still PUT to its URL.
+	ticket, err = s.deps.Repos.Ticket.Claim(ctx, ticket.ID)
+	if err != nil {
+		return model.CR2UploadResponse{}, err
+	}
+
+	// The presigned URL stays valid until it expires, so the upload is
+	// checked and recorded from a copy the client cannot overwrite
+	key := s.deps.Repos.Cr2.NewObjectKey(ticket.UserID, ticket.MimeType)
+	if err := s.deps.Storage.Copy(ctx, ticket.ObjectKey, key, storage.PutOptions{}); err != nil {
+		deleteObjects(ctx, s.deps, ticket.ObjectKey)
+		return model.CR2UploadResponse{}, err
+	}
+	deleteObjects(ctx, s.deps, ticket.ObjectKey)
+
+	info, err := s.deps.Storage.Head(ctx, key)
+	if err != nil {
+		deleteObjects(ctx, s.deps, key)
+		return model.CR2UploadResponse{}, err
+	}
+
+	if err := validateTicketObject(ticket, info); err != nil {
+		deleteObjects(ctx, s.deps, key)
+		return model.CR2UploadResponse{}, err
+	}
+
+	mimeType, err := checkStoredUpload(ctx, s.deps, key, ticket.MimeType)
+	if err != nil {
+		if isRejectedUpload(err) {
+			s.deps.Logger.Warn("Rejected direct upload", "error", err, "ticket", ticket.ID)
+		}
+		deleteObjects(ctx, s.deps, key)
+		return model.CR2UploadResponse{}, err
+	}
+
+	privacy, err := resolvePrivacy(ctx, s.deps, ticket.UserID, "", nil)
+	if err != nil {
+		deleteObjects(ctx, s.deps, key)
+		return model.CR2UploadResponse{}, err
+	}
+
+	if err := checkScrubbable(privacy, mimeType); err != nil {
+		deleteObjects(ctx, s.deps, key)
+		return model.CR2UploadResponse{}, err
+	}
+
+	watermarked, err := hasWatermark(ctx, s.deps, ticket.UserID)
+	if err != nil {
+		deleteObjects(ctx, s.deps, key)
+		return model.CR2UploadResponse{}, err
+	}
+
+	meta := readStoredMetadata(ctx, s.deps, key)
+
+	file, err := scrubStoredObject(ctx, s.deps, model.CR2UploadResponse{
+		UserID:      ticket.UserID,
+		Filename:    ticket.Filename,
+		Filesize:    info.Size,
+		MimeType:    mimeType,
+		ObjectKey:   key,
+		IsPublic:    ticket.IsPublic,
+		Watermarked: watermarked,
+	}, privacy)
+	if err != nil {
+		deleteObjects(ctx, s.deps, key)
+		return model.CR2UploadResponse{}, err
+	}
+
+	created, err := s.deps.Repos.Cr2.CreateRecord(ctx, file)
+	if err != nil {
+		if file.ObjectKey != key {
+			deleteObjects(ctx, s.deps, file.ObjectKey, file.OriginalKey)
+		}
+		deleteObjects(ctx, s.deps, key)
+		return model.CR2UploadResponse{}, err
+	}
+
+	if file.ObjectKey != key {
+		deleteObjects(ctx, s.deps, key)
+	}
+
+	return processImage(ctx, s.deps, created, meta), nil
+}
+
+// PurgeExpired removes expired tickets, claimed ones included, along with
+// any object uploaded for them
+func (s *presignService) PurgeExpired(ctx context.Context) (int, error) {
+	tickets, err := s.deps.Repos.Ticket.ListExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	for _, ticket := range tickets {
+		s.discard(ctx, ticket)
+	}
+
+	return len(tickets), nil
+}
+
+// discard deletes a ticket and its object
+func (s *presignService) discard(ctx context.Context, ticket model.UploadTicket) {
+	if err := s.deps.Storage.Delete(ctx, ticket.ObjectKey); err != nil {
+		s.deps.Logger.Warn("Failed to delete unfinished upload", "error", err, "key", ticket.ObjectKey)
+	}
+
+	if err := s.deps.Repos.Ticket.Delete(ctx, ticket.ID); err != nil {
+		s.deps.Logger.Warn("Failed to delete upload ticket", "error", err, "ticket", ticket.ID)
+	}
+}
+
+// validateTicketObject checks the uploaded object matches what the ticket announced
+func validateTicketObject(ticket model.UploadTicket, info storage.ObjectInfo) error {
+	if info.Size != ticket.Filesize {
+		return fmt.Errorf("%w: expected %d bytes, got %d", model.ErrUploadInvalid, ticket.Filesize, info.Size)
+	}
+
+	if info.ContentType != "" && mediaType(info.ContentType) != mediaType(ticket.MimeType) {
+		return fmt.Errorf("%w: expected content type %s, got %s", model.ErrUploadInvalid, ticket.MimeType, info.ContentType)
+	}
+
+	return nil
+}
+
+// mediaType strips parameters from a content type
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mt
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adorufus/imgupper/config"
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/internal/repository"
+	"github.com/adorufus/imgupper/pkg/middleware"
+	"github.com/adorufus/imgupper/pkg/storage"
+)
+
+// fakeTicketRepository keeps upload tickets in memory
+type fakeTicketRepository struct {
+	repository.TicketRepository
+	tickets map[string]model.UploadTicket
+}
+
+func (r *fakeTicketRepository) GetByID(ctx context.Context, id string) (model.UploadTicket, error) {
+	ticket, ok := r.tickets[id]
+	if !ok {
+		return model.UploadTicket{}, model.ErrNotFound
+	}
+	return ticket, nil
+}
+
+func (r *fakeTicketRepository) Claim(ctx context.Context, id string) (model.UploadTicket, error) {
+	ticket, ok := r.tickets[id]
+	if !ok || ticket.ClaimedAt != nil {
+		return model.UploadTicket{}, model.ErrNotFound
+	}
+	now := time.Now()
+	ticket.ClaimedAt = &now
+	r.tickets[id] = ticket
+	return ticket, nil
+}
+
+func (r *fakeTicketRepository) Delete(ctx context.Context, id string) error {
+	delete(r.tickets, id)
+	return nil
+}
+
+func (r *fakeTicketRepository) ListExpired(ctx context.Context, now time.Time) ([]model.UploadTicket, error) {
+	var tickets []model.UploadTicket
+	for _, ticket := range r.tickets {
+		if ticket.ExpiresAt.Before(now) {
+			tickets = append(tickets, ticket)
+		}
+	}
+	return tickets, nil
+}
+
+// fakeCr2Repository only hands out object keys
+type fakeCr2Repository struct {
+	repository.Cr2Repository
+	keys int
+}
+
+func (r *fakeCr2Repository) NewObjectKey(userID int64, mimeType string) string {
+	r.keys++
+	return fmt.Sprintf("u/%d/uploads/%d.jpg", userID, r.keys)
+}
+
+func TestPresignCompleteKeepsClaimedTicket(t *testing.T) {
+	ctx := context.WithValue(context.Background(), middleware.UserKey, &middleware.UserClaims{UserID: 1})
+	store := storage.NewMemoryBackend()
+	tickets := &fakeTicketRepository{tickets: map[string]model.UploadTicket{
+		"ticket": {
+			ID:        "ticket",
+			UserID:    1,
+			ObjectKey: "u/1/uploads/ticket.jpg",
+			Filename:  "photo.jpg",
+			MimeType:  "image/jpeg",
+			Filesize:  100,
+			ExpiresAt: time.Now().Add(time.Hour),
+		},
+	}}
+	s := NewPresignService(Deps{
+		Repos:   &repository.Repositories{Ticket: tickets, Cr2: &fakeCr2Repository{}},
+		Logger:  nopLogger{},
+		Config:  &config.Config{},
+		Storage: store,
+	})
+
+	put := func(size int) {
+		t.Helper()
+		err := store.Put(ctx, "u/1/uploads/ticket.jpg", bytes.NewReader(make([]byte, size)), storage.PutOptions{
+			ContentType:   "image/jpeg",
+			ContentLength: int64(size),
+		})
+		if err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	objects := func() int {
+		t.Helper()
+		infos, err := store.List(ctx, "")
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		return len(infos)
+	}
+
+	// The upload does not match the ticket and is discarded
+	put(10)
+	if _, err := s.Complete(ctx, "ticket"); !errors.Is(err, model.ErrUploadInvalid) {
+		t.Fatalf("Complete() error = %v, want ErrUploadInvalid", err)
+	}
+	if n := objects(); n != 0 {
+		t.Errorf("%d objects left after a failed completion, want 0", n)
+	}
+
+	// A late PUT to the still valid URL cannot complete the ticket again
+	put(100)
+	if _, err := s.Complete(ctx, "ticket"); !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("second Complete() error = %v, want ErrNotFound", err)
+	}
+
+	// and is purged with the ticket once it expires
+	ticket := tickets.tickets["ticket"]
+	ticket.ExpiresAt = time.Now().Add(-time.Minute)
+	tickets.tickets["ticket"] = ticket
+
+	purged, err := s.PurgeExpired(ctx)
+	if err != nil {
+		t.Fatalf("PurgeExpired() error = %v", err)
+	}
+	if purged != 1 || len(tickets.tickets) != 0 {
+		t.Errorf("purged %d tickets, %d left, want 1, 0", purged, len(tickets.tickets))
+	}
+	if n := objects(); n != 0 {
+		t.Errorf("%d objects left after the purge, want 0", n)
+	}
+}
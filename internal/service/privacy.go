@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/internal/repository"
+	"github.com/adorufus/imgupper/pkg/exif"
+	"github.com/adorufus/imgupper/pkg/storage"
+)
+
+// resolvePrivacy combines the per-upload choice, the owner's settings and
+// the server default, in that order of precedence
+func resolvePrivacy(ctx context.Context, deps Deps, userID int64, policy string, keepOriginal *bool) (model.PrivacySettings, error) {
+	requested := model.PrivacySettings{MetadataPolicy: policy}
+	if err := requested.Validate(); err != nil {
+		return model.PrivacySettings{}, err
+	}
+
+	settings, err := deps.Repos.User.GetPrivacy(ctx, userID)
+	if err != nil {
+		return model.PrivacySettings{}, err
+	}
+
+	if settings.MetadataPolicy == "" {
+		settings.MetadataPolicy = deps.Config.Upload.MetadataPolicy
+	}
+	if policy != "" {
+		settings.MetadataPolicy = policy
+	}
+	if keepOriginal != nil {
+		settings.KeepOriginal = *keepOriginal
+	} else if !settings.KeepOriginal {
+		settings.KeepOriginal = deps.Config.Upload.KeepOriginal
+	}
+
+	return settings, nil
+}
+
+// checkScrubbable refuses files of a type whose metadata cannot be removed
+// when the privacy settings ask for it, rather than storing them as is
+func checkScrubbable(privacy model.PrivacySettings, mimeType string) error {
+	if privacy.MetadataPolicy == model.MetadataKeep || exif.CanScrub(mimeType) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", model.ErrMetadataNotScrubbable, mimeType)
+}
+
+// scrubError maps a file the scrubber gave up on to the model error
+func scrubError(err error) error {
+	if errors.Is(err, exif.ErrUnscrubbable) {
+		return fmt.Errorf("%w: %v", model.ErrMetadataNotScrubbable, err)
+	}
+	return err
+}
+
+// scrubStoredObject scrubs a file that reached the bucket without passing
+// through the server, as with tus and presigned uploads. The scrubbed copy
+// gets a new key and the upload is copied to a private original key when
+// it is kept. The upload itself is left for the caller to delete once the
+// file is recorded, so a failed attempt can be retried.
+func scrubStoredObject(ctx context.Context, deps Deps, file model.CR2UploadResponse, privacy model.PrivacySettings) (model.CR2UploadResponse, error) {
+	if privacy.MetadataPolicy == model.MetadataKeep || !exif.CanScrub(file.MimeType) {
+		return file, nil
+	}
+
+	object, _, err := deps.Storage.Get(ctx, file.ObjectKey)
+	if err != nil {
+		return file, err
+	}
+	defer object.Close()
+
+	scrubbed := exif.NewScrubReader(object, exif.Policy(privacy.MetadataPolicy))
+	defer scrubbed.Close()
+
+	key := deps.Repos.Cr2.NewObjectKey(file.UserID, file.MimeType)
+	err = deps.Storage.Put(ctx, key, scrubbed, storage.PutOptions{
+		ContentType:   file.MimeType,
+		ContentLength: -1,
+	})
+	if err != nil {
+		return file, scrubError(fmt.Errorf("failed to store scrubbed file: %w", err))
+	}
+
+	info, err := deps.Storage.Head(ctx, key)
+	if err != nil {
+		return file, err
+	}
+
+	if privacy.KeepOriginal {
+		originalKey := repository.OriginalObjectKey(key)
+		err := deps.Storage.Copy(ctx, file.ObjectKey, originalKey, storage.PutOptions{ContentType: file.MimeType})
+		if err != nil {
+			return file, errors.Join(fmt.Errorf("failed to keep original: %w", err), deps.Storage.Delete(ctx, key))
+		}
+		file.OriginalKey = originalKey
+	}
+
+	file.ObjectKey = key
+	file.Filesize = info.Size
+	return file, nil
+}
+
+// deleteObjects removes objects left over by an upload, failures are only
+// logged
+func deleteObjects(ctx context.Context, deps Deps, keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := deps.Storage.Delete(ctx, key); err != nil {
+			deps.Logger.Warn("Failed to delete upload object", "error", err, "key", key)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/internal/repository"
+	"github.com/adorufus/imgupper/pkg/exif"
+	"github.com/adorufus/imgupper/pkg/imaging"
+	"github.com/adorufus/imgupper/pkg/storage"
+)
+
+// processRAW recognises camera RAW uploads regardless of the Content-Type
+// the client sent, corrects their MIME type and stores the embedded JPEG
+// preview as the display variant, with the resized variants made from it.
+// The preview is stored stripped of all metadata but its orientation; with a
+// watermark the file gets a watermarked preview of its own and the extracted
+// one is kept private.
+func processRAW(ctx context.Context, deps Deps, file model.CR2UploadResponse, orientation int, watermark *imaging.Watermark) model.CR2UploadResponse {
+	object, _, err := deps.Storage.Get(ctx, file.ObjectKey)
+	if err != nil {
+		deps.Logger.Error("Failed to read file for RAW detection", "error", err, "id", file.ID)
+		return file
+	}
+	raw, err := exif.DetectRAW(object)
+	object.Close()
+	if err != nil {
+		if !errors.Is(err, exif.ErrNotRAW) {
+			deps.Logger.Warn("Failed to inspect file", "error", err, "id", file.ID)
+		}
+		return file
+	}
+
+	if mimeType := exif.RAWMimeType(raw.Format); file.MimeType != mimeType {
+		updated, err := deps.Repos.Cr2.SetMimeType(ctx, file.ID, mimeType)
+		if err != nil {
+			deps.Logger.Error("Failed to correct RAW mime type", "error", err, "id", file.ID)
+		} else {
+			file = updated
+		}
+	}
+
+	if raw.PreviewLength == 0 || raw.PreviewLength > deps.Config.Images.MaxProcessSize {
+		deps.Logger.Info("RAW file has no usable preview", "id", file.ID, "format", raw.Format)
+		return file
+	}
+
+	preview, err := readRAWPreview(ctx, deps, file.ObjectKey, raw)
+	if err != nil {
+		deps.Logger.Warn("Failed to extract RAW preview", "error", err, "id", file.ID)
+		return file
+	}
+
+	// The preview carries the camera's own EXIF block, GPS included
+	var scrubbed bytes.Buffer
+	if err := exif.Scrub(&scrubbed, bytes.NewReader(preview), exif.PolicyStripAll); err != nil {
+		deps.Logger.Warn("Failed to scrub RAW preview", "error", err, "id", file.ID)
+		return file
+	}
+	preview = scrubbed.Bytes()
+
+	img, _, err := imaging.DecodeLimited(bytes.NewReader(preview), imageLimits(deps))
+	if err != nil {
+		deps.Logger.Warn("RAW preview could not be decoded", "error", err, "id", file.ID)
+		return file
+	}
+
+	// With a watermark the clean preview is only kept privately, as the
+	// source renderings are made from
+	previewKey := variantKey(file.ObjectKey, model.VariantPreview, imaging.FormatJPEG)
+	if watermark != nil {
+		previewKey = repository.WatermarkSourceKey(file.ID)
+	}
+	err = deps.Storage.Put(ctx, previewKey, bytes.NewReader(preview), storage.PutOptions{
+		ContentType:   imaging.MimeType(imaging.FormatJPEG),
+		ContentLength: int64(len(preview)),
+		Public:        watermark == nil,
+	})
+	if err != nil {
+		deps.Logger.Error("Failed to store RAW preview", "error", err, "id", file.ID)
+		return file
+	}
+
+	file = storeImageInfo(ctx, deps, file, img, imaging.FormatJPEG, orientation)
+	file, img = describeImage(ctx, deps, file, img, orientation)
+
+	keys := generateVariants(ctx, deps, file, img, imaging.FormatJPEG, watermark)
+	keys[model.VariantPreview] = previewKey
+
+	if watermark != nil {
+		key := variantObjectKey(file, model.VariantPreview, imaging.FormatJPEG, true)
+		if err := putImage(ctx, deps, key, watermark.Apply(img), imaging.FormatJPEG); err != nil {
+			deps.Logger.Error("Failed to store watermarked RAW preview", "error", err, "id", file.ID)
+			return file
+		}
+		keys[model.VariantPreview] = key
+	}
+
+	updated, err := deps.Repos.Cr2.SetVariants(ctx, file.ID, keys, watermark != nil)
+	if err != nil {
+		deps.Logger.Error("Failed to record image variants", "error", err, "id", file.ID)
+		return file
+	}
+
+	return updated
+}
+
+// readRAWPreview reads the embedded preview by skipping to its offset, the
+// storage backends only stream objects from the start
+func readRAWPreview(ctx context.Context, deps Deps, key string, raw *exif.RAW) ([]byte, error) {
+	object, _, err := deps.Storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	if _, err := io.CopyN(io.Discard, object, raw.PreviewOffset); err != nil {
+		return nil, err
+	}
+
+	preview := make([]byte, raw.PreviewLength)
+	if _, err := io.ReadFull(object, preview); err != nil {
+		return nil, err
+	}
+
+	return preview, nil
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/internal/repository"
+	"github.com/adorufus/imgupper/pkg/imaging"
+	"github.com/adorufus/imgupper/pkg/middleware"
+	"github.com/adorufus/imgupper/pkg/storage"
+	"github.com/adorufus/imgupper/pkg/urlsign"
+)
+
+// ImageService defines the on-the-fly image rendering interface
+type ImageService interface {
+	Render(ctx context.Context, id int64, opts imaging.TransformOptions, sig model.ImageSignature) (model.RenderedImage, error)
+	SignURL(ctx context.Context, id int64, opts imaging.TransformOptions, ttl time.Duration) (model.SignedURL, error)
+}
+
+// imageService implements ImageService
+type imageService struct {
+	deps Deps
+}
+
+// NewImageService creates a new ImageService
+func NewImageService(deps Deps) ImageService {
+	return &imageService{
+		deps: deps,
+	}
+}
+
+// Render returns the requested rendering of an image, serving it from the
+// bucket cache when it was rendered before. A valid signature grants access
+// to private files, unsigned requests only reach public ones and only when
+// signatures are not required. Renderings of watermarked files carry the
+// owner's current watermark.
+func (s *imageService) Render(ctx context.Context, id int64, opts imaging.TransformOptions, sig model.ImageSignature) (model.RenderedImage, error) {
+	signed := sig.Value != ""
+	if signed {
+		if err := s.verifySignature(id, opts, sig); err != nil {
+			return model.RenderedImage{}, err
+		}
+	} else if s.deps.Config.Images.RequireSignature {
+		return model.RenderedImage{}, model.ErrInvalidSignature
+	}
+
+	file, err := s.deps.Repos.Cr2.GetByID(ctx, id)
+	if err != nil {
+		return model.RenderedImage{}, err
+	}
+
+	if !signed && !file.IsPublic {
+		return model.RenderedImage{}, model.ErrForbidden
+	}
+
+	sourceKey := file.ObjectKey
+	sourceFormat := imaging.FormatForMimeType(file.MimeType)
+	if previewKey, ok := file.VariantKeys[model.VariantPreview]; ok && sourceFormat == "" {
+		// RAW files render from their embedded preview, the private clean
+		// copy when the file's own one is watermarked
+		sourceKey, sourceFormat = previewKey, imaging.FormatJPEG
+		if file.Watermarked {
+			sourceKey = repository.WatermarkSourceKey(file.ID)
+		}
+	} else if sourceFormat == "" || file.Filesize > s.deps.Config.Images.MaxProcessSize {
+		return model.RenderedImage{}, model.ErrUnsupportedImage
+	}
+
+	if err := opts.Validate(s.deps.Config.Images.MaxTransformDimension); err != nil {
+		return model.RenderedImage{}, fmt.Errorf("%w: %v", model.ErrInvalidTransform, err)
+	}
+	opts = opts.Normalize(sourceFormat, s.deps.Config.Images.JPEGQuality)
+
+	hash := opts.Hash()
+	cacheKey := repository.RenderCacheKey(file.ObjectKey, hash, imaging.Extension(opts.Format))
+
+	var watermark *model.Watermark
+	if file.Watermarked {
+		current, err := s.deps.Repos.Watermark.GetDefault(ctx, file.UserID)
+		if err == nil {
+			watermark = &current
+		} else if !errors.Is(err, model.ErrNotFound) {
+			return model.RenderedImage{}, err
+		}
+
+		// Editing or switching the watermark must not serve stale renderings
+		hash = watermarkedHash(hash, watermark)
+		cacheKey = repository.RenderCacheKey(repository.WatermarkScope(file.ID), hash, imaging.Extension(opts.Format))
+	}
+
+	cached, info, err := s.deps.Storage.Get(ctx, cacheKey)
+	if err == nil {
+		return model.RenderedImage{
+			Body:        cached,
+			ContentType: imaging.MimeType(opts.Format),
+			Size:        info.Size,
+			ETag:        hash,
+			Public:      file.IsPublic,
+			Watermarked: file.Watermarked,
+		}, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		s.deps.Logger.Warn("Failed to read cached rendering", "error", err, "key", cacheKey)
+	}
+
+	object, _, err := s.deps.Storage.Get(ctx, sourceKey)
+	if err != nil {
+		return model.RenderedImage{}, err
+	}
+	defer object.Close()
+
+	img, _, err := imaging.DecodeLimited(object, imageLimits(s.deps))
+	if err != nil {
+		return model.RenderedImage{}, imageLimitError(err)
+	}
+	if s.deps.Config.Images.AutoOrient {
+		img = imaging.Orient(img, file.Orientation)
+	}
+
+	rendered := imaging.Transform(img, opts)
+	if watermark != nil {
+		drawn, err := loadWatermark(ctx, s.deps, *watermark)
+		if err != nil {
+			return model.RenderedImage{}, err
+		}
+		if drawn != nil {
+			rendered = drawn.Apply(rendered)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, rendered, opts.Format, opts.Quality); err != nil {
+		return model.RenderedImage{}, err
+	}
+	data := buf.Bytes()
+
+	err = s.deps.Storage.Put(ctx, cacheKey, bytes.NewReader(data), storage.PutOptions{
+		ContentType:   imaging.MimeType(opts.Format),
+		ContentLength: int64(len(data)),
+	})
+	if err != nil {
+		s.deps.Logger.Warn("Failed to cache rendering", "error", err, "key", cacheKey)
+	}
+
+	return model.RenderedImage{
+		Body:        io.NopCloser(bytes.NewReader(data)),
+		ContentType: imaging.MimeType(opts.Format),
+		Size:        int64(len(data)),
+		ETag:        hash,
+		Public:      file.IsPublic,
+		Watermarked: file.Watermarked,
+	}, nil
+}
+
+// watermarkedHash identifies a rendering of a watermarked file by its
+// options and the version of the watermark drawn over it, nil for none
+func watermarkedHash(hash string, watermark *model.Watermark) string {
+	version := "none"
+	if watermark != nil {
+		version = fmt.Sprintf("%d:%d", watermark.ID, watermark.UpdatedAt.UnixNano())
+	}
+	sum := sha256.Sum256([]byte(hash + ":" + version))
+	return hex.EncodeToString(sum[:16])
+}
+
+// SignURL mints a signed transformation URL for one of the caller's files.
+// A ttl of 0 yields a URL that never expires.
+func (s *imageService) SignURL(ctx context.Context, id int64, opts imaging.TransformOptions, ttl time.Duration) (model.SignedURL, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.SignedURL{}, err
+	}
+
+	file, err := s.deps.Repos.Cr2.GetByID(ctx, id)
+	if err != nil {
+		return model.SignedURL{}, err
+	}
+
+	// A signature grants any rendering, only the owner decides which exist
+	if file.UserID != user.UserID {
+		return model.SignedURL{}, model.ErrForbidden
+	}
+
+	if err := opts.Validate(s.deps.Config.Images.MaxTransformDimension); err != nil {
+		return model.SignedURL{}, fmt.Errorf("%w: %v", model.ErrInvalidTransform, err)
+	}
+
+	var response model.SignedURL
+	sig := model.ImageSignature{}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+		sig.Expires = expiresAt.Unix()
+		response.ExpiresAt = &expiresAt
+	}
+	sig.Value = urlsign.Sign(s.deps.Config.Images.SigningSecret, signaturePayload(id, opts, sig.Expires))
+
+	query := opts.Query()
+	if sig.Expires != 0 {
+		query.Set("exp", strconv.FormatInt(sig.Expires, 10))
+	}
+	query.Set("sig", sig.Value)
+
+	response.URL = fmt.Sprintf("%s/i/%d?%s", s.deps.Config.Images.BaseURL, id, query.Encode())
+	return response, nil
+}
+
+// verifySignature checks a transformation URL signature and its expiry
+func (s *imageService) verifySignature(id int64, opts imaging.TransformOptions, sig model.ImageSignature) error {
+	if sig.Expires != 0 && time.Now().Unix() > sig.Expires {
+		return model.ErrInvalidSignature
+	}
+
+	if !urlsign.Verify(s.deps.Config.Images.SigningSecret, signaturePayload(id, opts, sig.Expires), sig.Value) {
+		return model.ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// signaturePayload is the canonical string a transformation URL signs, built
+// from the parsed options so parameter order and encoding do not matter
+func signaturePayload(id int64, opts imaging.TransformOptions, expires int64) string {
+	return fmt.Sprintf("%d:%s:%d", id, opts.Canonical(), expires)
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"errors"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/adorufus/imgupper/config"
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/imaging"
+	"github.com/adorufus/imgupper/pkg/urlsign"
+)
+
+func TestVerifySignature(t *testing.T) {
+	const secret = "test-secret"
+	s := &imageService{deps: Deps{Config: &config.Config{
+		Images: config.ImageConfig{SigningSecret: secret},
+	}}}
+
+	opts := imaging.TransformOptions{Width: 640, Fit: imaging.FitCover, Crop: image.Rect(10, 10, 110, 60)}
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Minute).Unix()
+	sign := func(id int64, opts imaging.TransformOptions, expires int64) model.ImageSignature {
+		return model.ImageSignature{Expires: expires, Value: urlsign.Sign(secret, signaturePayload(id, opts, expires))}
+	}
+
+	tests := []struct {
+		name    string
+		id      int64
+		opts    imaging.TransformOptions
+		sig     model.ImageSignature
+		wantErr error
+	}{
+		{name: "valid", id: 1, opts: opts, sig: sign(1, opts, 0)},
+		{name: "valid until expiry", id: 1, opts: opts, sig: sign(1, opts, future)},
+		{name: "expired", id: 1, opts: opts, sig: sign(1, opts, past), wantErr: model.ErrInvalidSignature},
+		{name: "other file", id: 2, opts: opts, sig: sign(1, opts, 0), wantErr: model.ErrInvalidSignature},
+		{
+			name:    "other options",
+			id:      1,
+			opts:    imaging.TransformOptions{Width: 4096, Fit: imaging.FitCover, Crop: opts.Crop},
+			sig:     sign(1, opts, 0),
+			wantErr: model.ErrInvalidSignature,
+		},
+		{
+			name:    "other crop",
+			id:      1,
+			opts:    imaging.TransformOptions{Width: 640, Fit: imaging.FitCover, Crop: image.Rect(0, 0, 100, 50)},
+			sig:     sign(1, opts, 0),
+			wantErr: model.ErrInvalidSignature,
+		},
+		{
+			name:    "expiry removed",
+			id:      1,
+			opts:    opts,
+			sig:     model.ImageSignature{Value: sign(1, opts, future).Value},
+			wantErr: model.ErrInvalidSignature,
+		},
+		{
+			name:    "expiry extended",
+			id:      1,
+			opts:    opts,
+			sig:     model.ImageSignature{Expires: future + 3600, Value: sign(1, opts, future).Value},
+			wantErr: model.ErrInvalidSignature,
+		},
+		{name: "missing signature", id: 1, opts: opts, wantErr: model.ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.verifySignature(tt.id, tt.opts, tt.sig); !errors.Is(err, tt.wantErr) {
+				t.Errorf("verifySignature() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
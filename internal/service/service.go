@@ -3,22 +3,31 @@ package service
 import (
 	"time"
 
+	"github.com/adorufus/imgupper/config"
 	"github.com/adorufus/imgupper/internal/repository"
 	"github.com/adorufus/imgupper/pkg/logger"
+	"github.com/adorufus/imgupper/pkg/storage"
 )
 
 // Deps contains dependencies for services
 type Deps struct {
-	Repos  *repository.Repositories
-	Logger logger.Logger
+	Repos   *repository.Repositories
+	Logger  logger.Logger
+	Config  *config.Config
+	Storage storage.Backend
 }
 
 // Services contains all application services
 type Services struct {
-	User   UserService
-	Health HealthService
-	Auth   AuthService
-	Cr2    Cr2Service
+	User      UserService
+	Health    HealthService
+	Auth      AuthService
+	Cr2       Cr2Service
+	Tus       TusService
+	Presign   PresignService
+	Image     ImageService
+	Watermark WatermarkService
+	Album     AlbumService
 }
 
 // NewServices creates a new Services instance
@@ -26,9 +35,14 @@ func NewServices(deps Deps, jwtSecret string) *Services {
 	tokenDuration := 24 * time.Hour
 
 	return &Services{
-		User:   NewUserService(deps),
-		Health: NewHealthService(deps),
-		Cr2:    NewCr2Srvice(deps),
-		Auth:   NewAuthService(deps, jwtSecret, tokenDuration),
+		User:      NewUserService(deps),
+		Health:    NewHealthService(deps),
+		Cr2:       NewCr2Srvice(deps),
+		Tus:       NewTusService(deps),
+		Presign:   NewPresignService(deps),
+		Image:     NewImageService(deps),
+		Watermark: NewWatermarkService(deps),
+		Album:     NewAlbumService(deps),
+		Auth:      NewAuthService(deps, jwtSecret, tokenDuration),
 	}
 }
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/exif"
+	"github.com/adorufus/imgupper/pkg/middleware"
+	"github.com/adorufus/imgupper/pkg/storage"
+	"github.com/google/uuid"
+)
+
+// tusPartSize is the size of the multipart parts assembled from tus chunks
+const tusPartSize = 8 << 20
+
+// TusService defines the resumable upload service interface
+type TusService interface {
+	Create(ctx context.Context, req model.TusCreateRequest) (model.TusUpload, error)
+	Get(ctx context.Context, id string) (model.TusUpload, error)
+	Patch(ctx context.Context, id string, offset int64, body io.Reader) (model.TusPatchResult, error)
+	Terminate(ctx context.Context, id string) error
+	PurgeExpired(ctx context.Context) (int, error)
+}
+
+// tusService implements TusService
+type tusService struct {
+	deps Deps
+}
+
+// NewTusService creates a new TusService
+func NewTusService(deps Deps) TusService {
+	return &tusService{
+		deps: deps,
+	}
+}
+
+// Create starts a resumable upload backed by a storage multipart upload
+func (s *tusService) Create(ctx context.Context, req model.TusCreateRequest) (model.TusUpload, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.TusUpload{}, err
+	}
+
+	if req.UploadLength < 0 {
+		return model.TusUpload{}, errors.New("invalid upload length")
+	}
+
+	if req.UploadLength > s.deps.Config.Upload.MaxSize {
+		return model.TusUpload{}, model.ErrFileTooLarge
+	}
+
+	mimeType, err := declaredContentType(s.deps, req.MimeType)
+	if err != nil {
+		return model.TusUpload{}, err
+	}
+
+	// The upload is only staged here: it may still hold metadata to scrub,
+	// the published copy is made when the file record is created
+	key := s.deps.Repos.Cr2.NewObjectKey(user.UserID, mimeType)
+	multipartID, err := s.deps.Storage.CreateMultipart(ctx, key, storage.PutOptions{
+		ContentType:   mimeType,
+		ContentLength: req.UploadLength,
+	})
+	if err != nil {
+		return model.TusUpload{}, err
+	}
+
+	upload, err := s.deps.Repos.Tus.Create(ctx, model.TusUpload{
+		ID:           uuid.New().String(),
+		UserID:       user.UserID,
+		UploadLength: req.UploadLength,
+		Filename:     req.Filename,
+		MimeType:     mimeType,
+		IsPublic:     req.IsPublic,
+		ObjectKey:    key,
+		MultipartID:  multipartID,
+		ExpiresAt:    time.Now().Add(s.deps.Config.Upload.TusExpiration),
+	})
+	if err != nil {
+		s.abort(key, multipartID)
+		return model.TusUpload{}, err
+	}
+
+	return upload, nil
+}
+
+// Get returns an upload owned by the caller that has not expired
+func (s *tusService) Get(ctx context.Context, id string) (model.TusUpload, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.TusUpload{}, err
+	}
+
+	upload, err := s.deps.Repos.Tus.GetByID(ctx, id)
+	if err != nil {
+		return model.TusUpload{}, err
+	}
+
+	if upload.UserID != user.UserID {
+		return model.TusUpload{}, model.ErrForbidden
+	}
+
+	if time.Now().After(upload.ExpiresAt) {
+		return model.TusUpload{}, model.ErrUploadExpired
+	}
+
+	return upload, nil
+}
+
+// Patch appends a chunk to an upload. Bytes are collected into full parts
+// before they are sent to storage, anything short of a part is kept in a
+// staging object so the next PATCH can continue where this one stopped.
+// The upload stays locked throughout, a concurrent PATCH fails with
+// model.ErrUploadLocked rather than sending the same part.
+func (s *tusService) Patch(ctx context.Context, id string, offset int64, body io.Reader) (model.TusPatchResult, error) {
+	unlock, err := s.deps.Repos.Tus.Lock(ctx, id)
+	if err != nil {
+		return model.TusPatchResult{}, err
+	}
+	defer unlock()
+
+	upload, err := s.Get(ctx, id)
+	if err != nil {
+		return model.TusPatchResult{}, err
+	}
+
+	if offset != upload.UploadOffset {
+		return model.TusPatchResult{}, model.ErrOffsetMismatch
+	}
+
+	prevOffset, prevPending := upload.UploadOffset, upload.PendingSize
+	buf, err := s.loadPending(ctx, upload)
+	if err != nil {
+		return model.TusPatchResult{}, err
+	}
+
+	body = io.LimitReader(body, upload.UploadLength-upload.UploadOffset)
+
+	var readErr error
+	for {
+		n, err := io.ReadFull(body, buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		upload.UploadOffset += int64(n)
+
+		if len(buf) == cap(buf) && upload.UploadOffset < upload.UploadLength {
+			if err := s.uploadPart(ctx, &upload, buf); err != nil {
+				return model.TusPatchResult{}, err
+			}
+			buf = buf[:0]
+		}
+
+		if upload.UploadOffset == upload.UploadLength || err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			// Keep what arrived so the client can resume after a dropped connection
+			readErr = err
+			break
+		}
+	}
+
+	if upload.UploadOffset == upload.UploadLength {
+		// The last part is recorded before finishing, so only one request
+		// finishes and a failed finish is retried with an empty PATCH
+		if prevOffset < upload.UploadLength {
+			if len(buf) > 0 || len(upload.Parts) == 0 {
+				if err := s.uploadPart(ctx, &upload, buf); err != nil {
+					return model.TusPatchResult{}, err
+				}
+			}
+			upload.PendingSize = 0
+			if err := s.deps.Repos.Tus.UpdateProgress(ctx, upload, prevOffset); err != nil {
+				return model.TusPatchResult{}, err
+			}
+			if prevPending > 0 {
+				if err := s.deps.Storage.Delete(ctx, pendingKey(upload)); err != nil {
+					s.deps.Logger.Warn("Failed to delete staged upload data", "error", err, "id", upload.ID)
+				}
+			}
+		}
+
+		file, err := s.finish(ctx, upload.ID)
+		if err != nil {
+			return model.TusPatchResult{}, err
+		}
+		return model.TusPatchResult{Upload: upload, File: &file}, nil
+	}
+
+	upload.PendingSize = int64(len(buf))
+	if upload.PendingSize > 0 {
+		err := s.deps.Storage.Put(ctx, pendingKey(upload), bytes.NewReader(buf), storage.PutOptions{
+			ContentLength: upload.PendingSize,
+		})
+		if err != nil {
+			return model.TusPatchResult{}, err
+		}
+	} else if prevPending > 0 {
+		if err := s.deps.Storage.Delete(ctx, pendingKey(upload)); err != nil {
+			s.deps.Logger.Warn("Failed to delete staged upload data", "error", err, "id", upload.ID)
+		}
+	}
+
+	if err := s.deps.Repos.Tus.UpdateProgress(ctx, upload, prevOffset); err != nil {
+		return model.TusPatchResult{}, err
+	}
+
+	if readErr != nil {
+		return model.TusPatchResult{Upload: upload}, fmt.Errorf("upload interrupted: %w", readErr)
+	}
+
+	return model.TusPatchResult{Upload: upload}, nil
+}
+
+// loadPending returns a part buffer pre-filled with the staged bytes
+func (s *tusService) loadPending(ctx context.Context, upload model.TusUpload) ([]byte, error) {
+	buf := make([]byte, 0, tusPartSize)
+	if upload.PendingSize == 0 {
+		return buf, nil
+	}
+
+	object, _, err := s.deps.Storage.Get(ctx, pendingKey(upload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load staged upload data: %w", err)
+	}
+	defer object.Close()
+
+	n, err := io.ReadFull(object, buf[:upload.PendingSize])
+	if err != nil {
+		return nil, fmt.Errorf("failed to load staged upload data: %w", err)
+	}
+
+	return buf[:n], nil
+}
+
+// uploadPart sends a full part to storage and records it on the upload
+func (s *tusService) uploadPart(ctx context.Context, upload *model.TusUpload, data []byte) error {
+	number := int32(len(upload.Parts) + 1)
+	part, err := s.deps.Storage.UploadPart(ctx, upload.ObjectKey, upload.MultipartID, number, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	upload.Parts = append(upload.Parts, model.TusPart{Number: part.Number, ETag: part.ETag})
+	return nil
+}
+
+// finish assembles a fully received upload and records the file, holding
+// the upload locked so concurrent requests cannot finish it twice. Every
+// step can run again when a previous attempt failed part way.
+func (s *tusService) finish(ctx context.Context, id string) (model.CR2UploadResponse, error) {
+	var file model.CR2UploadResponse
+	var meta *exif.Metadata
+	err := s.deps.Repos.Tus.Finish(ctx, id, func(upload model.TusUpload) error {
+		var err error
+		file, meta, err = s.record(ctx, upload)
+		return err
+	})
+	if err != nil {
+		if isRejectedUpload(err) {
+			if err := s.deps.Repos.Tus.Delete(ctx, id); err != nil {
+				s.deps.Logger.Warn("Failed to delete rejected upload", "error", err, "id", id)
+			}
+		}
+		return model.CR2UploadResponse{}, err
+	}
+
+	return processImage(ctx, s.deps, file, meta), nil
+}
+
+// record completes the multipart upload, unless an earlier attempt did,
+// and creates the file record. The metadata of the upload is returned as
+// parsed before scrubbing.
+func (s *tusService) record(ctx context.Context, upload model.TusUpload) (model.CR2UploadResponse, *exif.Metadata, error) {
+	_, err := s.deps.Storage.Head(ctx, upload.ObjectKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		parts := make([]storage.Part, 0, len(upload.Parts))
+		for _, part := range upload.Parts {
+			parts = append(parts, storage.Part{Number: part.Number, ETag: part.ETag})
+		}
+
+		err = s.deps.Storage.CompleteMultipart(ctx, upload.ObjectKey, upload.MultipartID, parts)
+	}
+	if err != nil {
+		return model.CR2UploadResponse{}, nil, err
+	}
+
+	mimeType, err := checkStoredUpload(ctx, s.deps, upload.ObjectKey, upload.MimeType)
+	if err != nil {
+		if isRejectedUpload(err) {
+			s.deps.Logger.Warn("Rejected resumable upload", "error", err, "id", upload.ID)
+			if err := s.deps.Storage.Delete(ctx, upload.ObjectKey); err != nil {
+				s.deps.Logger.Warn("Failed to delete rejected upload", "error", err, "key", upload.ObjectKey)
+			}
+		}
+		return model.CR2UploadResponse{}, nil, err
+	}
+
+	privacy, err := resolvePrivacy(ctx, s.deps, upload.UserID, "", nil)
+	if err != nil {
+		return model.CR2UploadResponse{}, nil, err
+	}
+
+	if err := checkScrubbable(privacy, mimeType); err != nil {
+		return model.CR2UploadResponse{}, nil, err
+	}
+
+	watermarked, err := hasWatermark(ctx, s.deps, upload.UserID)
+	if err != nil {
+		return model.CR2UploadResponse{}, nil, err
+	}
+
+	meta := readStoredMetadata(ctx, s.deps, upload.ObjectKey)
+
+	file, err := scrubStoredObject(ctx, s.deps, model.CR2UploadResponse{
+		UserID:      upload.UserID,
+		Filename:    upload.Filename,
+		Filesize:    upload.UploadLength,
+		MimeType:    mimeType,
+		ObjectKey:   upload.ObjectKey,
+		IsPublic:    upload.IsPublic,
+		Watermarked: watermarked,
+	}, privacy)
+	if err != nil {
+		return model.CR2UploadResponse{}, nil, err
+	}
+
+	created, err := s.deps.Repos.Cr2.CreateRecord(ctx, file)
+	if err != nil {
+		// The assembled upload stays for a retry, only the scrubbed copy goes
+		if file.ObjectKey != upload.ObjectKey {
+			deleteObjects(ctx, s.deps, file.ObjectKey, file.OriginalKey)
+		}
+		return model.CR2UploadResponse{}, nil, err
+	}
+
+	if file.ObjectKey != upload.ObjectKey {
+		deleteObjects(ctx, s.deps, upload.ObjectKey)
+	}
+
+	return created, meta, nil
+}
+
+// Terminate cancels an upload and discards everything received so far
+func (s *tusService) Terminate(ctx context.Context, id string) error {
+	upload, err := s.Get(ctx, id)
+	if err != nil && !errors.Is(err, model.ErrUploadExpired) {
+		return err
+	}
+
+	return s.discard(ctx, upload)
+}
+
+// PurgeExpired discards all uploads past their expiry
+func (s *tusService) PurgeExpired(ctx context.Context) (int, error) {
+	uploads, err := s.deps.Repos.Tus.ListExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, upload := range uploads {
+		if err := s.discard(ctx, upload); err != nil {
+			s.deps.Logger.Error("Failed to purge expired upload", "error", err, "id", upload.ID)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (s *tusService) discard(ctx context.Context, upload model.TusUpload) error {
+	s.abort(upload.ObjectKey, upload.MultipartID)
+	if upload.UploadOffset == upload.UploadLength {
+		// A failed finish may have assembled the object already
+		if err := s.deps.Storage.Delete(ctx, upload.ObjectKey); err != nil {
+			return err
+		}
+	}
+	if upload.PendingSize > 0 {
+		if err := s.deps.Storage.Delete(ctx, pendingKey(upload)); err != nil {
+			return err
+		}
+	}
+
+	return s.deps.Repos.Tus.Delete(ctx, upload.ID)
+}
+
+func (s *tusService) abort(key, multipartID string) {
+	// Use a fresh context so the cleanup still runs when the request was cancelled
+	if err := s.deps.Storage.AbortMultipart(context.Background(), key, multipartID); err != nil {
+		s.deps.Logger.Warn("Failed to abort multipart upload", "error", err, "key", key)
+	}
+}
+
+// pendingKey is the staging object holding bytes not yet uploaded as a part
+func pendingKey(upload model.TusUpload) string {
+	return upload.ObjectKey + ".tuspart"
+}
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/adorufus/imgupper/config"
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/internal/repository"
+	"github.com/adorufus/imgupper/pkg/middleware"
+	"github.com/adorufus/imgupper/pkg/storage"
+)
+
+// errFinishCalled stops Patch once an upload is handed over for finishing
+var errFinishCalled = errors.New("finish called")
+
+// fakeTusRepository keeps a single upload in memory
+type fakeTusRepository struct {
+	repository.TusRepository
+	mu       sync.Mutex
+	locked   bool
+	upload   model.TusUpload
+	finished bool
+}
+
+func (r *fakeTusRepository) Lock(ctx context.Context, id string) (func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.locked {
+		return nil, model.ErrUploadLocked
+	}
+	r.locked = true
+	return func() {
+		r.mu.Lock()
+		r.locked = false
+		r.mu.Unlock()
+	}, nil
+}
+
+func (r *fakeTusRepository) GetByID(ctx context.Context, id string) (model.TusUpload, error) {
+	if id != r.upload.ID {
+		return model.TusUpload{}, model.ErrNotFound
+	}
+	upload := r.upload
+	upload.Parts = append([]model.TusPart(nil), r.upload.Parts...)
+	return upload, nil
+}
+
+func (r *fakeTusRepository) UpdateProgress(ctx context.Context, upload model.TusUpload, prevOffset int64) error {
+	if r.upload.UploadOffset != prevOffset {
+		return model.ErrOffsetMismatch
+	}
+	r.upload = upload
+	return nil
+}
+
+func (r *fakeTusRepository) Finish(ctx context.Context, id string, fn func(upload model.TusUpload) error) error {
+	if r.upload.UploadOffset != r.upload.UploadLength {
+		return model.ErrOffsetMismatch
+	}
+	r.finished = true
+	return errFinishCalled
+}
+
+// nopLogger discards log messages
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
+func (nopLogger) Fatal(msg string, args ...interface{}) {}
+
+// tusPatch is one PATCH request of a test upload
+type tusPatch struct {
+	offset  int64
+	body    []byte
+	readErr error
+	wantErr error
+}
+
+func TestTusPatchOffsets(t *testing.T) {
+	errDropped := errors.New("connection reset")
+	chunk := func(n int) []byte { return bytes.Repeat([]byte{'x'}, n) }
+
+	tests := []struct {
+		name        string
+		length      int64
+		patches     []tusPatch
+		wantOffset  int64
+		wantPending int64
+		wantParts   int
+		wantFinish  bool
+	}{
+		{
+			name:       "offset mismatch",
+			length:     100,
+			patches:    []tusPatch{{offset: 10, body: chunk(10), wantErr: model.ErrOffsetMismatch}},
+			wantOffset: 0,
+		},
+		{
+			name:        "short chunk is staged",
+			length:      100,
+			patches:     []tusPatch{{offset: 0, body: chunk(40)}},
+			wantOffset:  40,
+			wantPending: 40,
+		},
+		{
+			name:   "resumes after staged bytes",
+			length: 100,
+			patches: []tusPatch{
+				{offset: 0, body: chunk(40)},
+				{offset: 40, body: chunk(30)},
+			},
+			wantOffset:  70,
+			wantPending: 70,
+		},
+		{
+			name:   "replayed chunk is rejected",
+			length: 100,
+			patches: []tusPatch{
+				{offset: 0, body: chunk(40)},
+				{offset: 0, body: chunk(40), wantErr: model.ErrOffsetMismatch},
+			},
+			wantOffset:  40,
+			wantPending: 40,
+		},
+		{
+			name:        "full part is uploaded",
+			length:      tusPartSize + 100,
+			patches:     []tusPatch{{offset: 0, body: chunk(tusPartSize + 10)}},
+			wantOffset:  tusPartSize + 10,
+			wantPending: 10,
+			wantParts:   1,
+		},
+		{
+			name:        "interrupted read keeps what arrived",
+			length:      100,
+			patches:     []tusPatch{{offset: 0, body: chunk(30), readErr: errDropped, wantErr: errDropped}},
+			wantOffset:  30,
+			wantPending: 30,
+		},
+		{
+			name:   "last chunk finishes",
+			length: 100,
+			patches: []tusPatch{
+				{offset: 0, body: chunk(60)},
+				{offset: 60, body: chunk(40), wantErr: errFinishCalled},
+			},
+			wantOffset: 100,
+			wantParts:  1,
+			wantFinish: true,
+		},
+		{
+			name:       "bytes beyond the length are ignored",
+			length:     100,
+			patches:    []tusPatch{{offset: 0, body: chunk(150), wantErr: errFinishCalled}},
+			wantOffset: 100,
+			wantParts:  1,
+			wantFinish: true,
+		},
+		{
+			name:   "empty patch retries finishing",
+			length: 100,
+			patches: []tusPatch{
+				{offset: 0, body: chunk(100), wantErr: errFinishCalled},
+				{offset: 100, wantErr: errFinishCalled},
+			},
+			wantOffset: 100,
+			wantParts:  1,
+			wantFinish: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), middleware.UserKey, &middleware.UserClaims{UserID: 1})
+			store := storage.NewMemoryBackend()
+
+			multipartID, err := store.CreateMultipart(ctx, "u/1/upload.jpg", storage.PutOptions{})
+			if err != nil {
+				t.Fatalf("CreateMultipart() error = %v", err)
+			}
+			repo := &fakeTusRepository{upload: model.TusUpload{
+				ID:           "upload",
+				UserID:       1,
+				UploadLength: tt.length,
+				ObjectKey:    "u/1/upload.jpg",
+				MultipartID:  multipartID,
+				ExpiresAt:    time.Now().Add(time.Hour),
+			}}
+			s := NewTusService(Deps{
+				Repos:   &repository.Repositories{Tus: repo},
+				Logger:  nopLogger{},
+				Config:  &config.Config{},
+				Storage: store,
+			})
+
+			var sent []byte
+			for i, patch := range tt.patches {
+				var body io.Reader = bytes.NewReader(patch.body)
+				if patch.readErr != nil {
+					body = io.MultiReader(body, iotest.ErrReader(patch.readErr))
+				}
+
+				_, err := s.Patch(ctx, "upload", patch.offset, body)
+				if !errors.Is(err, patch.wantErr) {
+					t.Fatalf("PATCH %d error = %v, want %v", i, err, patch.wantErr)
+				}
+				if patch.wantErr != model.ErrOffsetMismatch {
+					sent = append(sent, patch.body...)
+				}
+			}
+
+			upload := repo.upload
+			if upload.UploadOffset != tt.wantOffset || upload.PendingSize != tt.wantPending || len(upload.Parts) != tt.wantParts {
+				t.Errorf("offset, pending, parts = %d, %d, %d, want %d, %d, %d",
+					upload.UploadOffset, upload.PendingSize, len(upload.Parts), tt.wantOffset, tt.wantPending, tt.wantParts)
+			}
+			if repo.finished != tt.wantFinish {
+				t.Errorf("finished = %v, want %v", repo.finished, tt.wantFinish)
+			}
+
+			// Parts and staged bytes together hold exactly the bytes accepted
+			var parts []storage.Part
+			for _, part := range upload.Parts {
+				parts = append(parts, storage.Part{Number: part.Number, ETag: part.ETag})
+			}
+			if err := store.CompleteMultipart(ctx, upload.ObjectKey, upload.MultipartID, parts); err != nil {
+				t.Fatalf("CompleteMultipart() error = %v", err)
+			}
+			got := readObject(t, store, upload.ObjectKey)
+			if upload.PendingSize > 0 {
+				got = append(got, readObject(t, store, pendingKey(upload))...)
+			}
+			if int64(len(got)) != tt.wantOffset || !bytes.Equal(got, sent[:tt.wantOffset]) {
+				t.Errorf("stored %d bytes, want the first %d bytes sent", len(got), tt.wantOffset)
+			}
+		})
+	}
+}
+
+// blockingReader holds back io.EOF until release is closed, signalling
+// started once the whole body was read
+type blockingReader struct {
+	r       io.Reader
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (b *blockingReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		b.once.Do(func() { close(b.started) })
+		<-b.release
+	}
+	return n, err
+}
+
+func TestTusPatchConcurrent(t *testing.T) {
+	ctx := context.WithValue(context.Background(), middleware.UserKey, &middleware.UserClaims{UserID: 1})
+	store := storage.NewMemoryBackend()
+
+	multipartID, err := store.CreateMultipart(ctx, "u/1/upload.jpg", storage.PutOptions{})
+	if err != nil {
+		t.Fatalf("CreateMultipart() error = %v", err)
+	}
+	repo := &fakeTusRepository{upload: model.TusUpload{
+		ID:           "upload",
+		UserID:       1,
+		UploadLength: tusPartSize + 100,
+		ObjectKey:    "u/1/upload.jpg",
+		MultipartID:  multipartID,
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}}
+	s := NewTusService(Deps{
+		Repos:   &repository.Repositories{Tus: repo},
+		Logger:  nopLogger{},
+		Config:  &config.Config{},
+		Storage: store,
+	})
+
+	// The first PATCH fills part 1 and then stalls on the rest of its body
+	first := bytes.Repeat([]byte{'a'}, tusPartSize+10)
+	blocked := &blockingReader{
+		r:       bytes.NewReader(first),
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	done := make(chan error)
+	go func() {
+		_, err := s.Patch(ctx, "upload", 0, blocked)
+		done <- err
+	}()
+	<-blocked.started
+
+	// A second PATCH at the same offset must not send its own part 1
+	second := bytes.Repeat([]byte{'b'}, tusPartSize+10)
+	if _, err := s.Patch(ctx, "upload", 0, bytes.NewReader(second)); !errors.Is(err, model.ErrUploadLocked) {
+		t.Errorf("concurrent PATCH error = %v, want ErrUploadLocked", err)
+	}
+
+	close(blocked.release)
+	if err := <-done; err != nil {
+		t.Fatalf("first PATCH error = %v", err)
+	}
+
+	// Once the first PATCH is done the upload continues at its offset
+	if _, err := s.Patch(ctx, "upload", 0, bytes.NewReader(second)); !errors.Is(err, model.ErrOffsetMismatch) {
+		t.Errorf("stale PATCH error = %v, want ErrOffsetMismatch", err)
+	}
+
+	upload := repo.upload
+	if upload.UploadOffset != int64(len(first)) || len(upload.Parts) != 1 {
+		t.Fatalf("offset, parts = %d, %d, want %d, 1", upload.UploadOffset, len(upload.Parts), len(first))
+	}
+	err = store.CompleteMultipart(ctx, upload.ObjectKey, upload.MultipartID, []storage.Part{
+		{Number: upload.Parts[0].Number, ETag: upload.Parts[0].ETag},
+	})
+	if err != nil {
+		t.Fatalf("CompleteMultipart() error = %v", err)
+	}
+	if got := readObject(t, store, upload.ObjectKey); !bytes.Equal(got, first[:tusPartSize]) {
+		t.Error("part 1 does not hold the bytes of the PATCH that recorded it")
+	}
+}
+
+func readObject(t *testing.T, store storage.Backend, key string) []byte {
+	t.Helper()
+	object, _, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%s) error = %v", key, err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		t.Fatalf("Get(%s) error = %v", key, err)
+	}
+	return data
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 
 	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/middleware"
 )
 
 // UserService defines the user service interface
@@ -14,6 +15,8 @@ type UserService interface {
 	GetAll(ctx context.Context) ([]model.User, error)
 	Update(ctx context.Context, user model.User) (model.User, error)
 	Delete(ctx context.Context, id int64) error
+	GetPrivacy(ctx context.Context) (model.PrivacySettings, error)
+	UpdatePrivacy(ctx context.Context, settings model.PrivacySettings) (model.PrivacySettings, error)
 }
 
 // userService implements UserService
@@ -64,3 +67,27 @@ func (s *userService) Update(ctx context.Context, user model.User) (model.User,
 func (s *userService) Delete(ctx context.Context, id int64) error {
 	return s.deps.Repos.User.Delete(ctx, id)
 }
+
+// GetPrivacy gets the upload privacy settings of the current user
+func (s *userService) GetPrivacy(ctx context.Context) (model.PrivacySettings, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.PrivacySettings{}, err
+	}
+
+	return s.deps.Repos.User.GetPrivacy(ctx, user.UserID)
+}
+
+// UpdatePrivacy updates the upload privacy settings of the current user
+func (s *userService) UpdatePrivacy(ctx context.Context, settings model.PrivacySettings) (model.PrivacySettings, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.PrivacySettings{}, err
+	}
+
+	if err := settings.Validate(); err != nil {
+		return model.PrivacySettings{}, err
+	}
+
+	return s.deps.Repos.User.UpdatePrivacy(ctx, user.UserID, settings)
+}
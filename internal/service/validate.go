@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/filetype"
+	"github.com/adorufus/imgupper/pkg/imaging"
+)
+
+// uploadHeadLen is how much of an upload is inspected before it is stored
+const uploadHeadLen = max(filetype.SniffLen, imaging.HeaderLen)
+
+// checkFileType sniffs the first bytes of an upload and applies the
+// configured allow-list, returning the detected MIME type
+func checkFileType(deps Deps, head []byte, declared string) (string, error) {
+	detected, err := filetype.Check(head, declared, deps.Config.Upload.AllowedTypes)
+	if err != nil {
+		return "", &model.FileTypeError{Detected: detected, Declared: declared, Err: err}
+	}
+	return detected, nil
+}
+
+// imageLimits returns the configured decoding limits
+func imageLimits(deps Deps) imaging.Limits {
+	return imaging.Limits{
+		MaxDimension: deps.Config.Images.MaxDimension,
+		MaxPixels:    deps.Config.Images.MaxPixels,
+		MaxFrames:    deps.Config.Images.MaxFrames,
+		MaxMemory:    deps.Config.Images.MaxDecodedBytes,
+	}
+}
+
+// checkImageHeader enforces the decoding limits on an image header and
+// returns the decodable format, "" for files that are not decoded
+func checkImageHeader(deps Deps, head []byte) (string, error) {
+	_, format, err := imaging.CheckHeader(head, imageLimits(deps))
+	if err != nil {
+		return "", imageLimitError(err)
+	}
+	return format, nil
+}
+
+// imageLimitError maps imaging failures to the model errors handlers know
+func imageLimitError(err error) error {
+	if errors.Is(err, imaging.ErrLimitExceeded) {
+		return fmt.Errorf("%w: %v", model.ErrImageTooLarge, err)
+	}
+	return errors.Join(model.ErrUnsupportedImage, err)
+}
+
+// isRejectedUpload reports whether err rejects the content of an upload,
+// as opposed to a failure worth retrying
+func isRejectedUpload(err error) bool {
+	return errors.Is(err, model.ErrFileType) ||
+		errors.Is(err, model.ErrImageTooLarge) ||
+		errors.Is(err, model.ErrUnsupportedImage) ||
+		errors.Is(err, model.ErrMetadataNotScrubbable)
+}
+
+// checkStoredUpload validates an object that reached the bucket directly:
+// its type by sniffing, then the image limits, walking the whole stream
+// for animated GIFs. It returns the detected MIME type.
+func checkStoredUpload(ctx context.Context, deps Deps, key, declared string) (string, error) {
+	object, _, err := deps.Storage.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	head := make([]byte, uploadHeadLen)
+	n, err := io.ReadFull(object, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	head = head[:n]
+
+	mimeType, err := checkFileType(deps, head, declared)
+	if err != nil {
+		return "", err
+	}
+
+	format, err := checkImageHeader(deps, head)
+	if err != nil {
+		return "", err
+	}
+
+	if format == imaging.FormatGIF {
+		rest := io.MultiReader(bytes.NewReader(head), object)
+		_, err := io.Copy(io.Discard, imaging.LimitFrames(rest, imageLimits(deps)))
+		if errors.Is(err, imaging.ErrLimitExceeded) || errors.Is(err, imaging.ErrMalformed) {
+			return "", imageLimitError(err)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return mimeType, nil
+}
+
+// declaredContentType vets the type a client announces before any content
+// arrives. Known types that are not allowed are rejected early; anything
+// unknown is stored as application/octet-stream, which browsers download
+// instead of rendering, until sniffing decides.
+func declaredContentType(deps Deps, declared string) (string, error) {
+	if !filetype.Known(declared) {
+		return filetype.Unknown, nil
+	}
+
+	mimeType := filetype.Normalize(declared)
+	for _, allowed := range deps.Config.Upload.AllowedTypes {
+		if filetype.Normalize(allowed) == mimeType {
+			return mimeType, nil
+		}
+	}
+
+	return "", &model.FileTypeError{Declared: declared, Err: filetype.ErrNotAllowed}
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/adorufus/imgupper/internal/model"
+	"github.com/adorufus/imgupper/pkg/filetype"
+	"github.com/adorufus/imgupper/pkg/imaging"
+	"github.com/adorufus/imgupper/pkg/middleware"
+	"github.com/adorufus/imgupper/pkg/storage"
+)
+
+// maxLogoSize bounds uploaded watermark logos
+const maxLogoSize = 5 << 20
+
+// WatermarkService manages the watermark templates of the current user
+type WatermarkService interface {
+	Create(ctx context.Context, watermark model.Watermark) (model.Watermark, error)
+	List(ctx context.Context) ([]model.Watermark, error)
+	Get(ctx context.Context, id int64) (model.Watermark, error)
+	Update(ctx context.Context, id int64, watermark model.Watermark) (model.Watermark, error)
+	Delete(ctx context.Context, id int64) error
+	UploadLogo(ctx context.Context, id int64, body io.Reader) (model.Watermark, error)
+	GetDefault(ctx context.Context) (model.WatermarkDefault, error)
+	SetDefault(ctx context.Context, def model.WatermarkDefault) (model.WatermarkDefault, error)
+}
+
+// watermarkService implements WatermarkService
+type watermarkService struct {
+	deps Deps
+}
+
+// NewWatermarkService creates a new WatermarkService
+func NewWatermarkService(deps Deps) WatermarkService {
+	return &watermarkService{
+		deps: deps,
+	}
+}
+
+// Create creates a watermark owned by the current user
+func (s *watermarkService) Create(ctx context.Context, watermark model.Watermark) (model.Watermark, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.Watermark{}, err
+	}
+
+	if err := watermark.Validate(); err != nil {
+		return model.Watermark{}, err
+	}
+	watermark.UserID = user.UserID
+
+	return s.deps.Repos.Watermark.Create(ctx, watermark)
+}
+
+// List lists the watermarks of the current user
+func (s *watermarkService) List(ctx context.Context) ([]model.Watermark, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.deps.Repos.Watermark.GetByUserID(ctx, user.UserID)
+}
+
+// Get gets a watermark of the current user
+func (s *watermarkService) Get(ctx context.Context, id int64) (model.Watermark, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.Watermark{}, err
+	}
+
+	watermark, err := s.deps.Repos.Watermark.GetByID(ctx, id)
+	if err != nil {
+		return model.Watermark{}, err
+	}
+
+	if watermark.UserID != user.UserID {
+		return model.Watermark{}, model.ErrForbidden
+	}
+
+	return watermark, nil
+}
+
+// Update replaces the settings of a watermark, its logo is kept
+func (s *watermarkService) Update(ctx context.Context, id int64, watermark model.Watermark) (model.Watermark, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return model.Watermark{}, err
+	}
+
+	if err := watermark.Validate(); err != nil {
+		return model.Watermark{}, err
+	}
+	watermark.ID = id
+
+	return s.deps.Repos.Watermark.Update(ctx, watermark)
+}
+
+// Delete deletes a watermark and its logo. Files watermarked with it keep
+// their variants.
+func (s *watermarkService) Delete(ctx context.Context, id int64) error {
+	watermark, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.deps.Repos.Watermark.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	if watermark.ImageKey != "" {
+		if err := s.deps.Storage.Delete(ctx, watermark.ImageKey); err != nil {
+			s.deps.Logger.Warn("Failed to delete watermark logo", "error", err, "key", watermark.ImageKey)
+		}
+	}
+
+	return nil
+}
+
+// UploadLogo stores the PNG logo of an image watermark privately
+func (s *watermarkService) UploadLogo(ctx context.Context, id int64, body io.Reader) (model.Watermark, error) {
+	watermark, err := s.Get(ctx, id)
+	if err != nil {
+		return model.Watermark{}, err
+	}
+
+	if watermark.Kind != model.WatermarkImage {
+		return model.Watermark{}, fmt.Errorf("%w: only image watermarks have a logo", model.ErrInvalidWatermark)
+	}
+
+	data, err := io.ReadAll(&maxSizeReader{r: body, remaining: maxLogoSize})
+	if err != nil {
+		return model.Watermark{}, err
+	}
+
+	if detected := filetype.Detect(data); detected != "image/png" {
+		return model.Watermark{}, &model.FileTypeError{Detected: detected, Err: filetype.ErrNotAllowed}
+	}
+	if _, _, err := imaging.DecodeLimited(bytes.NewReader(data), imageLimits(s.deps)); err != nil {
+		return model.Watermark{}, imageLimitError(err)
+	}
+
+	key := fmt.Sprintf("watermarks/%d/%d.png", watermark.UserID, watermark.ID)
+	err = s.deps.Storage.Put(ctx, key, bytes.NewReader(data), storage.PutOptions{
+		ContentType:   "image/png",
+		ContentLength: int64(len(data)),
+	})
+	if err != nil {
+		return model.Watermark{}, fmt.Errorf("failed to store watermark logo: %w", err)
+	}
+
+	return s.deps.Repos.Watermark.SetImageKey(ctx, id, key)
+}
+
+// GetDefault gets the watermark applied to the current user's uploads
+func (s *watermarkService) GetDefault(ctx context.Context) (model.WatermarkDefault, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.WatermarkDefault{}, err
+	}
+
+	watermark, err := s.deps.Repos.Watermark.GetDefault(ctx, user.UserID)
+	if errors.Is(err, model.ErrNotFound) {
+		return model.WatermarkDefault{}, nil
+	}
+	if err != nil {
+		return model.WatermarkDefault{}, err
+	}
+
+	return model.WatermarkDefault{WatermarkID: &watermark.ID}, nil
+}
+
+// SetDefault selects the watermark applied to the current user's uploads
+func (s *watermarkService) SetDefault(ctx context.Context, def model.WatermarkDefault) (model.WatermarkDefault, error) {
+	user, err := middleware.GetUserFromContext(ctx)
+	if err != nil {
+		return model.WatermarkDefault{}, err
+	}
+
+	if def.WatermarkID != nil {
+		if _, err := s.Get(ctx, *def.WatermarkID); err != nil {
+			return model.WatermarkDefault{}, err
+		}
+	}
+
+	if err := s.deps.Repos.Watermark.SetDefault(ctx, user.UserID, def.WatermarkID); err != nil {
+		return model.WatermarkDefault{}, err
+	}
+
+	return def, nil
+}
+
+// hasWatermark reports whether a user's uploads get a watermark, in the
+// same cases as resolveWatermark but without loading the logo
+func hasWatermark(ctx context.Context, deps Deps, userID int64) (bool, error) {
+	watermark, err := deps.Repos.Watermark.GetDefault(ctx, userID)
+	if errors.Is(err, model.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return watermark.Kind != model.WatermarkImage || watermark.ImageKey != "", nil
+}
+
+// resolveWatermark loads the watermark drawn over a user's display images,
+// nil when there is none or its logo was never uploaded
+func resolveWatermark(ctx context.Context, deps Deps, userID int64) (*imaging.Watermark, error) {
+	watermark, err := deps.Repos.Watermark.GetDefault(ctx, userID)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return loadWatermark(ctx, deps, watermark)
+}
+
+// loadWatermark prepares a watermark for drawing, nil when its logo was
+// never uploaded
+func loadWatermark(ctx context.Context, deps Deps, watermark model.Watermark) (*imaging.Watermark, error) {
+	var logo image.Image
+	if watermark.Kind == model.WatermarkImage {
+		if watermark.ImageKey == "" {
+			return nil, nil
+		}
+
+		object, _, err := deps.Storage.Get(ctx, watermark.ImageKey)
+		if err != nil {
+			return nil, err
+		}
+		defer object.Close()
+
+		logo, _, err = imaging.DecodeLimited(object, imageLimits(deps))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode watermark logo: %w", err)
+		}
+	}
+
+	return &imaging.Watermark{
+		Text:     watermark.Text,
+		Logo:     logo,
+		Position: watermark.Position,
+		Opacity:  watermark.Opacity,
+		Scale:    watermark.Scale,
+	}, nil
+}
@@ -0,0 +1,4 @@
+ALTER TABLE files
+    DROP COLUMN IF EXISTS public_base_url,
+    DROP COLUMN IF EXISTS object_key,
+    DROP COLUMN IF EXISTS bucket;
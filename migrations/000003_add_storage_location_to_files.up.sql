@@ -0,0 +1,14 @@
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS bucket VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS object_key TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS public_base_url TEXT NOT NULL DEFAULT '';
+
+-- Files uploaded before the location was configurable all live in the original bucket
+UPDATE files
+SET
+    bucket = 'ember-imgupper',
+    public_base_url = 'https://cdn.imgupper.web.id/',
+    object_key = SUBSTRING(bucket_url FROM LENGTH('https://cdn.imgupper.web.id/') + 1)
+WHERE
+    object_key = ''
+    AND bucket_url LIKE 'https://cdn.imgupper.web.id/%';
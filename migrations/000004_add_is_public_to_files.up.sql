@@ -0,0 +1,2 @@
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS is_public BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,17 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role VARCHAR(50) NOT NULL DEFAULT 'user';
+
+CREATE TABLE
+    IF NOT EXISTS audit_log (
+        id SERIAL PRIMARY KEY,
+        actor_id INTEGER NOT NULL,
+        action VARCHAR(100) NOT NULL,
+        subject_user_id INTEGER,
+        resource_id INTEGER,
+        created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            CONSTRAINT fk_audit_actor_id FOREIGN KEY (actor_id) REFERENCES users (id)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log (actor_id);
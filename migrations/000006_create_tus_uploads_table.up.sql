@@ -0,0 +1,26 @@
+CREATE TABLE
+    IF NOT EXISTS tus_uploads (
+        id UUID PRIMARY KEY,
+        user_id INTEGER NOT NULL,
+        upload_length BIGINT NOT NULL,
+        upload_offset BIGINT NOT NULL DEFAULT 0,
+        filename VARCHAR(255) NOT NULL,
+        mime_type VARCHAR(100) NOT NULL,
+        is_public BOOLEAN NOT NULL DEFAULT FALSE,
+        object_key TEXT NOT NULL,
+        multipart_id TEXT NOT NULL,
+        parts JSONB NOT NULL DEFAULT '[]',
+        pending_size BIGINT NOT NULL DEFAULT 0,
+        expires_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            updated_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            CONSTRAINT fk_tus_user_id FOREIGN KEY (user_id) REFERENCES users (id)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_tus_uploads_expires_at ON tus_uploads (expires_at);
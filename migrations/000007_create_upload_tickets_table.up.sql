@@ -0,0 +1,19 @@
+CREATE TABLE
+    IF NOT EXISTS upload_tickets (
+        id UUID PRIMARY KEY,
+        user_id INTEGER NOT NULL,
+        object_key TEXT NOT NULL,
+        filename VARCHAR(255) NOT NULL,
+        mime_type VARCHAR(100) NOT NULL,
+        filesize BIGINT NOT NULL,
+        is_public BOOLEAN NOT NULL DEFAULT FALSE,
+        expires_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            CONSTRAINT fk_ticket_user_id FOREIGN KEY (user_id) REFERENCES users (id)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_upload_tickets_expires_at ON upload_tickets (expires_at);
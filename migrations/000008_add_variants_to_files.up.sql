@@ -0,0 +1,3 @@
+-- Maps a variant name such as w640 to the object key of the resized copy
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '{}';
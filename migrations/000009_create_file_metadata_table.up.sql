@@ -0,0 +1,28 @@
+CREATE TABLE
+    IF NOT EXISTS file_metadata (
+        file_id INTEGER PRIMARY KEY,
+        camera_make VARCHAR(255),
+        camera_model VARCHAR(255),
+        lens_model VARCHAR(255),
+        software VARCHAR(255),
+        exposure_time VARCHAR(50),
+        f_number DOUBLE PRECISION,
+        focal_length DOUBLE PRECISION,
+        iso INTEGER,
+        captured_at TIMESTAMP
+        WITH
+            TIME ZONE,
+            gps_latitude DOUBLE PRECISION,
+            gps_longitude DOUBLE PRECISION,
+            gps_altitude DOUBLE PRECISION,
+            xmp TEXT,
+            created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            CONSTRAINT fk_file_metadata_file_id FOREIGN KEY (file_id) REFERENCES files (id) ON DELETE CASCADE
+    );
+
+-- Photographers sort and filter by capture date and camera
+CREATE INDEX IF NOT EXISTS idx_file_metadata_captured_at ON file_metadata (captured_at);
+
+CREATE INDEX IF NOT EXISTS idx_file_metadata_camera ON file_metadata (camera_make, camera_model);
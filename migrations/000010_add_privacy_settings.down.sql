@@ -0,0 +1,6 @@
+ALTER TABLE files
+    DROP COLUMN IF EXISTS original_key;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS keep_original,
+    DROP COLUMN IF EXISTS metadata_policy;
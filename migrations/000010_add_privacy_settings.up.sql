@@ -0,0 +1,8 @@
+-- NULL falls back to the server default policy
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS metadata_policy VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS keep_original BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Private copy of the upload before metadata was scrubbed, empty when not kept
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS original_key TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE files
+    DROP COLUMN IF EXISTS blob_sha256;
+
+DROP TABLE IF EXISTS blobs;
@@ -0,0 +1,22 @@
+-- Uploads are stored once per distinct content, files reference the blob
+-- holding their bytes and ref_count tracks how many do
+CREATE TABLE
+    IF NOT EXISTS blobs (
+        sha256 CHAR(64) PRIMARY KEY,
+        object_key TEXT NOT NULL,
+        size BIGINT NOT NULL,
+        mime_type VARCHAR(100) NOT NULL,
+        ref_count INTEGER NOT NULL DEFAULT 0,
+        created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            updated_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL
+    );
+
+-- NULL for files stored before deduplication, which own their object
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS blob_sha256 CHAR(64) REFERENCES blobs (sha256);
+
+CREATE INDEX IF NOT EXISTS idx_files_blob_sha256 ON files (blob_sha256);
@@ -0,0 +1,4 @@
+-- 64-bit difference hash of the image pixels, NULL for files that are not
+-- decodable images
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS phash BIGINT;
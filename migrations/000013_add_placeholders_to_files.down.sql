@@ -0,0 +1,5 @@
+ALTER TABLE files
+    DROP COLUMN IF EXISTS average_color,
+    DROP COLUMN IF EXISTS dominant_color,
+    DROP COLUMN IF EXISTS lqip,
+    DROP COLUMN IF EXISTS blurhash;
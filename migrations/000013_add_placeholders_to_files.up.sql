@@ -0,0 +1,7 @@
+-- Shown by clients while the image loads, empty for files that are not
+-- decodable images
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS blurhash VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS lqip TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS dominant_color VARCHAR(7) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS average_color VARCHAR(7) NOT NULL DEFAULT '';
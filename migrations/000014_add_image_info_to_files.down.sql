@@ -0,0 +1,6 @@
+ALTER TABLE files
+    DROP COLUMN IF EXISTS duration_ms,
+    DROP COLUMN IF EXISTS animated,
+    DROP COLUMN IF EXISTS orientation,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS width;
@@ -0,0 +1,7 @@
+-- Displayed size with the EXIF orientation applied, zero when unknown
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS width INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS height INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS orientation SMALLINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS animated BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS duration_ms INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+ALTER TABLE files
+    DROP COLUMN IF EXISTS watermarked;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS watermark_id;
+
+DROP TABLE IF EXISTS watermarks;
@@ -0,0 +1,30 @@
+CREATE TABLE
+    IF NOT EXISTS watermarks (
+        id SERIAL PRIMARY KEY,
+        user_id INTEGER NOT NULL,
+        name VARCHAR(255) NOT NULL,
+        kind VARCHAR(10) NOT NULL,
+        text VARCHAR(255) NOT NULL DEFAULT '',
+        image_key TEXT NOT NULL DEFAULT '',
+        position VARCHAR(20) NOT NULL,
+        opacity DOUBLE PRECISION NOT NULL,
+        scale DOUBLE PRECISION NOT NULL,
+        created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            updated_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            CONSTRAINT fk_watermarks_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_watermarks_user_id ON watermarks (user_id);
+
+-- The watermark applied to the user's uploads, NULL for none
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS watermark_id INTEGER REFERENCES watermarks (id) ON DELETE SET NULL;
+
+-- Watermarked files own their variants instead of sharing them with the
+-- other files of their blob
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS watermarked BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_files_user_filename;
+DROP INDEX IF EXISTS idx_files_user_filesize;
+DROP INDEX IF EXISTS idx_files_user_created_at;
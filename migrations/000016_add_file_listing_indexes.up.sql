@@ -0,0 +1,4 @@
+-- Keyset pagination of a user's files for each sort order, id breaks ties
+CREATE INDEX IF NOT EXISTS idx_files_user_created_at ON files (user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_files_user_filesize ON files (user_id, filesize, id);
+CREATE INDEX IF NOT EXISTS idx_files_user_filename ON files (user_id, filename, id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS album_files;
+
+DROP TABLE IF EXISTS albums;
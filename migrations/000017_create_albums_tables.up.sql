@@ -0,0 +1,37 @@
+CREATE TABLE
+    IF NOT EXISTS albums (
+        id SERIAL PRIMARY KEY,
+        user_id INTEGER NOT NULL,
+        name VARCHAR(255) NOT NULL,
+        description TEXT NOT NULL DEFAULT '',
+        is_public BOOLEAN NOT NULL DEFAULT FALSE,
+        cover_file_id INTEGER,
+        created_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            updated_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            CONSTRAINT fk_albums_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+            CONSTRAINT fk_albums_cover_file_id FOREIGN KEY (cover_file_id) REFERENCES files (id) ON DELETE SET NULL
+    );
+
+CREATE INDEX IF NOT EXISTS idx_albums_user_id ON albums (user_id);
+
+-- Files of an album in their manual order, deleting a file removes it from
+-- its albums
+CREATE TABLE
+    IF NOT EXISTS album_files (
+        album_id INTEGER NOT NULL,
+        file_id INTEGER NOT NULL,
+        position INTEGER NOT NULL,
+        added_at TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL,
+            PRIMARY KEY (album_id, file_id),
+            CONSTRAINT fk_album_files_album_id FOREIGN KEY (album_id) REFERENCES albums (id) ON DELETE CASCADE,
+            CONSTRAINT fk_album_files_file_id FOREIGN KEY (file_id) REFERENCES files (id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IF NOT EXISTS idx_album_files_position ON album_files (album_id, position, file_id);
+CREATE INDEX IF NOT EXISTS idx_album_files_file_id ON album_files (file_id);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_files_tags;
+
+DROP INDEX IF EXISTS idx_files_search_vector;
+
+ALTER TABLE files
+    DROP COLUMN IF EXISTS search_vector;
+
+ALTER TABLE files
+    DROP COLUMN IF EXISTS tags;
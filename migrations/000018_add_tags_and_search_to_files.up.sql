@@ -0,0 +1,21 @@
+-- Free-form tags, normalised to lower case by the application
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+-- Full-text document of a file, recomputed by the application whenever its
+-- filename, tags or camera metadata change
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS search_vector TSVECTOR NOT NULL DEFAULT ''::tsvector;
+
+UPDATE files f
+SET search_vector =
+    setweight(to_tsvector('simple', regexp_replace(f.filename, '[._-]+', ' ', 'g')), 'A') ||
+    setweight(to_tsvector('simple', array_to_string(f.tags, ' ')), 'A') ||
+    setweight(to_tsvector('simple', concat_ws(' ', m.camera_make, m.camera_model, m.lens_model, m.software)), 'B')
+FROM files target
+LEFT JOIN file_metadata m ON m.file_id = target.id
+WHERE f.id = target.id;
+
+CREATE INDEX IF NOT EXISTS idx_files_search_vector ON files USING GIN (search_vector);
+
+CREATE INDEX IF NOT EXISTS idx_files_tags ON files USING GIN (tags);
@@ -0,0 +1,2 @@
+ALTER TABLE blobs
+    DROP COLUMN IF EXISTS is_public;
@@ -0,0 +1,4 @@
+-- Blobs first stored for a watermarked file are private, they are made
+-- public once a file without a watermark references them
+ALTER TABLE blobs
+    ADD COLUMN IF NOT EXISTS is_public BOOLEAN NOT NULL DEFAULT TRUE;
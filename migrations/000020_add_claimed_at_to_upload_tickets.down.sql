@@ -0,0 +1,2 @@
+ALTER TABLE upload_tickets
+    DROP COLUMN IF EXISTS claimed_at;
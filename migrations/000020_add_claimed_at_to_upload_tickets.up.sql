@@ -0,0 +1,4 @@
+-- Completed tickets are kept until they expire, so the purge also deletes
+-- objects PUT to their still valid URL after completion
+ALTER TABLE upload_tickets
+    ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMP WITH TIME ZONE;
@@ -1,33 +1,28 @@
 package cloudflare
 
 import (
-	"context"
 	"fmt"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 
 	appConfig "github.com/adorufus/imgupper/config"
 )
 
+// NewR2Client creates an S3 client for Cloudflare R2, deriving the endpoint
+// from the account id unless one is configured explicitly
 func NewR2Client(cfg appConfig.CloudflareConfig) (*s3.Client, error) {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("https://%s.r2.cloudflarestorage.com", cfg.AccountId)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "auto"
+	}
+	cfg.UsePathStyle = true
 
-	conf, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, "")),
-		config.WithRegion("auto"),
-	)
+	client, err := NewS3Client(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to initialize Cloudflare R2: %w", err)
 	}
 
-	client := s3.NewFromConfig(conf, func(o *s3.Options) {
-		o.UsePathStyle = true
-		o.BaseEndpoint = aws.String(fmt.Sprintf("https://%s.r2.cloudflarestorage.com", cfg.AccountId))
-	})
-
-	fmt.Printf("Init S3 success\n")
-
 	return client, nil
 }
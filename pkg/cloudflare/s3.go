@@ -0,0 +1,92 @@
+package cloudflare
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	appConfig "github.com/adorufus/imgupper/config"
+)
+
+// NewS3Client creates a client for any S3-compatible provider such as
+// AWS S3, MinIO or Backblaze B2, honouring the configured endpoint
+func NewS3Client(cfg appConfig.CloudflareConfig) (*s3.Client, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(cfg.Region),
+	}
+
+	if cfg.AccessKey != "" || cfg.SecretKey != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, ""),
+		))
+	}
+
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		httpClient := awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+			tr.TLSClientConfig = tlsConfig
+		})
+		opts = append(opts, config.WithHTTPClient(httpClient))
+	}
+
+	conf, err := config.LoadDefaultConfig(context.TODO(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize S3 client: %w", err)
+	}
+
+	// MinIO and most S3-compatible providers accept any region for signing
+	if conf.Region == "" {
+		conf.Region = "us-east-1"
+	}
+
+	client := s3.NewFromConfig(conf, func(o *s3.Options) {
+		o.UsePathStyle = cfg.UsePathStyle
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+
+	return client, nil
+}
+
+// newTLSConfig builds a custom TLS config, returning nil when the defaults apply
+func newTLSConfig(cfg appConfig.TLSConfig) (*tls.Config, error) {
+	if !cfg.InsecureSkipVerify && cfg.CAFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA file")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,458 @@
+// Package exif extracts camera metadata from the EXIF and XMP blocks of JPEG
+// and TIFF-based files (TIFF, CR2, NEF, ARW, DNG) using only the standard
+// library.
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// MaxScanSize bounds how much of a file is read looking for metadata. The
+// EXIF and XMP blocks of JPEGs and the IFDs of raw files sit near the start.
+const MaxScanSize = 4 << 20
+
+// ErrNoMetadata is returned when a file carries no EXIF or XMP block
+var ErrNoMetadata = errors.New("no metadata found")
+
+// Metadata is the camera metadata of a file. Zero values mean unknown.
+type Metadata struct {
+	Make         string
+	Model        string
+	LensModel    string
+	Software     string
+	ExposureTime string
+	FNumber      float64
+	FocalLength  float64
+	ISO          int
+	Orientation  int
+	CapturedAt   time.Time
+	GPS          *GPS
+	XMP          string
+}
+
+// GPS is a position in decimal degrees, altitude in meters above sea level
+type GPS struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  *float64
+}
+
+// Decode reads the metadata of a JPEG or TIFF-based file
+func Decode(r io.Reader) (*Metadata, error) {
+	br := bufio.NewReader(io.LimitReader(r, MaxScanSize))
+
+	// Sniff before buffering so other files are rejected cheaply
+	head, _ := br.Peek(8)
+	isJPEG := len(head) >= 2 && head[0] == 0xFF && head[1] == 0xD8
+	if !isJPEG && !isTIFF(head) {
+		return nil, ErrNoMetadata
+	}
+
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var tiff []byte
+	var xmp []byte
+
+	if isJPEG {
+		tiff, xmp = jpegSegments(data)
+	} else {
+		tiff = data
+	}
+
+	if tiff == nil && xmp == nil {
+		return nil, ErrNoMetadata
+	}
+
+	meta := &Metadata{}
+	if tiff != nil {
+		t, err := newTIFF(tiff)
+		if err != nil {
+			return nil, err
+		}
+		if packet := t.readTIFFMetadata(meta); xmp == nil {
+			xmp = packet
+		}
+	}
+
+	if xmp != nil {
+		meta.XMP = string(xmp)
+		meta.applyXMP()
+	}
+
+	return meta, nil
+}
+
+// isTIFF reports whether data starts with a TIFF header
+func isTIFF(data []byte) bool {
+	return len(data) >= 8 &&
+		(bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")))
+}
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+)
+
+// jpegSegments walks the JPEG markers up to the image data and returns the
+// TIFF structure of the EXIF block and the XMP packet, if present
+func jpegSegments(data []byte) (tiff, xmp []byte) {
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return
+		}
+		marker := data[pos+1]
+		// Fill bytes and markers without a length
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			pos += 2
+			continue
+		}
+		// Start of scan or end of image, metadata always precedes them
+		if marker == 0xDA || marker == 0xD9 {
+			return
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return
+		}
+		payload := data[pos+4 : end]
+
+		if marker == 0xE1 {
+			switch {
+			case tiff == nil && bytes.HasPrefix(payload, exifHeader):
+				tiff = payload[len(exifHeader):]
+			case xmp == nil && bytes.HasPrefix(payload, xmpHeader):
+				xmp = payload[len(xmpHeader):]
+			}
+		}
+
+		pos = end
+	}
+	return
+}
+
+// TIFF tags read by the package
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagSoftware         = 0x0131
+	tagDateTime         = 0x0132
+	tagXMP              = 0x02BC
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagExposureTime     = 0x829A
+	tagFNumber          = 0x829D
+	tagISO              = 0x8827
+	tagDateTimeOriginal = 0x9003
+	tagOffsetOriginal   = 0x9011
+	tagFocalLength      = 0x920A
+	tagLensModel        = 0xA434
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+)
+
+// TIFF field types
+const (
+	typeByte      = 1
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeUndefined = 7
+	typeSLong     = 9
+	typeSRational = 10
+	typeIFD       = 13
+)
+
+// typeSizes is the size in bytes of one value of each field type
+var typeSizes = map[uint16]int{
+	typeByte: 1, typeASCII: 1, typeShort: 2, typeLong: 4, typeRational: 8,
+	6: 1, typeUndefined: 1, 8: 2, typeSLong: 4, typeSRational: 8, 11: 4, 12: 8,
+	typeIFD: 4,
+}
+
+// maxIFDEntries guards against corrupt entry counts
+const maxIFDEntries = 1024
+
+// tiffData is a TIFF structure with its byte order
+type tiffData struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// entry is one IFD field, value aliases the TIFF data so it can be
+// scrubbed in place
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// ifd maps tags to their fields
+type ifd map[uint16]entry
+
+func newTIFF(data []byte) (*tiffData, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("exif: truncated TIFF header")
+	}
+
+	t := &tiffData{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("exif: invalid byte order %q", data[:2])
+	}
+
+	if t.order.Uint16(data[2:]) != 42 {
+		return nil, fmt.Errorf("exif: invalid TIFF magic")
+	}
+
+	return t, nil
+}
+
+// firstIFD returns the offset of IFD0
+func (t *tiffData) firstIFD() uint32 {
+	return t.order.Uint32(t.data[4:])
+}
+
+// readIFD parses the directory at offset and returns it with the offset of
+// the next directory, 0 when it is the last one
+func (t *tiffData) readIFD(offset uint32) (ifd, uint32, error) {
+	if offset == 0 || uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, 0, fmt.Errorf("exif: IFD offset %d out of range", offset)
+	}
+
+	count := int(t.order.Uint16(t.data[offset:]))
+	if count > maxIFDEntries {
+		return nil, 0, fmt.Errorf("exif: IFD at %d has %d entries", offset, count)
+	}
+
+	start := int(offset) + 2
+	if start+count*12+4 > len(t.data) {
+		return nil, 0, fmt.Errorf("exif: truncated IFD at %d", offset)
+	}
+
+	dir := make(ifd, count)
+	for i := 0; i < count; i++ {
+		raw := t.data[start+i*12 : start+i*12+12]
+		e := entry{
+			tag:   t.order.Uint16(raw),
+			typ:   t.order.Uint16(raw[2:]),
+			count: t.order.Uint32(raw[4:]),
+		}
+
+		size, ok := typeSizes[e.typ]
+		if !ok {
+			continue
+		}
+		total := uint64(size) * uint64(e.count)
+		if total <= 4 {
+			e.value = raw[8 : 8+total]
+		} else {
+			valueOffset := uint64(t.order.Uint32(raw[8:]))
+			// Values outside the scanned prefix are skipped
+			if valueOffset+total > uint64(len(t.data)) {
+				continue
+			}
+			e.value = t.data[valueOffset : valueOffset+total]
+		}
+
+		dir[e.tag] = e
+	}
+
+	next := t.order.Uint32(t.data[start+count*12:])
+	return dir, next, nil
+}
+
+// readTIFFMetadata fills meta from IFD0 and its EXIF and GPS directories
+// and returns the XMP packet embedded in IFD0, if any
+func (t *tiffData) readTIFFMetadata(meta *Metadata) []byte {
+	ifd0, _, err := t.readIFD(t.firstIFD())
+	if err != nil {
+		return nil
+	}
+
+	meta.Make = t.ascii(ifd0, tagMake)
+	meta.Model = t.ascii(ifd0, tagModel)
+	meta.Software = t.ascii(ifd0, tagSoftware)
+	meta.Orientation = int(t.uint(ifd0, tagOrientation))
+	meta.CapturedAt = parseDateTime(t.ascii(ifd0, tagDateTime), "")
+
+	if offset := t.uint(ifd0, tagExifIFD); offset != 0 {
+		if exifIFD, _, err := t.readIFD(offset); err == nil {
+			meta.FNumber = t.rational(exifIFD, tagFNumber, 0)
+			meta.FocalLength = t.rational(exifIFD, tagFocalLength, 0)
+			meta.ISO = int(t.uint(exifIFD, tagISO))
+			meta.LensModel = t.ascii(exifIFD, tagLensModel)
+			meta.ExposureTime = t.exposure(exifIFD)
+			if captured := parseDateTime(t.ascii(exifIFD, tagDateTimeOriginal), t.ascii(exifIFD, tagOffsetOriginal)); !captured.IsZero() {
+				meta.CapturedAt = captured
+			}
+		}
+	}
+
+	if offset := t.uint(ifd0, tagGPSIFD); offset != 0 {
+		if gpsIFD, _, err := t.readIFD(offset); err == nil {
+			meta.GPS = t.gps(gpsIFD)
+		}
+	}
+
+	if e, ok := ifd0[tagXMP]; ok && (e.typ == typeByte || e.typ == typeUndefined) {
+		return e.value
+	}
+	return nil
+}
+
+// ascii returns a trimmed string field
+func (t *tiffData) ascii(dir ifd, tag uint16) string {
+	e, ok := dir[tag]
+	if !ok || e.typ != typeASCII {
+		return ""
+	}
+	return strings.TrimSpace(string(bytes.TrimRight(e.value, "\x00")))
+}
+
+// uint returns the first value of an integer field
+func (t *tiffData) uint(dir ifd, tag uint16) uint32 {
+	e, ok := dir[tag]
+	if !ok || e.count == 0 {
+		return 0
+	}
+	switch e.typ {
+	case typeByte:
+		return uint32(e.value[0])
+	case typeShort:
+		return uint32(t.order.Uint16(e.value))
+	case typeLong, typeSLong, typeIFD:
+		return t.order.Uint32(e.value)
+	default:
+		return 0
+	}
+}
+
+// rational returns the i-th value of a rational field as a float
+func (t *tiffData) rational(dir ifd, tag uint16, i int) float64 {
+	num, den, ok := t.fraction(dir, tag, i)
+	if !ok || den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
+
+// fraction returns the i-th numerator and denominator of a rational field
+func (t *tiffData) fraction(dir ifd, tag uint16, i int) (int64, int64, bool) {
+	e, ok := dir[tag]
+	if !ok || uint32(i) >= e.count {
+		return 0, 0, false
+	}
+
+	raw := e.value[i*8:]
+	switch e.typ {
+	case typeRational:
+		return int64(t.order.Uint32(raw)), int64(t.order.Uint32(raw[4:])), true
+	case typeSRational:
+		return int64(int32(t.order.Uint32(raw))), int64(int32(t.order.Uint32(raw[4:]))), true
+	default:
+		return 0, 0, false
+	}
+}
+
+// exposure formats the exposure time the way cameras display it, e.g. 1/250
+func (t *tiffData) exposure(dir ifd) string {
+	num, den, ok := t.fraction(dir, tagExposureTime, 0)
+	if !ok || num == 0 || den == 0 {
+		return ""
+	}
+
+	seconds := float64(num) / float64(den)
+	if seconds >= 1 {
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", seconds), ".0")
+	}
+	return fmt.Sprintf("1/%d", int64(math.Round(1/seconds)))
+}
+
+// gps converts the degrees, minutes and seconds of the GPS directory
+func (t *tiffData) gps(dir ifd) *GPS {
+	lat, okLat := t.degrees(dir, tagGPSLatitude)
+	lon, okLon := t.degrees(dir, tagGPSLongitude)
+	if !okLat || !okLon {
+		return nil
+	}
+
+	if t.ascii(dir, tagGPSLatitudeRef) == "S" {
+		lat = -lat
+	}
+	if t.ascii(dir, tagGPSLongitudeRef) == "W" {
+		lon = -lon
+	}
+
+	pos := &GPS{Latitude: lat, Longitude: lon}
+	if _, _, ok := t.fraction(dir, tagGPSAltitude, 0); ok {
+		alt := t.rational(dir, tagGPSAltitude, 0)
+		// Reference 1 means below sea level
+		if t.uint(dir, tagGPSAltitudeRef) == 1 {
+			alt = -alt
+		}
+		pos.Altitude = &alt
+	}
+
+	return pos
+}
+
+// degrees reads a three-rational degrees, minutes, seconds field
+func (t *tiffData) degrees(dir ifd, tag uint16) (float64, bool) {
+	e, ok := dir[tag]
+	if !ok || e.count < 3 {
+		return 0, false
+	}
+
+	deg := t.rational(dir, tag, 0) + t.rational(dir, tag, 1)/60 + t.rational(dir, tag, 2)/3600
+	return deg, true
+}
+
+// parseDateTime parses an EXIF "2006:01:02 15:04:05" timestamp with an
+// optional "+07:00" offset, EXIF times without one are taken as UTC
+func parseDateTime(value, offset string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	if offset != "" {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", value+offset); err == nil {
+			return t
+		}
+	}
+
+	t, err := time.Parse("2006:01:02 15:04:05", value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,174 @@
+package exif
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Camera RAW formats recognised by DetectRAW
+const (
+	FormatCR2 = "cr2"
+	FormatNEF = "nef"
+	FormatARW = "arw"
+	FormatDNG = "dng"
+)
+
+// ErrNotRAW is returned for files that are not a supported camera RAW
+var ErrNotRAW = errors.New("not a camera RAW file")
+
+// TIFF tags locating embedded previews
+const (
+	tagNewSubfileType  = 0x00FE
+	tagCompression     = 0x0103
+	tagStripOffsets    = 0x0111
+	tagStripByteCounts = 0x0117
+	tagSubIFDs         = 0x014A
+	tagJPEGOffset      = 0x0201
+	tagJPEGLength      = 0x0202
+	tagDNGVersion      = 0xC612
+)
+
+// maxRAWIFDs bounds the directories walked looking for previews
+const maxRAWIFDs = 32
+
+// RAW describes a camera RAW file and its largest embedded JPEG preview.
+// A zero PreviewLength means no preview was found.
+type RAW struct {
+	Format        string
+	PreviewOffset int64
+	PreviewLength int64
+}
+
+// RAWMimeType returns the conventional MIME type of a RAW format
+func RAWMimeType(format string) string {
+	switch format {
+	case FormatCR2:
+		return "image/x-canon-cr2"
+	case FormatNEF:
+		return "image/x-nikon-nef"
+	case FormatARW:
+		return "image/x-sony-arw"
+	case FormatDNG:
+		return "image/x-adobe-dng"
+	default:
+		return ""
+	}
+}
+
+// DetectRAW recognises a camera RAW file by its magic bytes and locates
+// its embedded preview. Only the first MaxScanSize bytes are read, the
+// preview itself is read by the caller from PreviewOffset.
+func DetectRAW(r io.Reader) (*RAW, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxScanSize))
+	if err != nil {
+		return nil, err
+	}
+	if !isTIFF(data) {
+		return nil, ErrNotRAW
+	}
+
+	t, err := newTIFF(data)
+	if err != nil {
+		return nil, ErrNotRAW
+	}
+	ifd0, _, err := t.readIFD(t.firstIFD())
+	if err != nil {
+		return nil, ErrNotRAW
+	}
+
+	raw := &RAW{}
+	cameraMake := strings.ToUpper(t.ascii(ifd0, tagMake))
+	switch {
+	case len(data) >= 10 && bytes.Equal(data[8:10], []byte("CR")):
+		raw.Format = FormatCR2
+	case hasTag(ifd0, tagDNGVersion):
+		raw.Format = FormatDNG
+	case strings.HasPrefix(cameraMake, "NIKON"):
+		raw.Format = FormatNEF
+	case strings.HasPrefix(cameraMake, "SONY"):
+		raw.Format = FormatARW
+	default:
+		// A plain TIFF
+		return nil, ErrNotRAW
+	}
+
+	if raw.Format == FormatCR2 {
+		// IFD0 of a CR2 holds the full-size JPEG as a single old-style
+		// JPEG strip, the raw data in IFD3 uses the same compression
+		raw.PreviewOffset, raw.PreviewLength = t.strip(ifd0)
+		return raw, nil
+	}
+
+	for _, dir := range t.walk(t.firstIFD()) {
+		offset, length := t.preview(dir, raw.Format)
+		if length > raw.PreviewLength {
+			raw.PreviewOffset, raw.PreviewLength = offset, length
+		}
+	}
+
+	return raw, nil
+}
+
+func hasTag(dir ifd, tag uint16) bool {
+	_, ok := dir[tag]
+	return ok
+}
+
+// walk returns the IFD chain starting at offset together with all their
+// sub-IFDs, breadth first
+func (t *tiffData) walk(offset uint32) []ifd {
+	var dirs []ifd
+	queue := []uint32{offset}
+	seen := make(map[uint32]bool)
+
+	for len(queue) > 0 && len(dirs) < maxRAWIFDs {
+		offset := queue[0]
+		queue = queue[1:]
+		if offset == 0 || seen[offset] {
+			continue
+		}
+		seen[offset] = true
+
+		dir, next, err := t.readIFD(offset)
+		if err != nil {
+			continue
+		}
+		dirs = append(dirs, dir)
+		queue = append(queue, next)
+
+		if e, ok := dir[tagSubIFDs]; ok && (e.typ == typeLong || e.typ == typeIFD) {
+			for i := 0; i+4 <= len(e.value); i += 4 {
+				queue = append(queue, t.order.Uint32(e.value[i:]))
+			}
+		}
+	}
+
+	return dirs
+}
+
+// preview returns the JPEG stored in a directory, if any
+func (t *tiffData) preview(dir ifd, format string) (int64, int64) {
+	if offset, length := t.uint(dir, tagJPEGOffset), t.uint(dir, tagJPEGLength); offset != 0 && length != 0 {
+		return int64(offset), int64(length)
+	}
+
+	// DNG previews are reduced-resolution images stored as baseline JPEG
+	// strips, the raw image itself is lossless JPEG with subfile type 0
+	if format == FormatDNG && t.uint(dir, tagNewSubfileType) == 1 && t.uint(dir, tagCompression) == 7 {
+		return t.strip(dir)
+	}
+
+	return 0, 0
+}
+
+// strip returns the location of a directory's image data when it is
+// stored as a single strip
+func (t *tiffData) strip(dir ifd) (int64, int64) {
+	offsets, ok := dir[tagStripOffsets]
+	if !ok || offsets.count != 1 {
+		return 0, 0
+	}
+	return int64(t.uint(dir, tagStripOffsets)), int64(t.uint(dir, tagStripByteCounts))
+}
@@ -0,0 +1,554 @@
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Policy selects which metadata Scrub removes
+type Policy string
+
+// Scrubbing policies
+const (
+	// PolicyKeep leaves the file untouched
+	PolicyKeep Policy = "keep"
+	// PolicyStripGPS removes the location and personal tags such as owner
+	// name and device serials, but keeps camera settings and capture time
+	PolicyStripGPS Policy = "strip_gps"
+	// PolicyStripAll removes every metadata block except the orientation,
+	// colour profile and what decoders need to render the image
+	PolicyStripAll Policy = "strip_all"
+)
+
+// Valid reports whether p is a known policy
+func (p Policy) Valid() bool {
+	switch p {
+	case PolicyKeep, PolicyStripGPS, PolicyStripAll:
+		return true
+	default:
+		return false
+	}
+}
+
+// ErrUnscrubbable is returned for files whose metadata cannot be proven
+// removed, such as TIFF files whose directories lie beyond the scanned start
+var ErrUnscrubbable = errors.New("exif: metadata cannot be removed from this file")
+
+// Tags that identify the photographer or the device
+const (
+	tagArtist           = 0x013B
+	tagHostComputer     = 0x013C
+	tagMakerNote        = 0x927C
+	tagImageUniqueID    = 0xA420
+	tagCameraOwnerName  = 0xA430
+	tagBodySerialNumber = 0xA431
+	tagLensSerialNumber = 0xA435
+	tagIPTC             = 0x83BB
+)
+
+var (
+	personalIFD0Tags = []uint16{tagArtist, tagHostComputer}
+	personalExifTags = []uint16{tagMakerNote, tagImageUniqueID, tagCameraOwnerName, tagBodySerialNumber, tagLensSerialNumber}
+)
+
+// maxMetadataChunk bounds the PNG metadata chunks held in memory
+const maxMetadataChunk = 8 << 20
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// CanScrub reports whether files of a MIME type have metadata Scrub removes
+func CanScrub(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/jpg", "image/pjpeg", "image/png", "image/tiff",
+		"image/x-canon-cr2", "image/x-nikon-nef", "image/x-sony-arw", "image/x-adobe-dng":
+		return true
+	default:
+		return false
+	}
+}
+
+// NewScrubReader returns a reader over src with metadata removed according
+// to policy. Files other than JPEG, PNG and TIFF-based ones pass through
+// unchanged. Close the reader to stop scrubbing early.
+func NewScrubReader(src io.Reader, policy Policy) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(Scrub(pw, src, policy))
+	}()
+	return pr
+}
+
+// Scrub copies src to dst, removing metadata according to policy
+func Scrub(dst io.Writer, src io.Reader, policy Policy) error {
+	br := bufio.NewReader(src)
+	if policy == PolicyKeep {
+		_, err := io.Copy(dst, br)
+		return err
+	}
+
+	head, _ := br.Peek(len(pngSignature))
+	switch {
+	case len(head) >= 2 && head[0] == 0xFF && head[1] == 0xD8:
+		return scrubJPEG(dst, br, policy)
+	case bytes.Equal(head, pngSignature):
+		return scrubPNG(dst, br, policy)
+	case isTIFF(head):
+		return scrubTIFFFile(dst, br, policy)
+	default:
+		_, err := io.Copy(dst, br)
+		return err
+	}
+}
+
+// scrubJPEG rewrites the segments preceding the image data and copies the
+// image data verbatim. Anything after the end of the image is dropped: the
+// secondary images of multi-picture files carry their own metadata, and
+// they cannot be rewritten without breaking the offsets of the MPF index,
+// which is dropped too.
+func scrubJPEG(dst io.Writer, br *bufio.Reader, policy Policy) error {
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil {
+		return err
+	}
+	if _, err := dst.Write(soi[:]); err != nil {
+		return err
+	}
+
+	for {
+		prefix, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if prefix != 0xFF {
+			return errors.New("exif: invalid JPEG marker")
+		}
+
+		marker, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		// Fill bytes before a marker
+		if marker == 0xFF {
+			if err := br.UnreadByte(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Image data and markers without a payload end the metadata section
+		if marker == 0xDA || marker == 0xD9 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			if _, err := dst.Write([]byte{0xFF, marker}); err != nil {
+				return err
+			}
+			if marker != 0xD9 {
+				if err := copyJPEGImage(dst, br); err != nil {
+					return err
+				}
+			}
+			// Read the rest so size limits on src still apply
+			_, err := io.Copy(io.Discard, br)
+			return err
+		}
+
+		var size [2]byte
+		if _, err := io.ReadFull(br, size[:]); err != nil {
+			return err
+		}
+		length := int(binary.BigEndian.Uint16(size[:]))
+		if length < 2 {
+			return errors.New("exif: invalid JPEG segment length")
+		}
+		payload := make([]byte, length-2)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return err
+		}
+
+		payload, keep := scrubJPEGSegment(marker, payload, policy)
+		if !keep {
+			continue
+		}
+
+		segment := make([]byte, 4, 4+len(payload))
+		segment[0], segment[1] = 0xFF, marker
+		binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+		if _, err := dst.Write(append(segment, payload...)); err != nil {
+			return err
+		}
+	}
+}
+
+// copyJPEGImage copies the image data up to and including the EOI marker.
+// Inside entropy-coded data 0xFF is always followed by a zero byte or a
+// marker, so the first EOI marker ends the image. A file truncated before
+// its EOI is copied as is.
+func copyJPEGImage(dst io.Writer, br *bufio.Reader) error {
+	for {
+		chunk, err := br.ReadSlice(0xFF)
+		if _, werr := dst.Write(chunk); werr != nil {
+			return werr
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		next, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Fill bytes before a marker
+		if next == 0xFF {
+			if err := br.UnreadByte(); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := dst.Write([]byte{next}); err != nil {
+			return err
+		}
+		if next == 0xD9 {
+			return nil
+		}
+	}
+}
+
+// mpfHeader starts the APP2 segment indexing the images of a multi-picture file
+var mpfHeader = []byte("MPF\x00")
+
+// scrubJPEGSegment returns the payload to write for a segment and whether
+// the segment is kept at all
+func scrubJPEGSegment(marker byte, payload []byte, policy Policy) ([]byte, bool) {
+	switch {
+	case marker == 0xE1 && bytes.HasPrefix(payload, exifHeader):
+		tiff := payload[len(exifHeader):]
+		if policy == PolicyStripAll {
+			minimal := orientationTIFF(tiff)
+			if minimal == nil {
+				return nil, false
+			}
+			return append(append([]byte{}, exifHeader...), minimal...), true
+		}
+		if err := scrubTIFF(tiff); err != nil {
+			// A block we cannot parse cannot be proven clean
+			return nil, false
+		}
+		return payload, true
+	case marker == 0xE1:
+		// XMP and other APP1 blocks
+		return payload, policy == PolicyKeep || (policy == PolicyStripGPS && !leaksPersonalData(payload))
+	case marker == 0xE2 && bytes.HasPrefix(payload, mpfHeader):
+		// The secondary images it points to are dropped
+		return nil, false
+	case marker == 0xE0, marker == 0xE2, marker == 0xEE:
+		// JFIF, ICC profile and Adobe colour transform are needed to render
+		return payload, true
+	case marker >= 0xE3 && marker <= 0xEF, marker == 0xFE:
+		// IPTC, vendor blocks and comments
+		return payload, policy != PolicyStripAll
+	default:
+		return payload, true
+	}
+}
+
+// leaksPersonalData reports whether a text metadata block mentions a
+// location or serial number
+func leaksPersonalData(block []byte) bool {
+	return bytes.Contains(block, []byte("GPS")) ||
+		bytes.Contains(block, []byte("SerialNumber")) ||
+		bytes.Contains(block, []byte("OwnerName"))
+}
+
+// scrubTIFF empties the GPS directory and the personal tags of an EXIF
+// TIFF structure in place, keeping every offset valid
+func scrubTIFF(data []byte) error {
+	t, err := newTIFF(data)
+	if err != nil {
+		return err
+	}
+
+	ifd0, _, err := t.readIFD(t.firstIFD())
+	if err != nil {
+		return err
+	}
+
+	// Values readIFD skips could not be cleared
+	for _, offset := range []uint32{t.firstIFD(), t.uint(ifd0, tagExifIFD), t.uint(ifd0, tagGPSIFD)} {
+		if err := t.checkValues(offset); err != nil {
+			return err
+		}
+	}
+
+	for _, tag := range personalIFD0Tags {
+		if e, ok := ifd0[tag]; ok {
+			clear(e.value)
+		}
+	}
+
+	if offset := t.uint(ifd0, tagExifIFD); offset != 0 {
+		exifIFD, _, err := t.readIFD(offset)
+		if err != nil {
+			return err
+		}
+		for _, tag := range personalExifTags {
+			if e, ok := exifIFD[tag]; ok {
+				clear(e.value)
+			}
+		}
+	}
+
+	if offset := t.uint(ifd0, tagGPSIFD); offset != 0 {
+		gpsIFD, _, err := t.readIFD(offset)
+		if err != nil {
+			return err
+		}
+		for _, e := range gpsIFD {
+			clear(e.value)
+		}
+
+		// Leave an empty directory behind so the pointer stays valid
+		count := int(t.order.Uint16(data[offset:]))
+		clear(data[offset : int(offset)+2+count*12+4])
+	}
+
+	return nil
+}
+
+// checkValues fails when a field of the directory at offset, 0 for none,
+// has its value outside the TIFF data
+func (t *tiffData) checkValues(offset uint32) error {
+	if offset == 0 {
+		return nil
+	}
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return fmt.Errorf("exif: IFD offset %d out of range", offset)
+	}
+
+	count := int(t.order.Uint16(t.data[offset:]))
+	start := int(offset) + 2
+	if count > maxIFDEntries || start+count*12 > len(t.data) {
+		return fmt.Errorf("exif: truncated IFD at %d", offset)
+	}
+
+	for i := 0; i < count; i++ {
+		raw := t.data[start+i*12 : start+i*12+12]
+		size, ok := typeSizes[t.order.Uint16(raw[2:])]
+		if !ok {
+			continue
+		}
+		total := uint64(size) * uint64(t.order.Uint32(raw[4:]))
+		if total > 4 && uint64(t.order.Uint32(raw[8:]))+total > uint64(len(t.data)) {
+			return fmt.Errorf("exif: value of tag %#04x out of range", t.order.Uint16(raw))
+		}
+	}
+
+	return nil
+}
+
+// scrubTIFFFile scrubs a TIFF-based file such as a TIFF, CR2, NEF, ARW or
+// DNG. The first MaxScanSize bytes, where cameras write the metadata
+// directories, are scrubbed in place and the image data is copied
+// verbatim. Files whose metadata lies further in are rejected.
+func scrubTIFFFile(dst io.Writer, br *bufio.Reader, policy Policy) error {
+	head := make([]byte, MaxScanSize)
+	n, err := io.ReadFull(br, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	head = head[:n]
+
+	if err := scrubTIFFHead(head, policy); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnscrubbable, err)
+	}
+
+	if _, err := dst.Write(head); err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, br)
+	return err
+}
+
+// scrubTIFFHead scrubs the metadata of a TIFF-based file in place. The
+// orientation and everything decoders need stay, with strip_all the XMP,
+// IPTC and EXIF values are cleared as well.
+func scrubTIFFHead(data []byte, policy Policy) error {
+	if err := scrubTIFF(data); err != nil {
+		return err
+	}
+
+	t, err := newTIFF(data)
+	if err != nil {
+		return err
+	}
+	ifd0, _, err := t.readIFD(t.firstIFD())
+	if err != nil {
+		return err
+	}
+
+	if e, ok := ifd0[tagXMP]; ok && (policy == PolicyStripAll || leaksPersonalData(e.value)) {
+		clear(e.value)
+	}
+
+	if policy != PolicyStripAll {
+		return nil
+	}
+
+	if e, ok := ifd0[tagIPTC]; ok {
+		clear(e.value)
+	}
+	if offset := t.uint(ifd0, tagExifIFD); offset != 0 {
+		exifIFD, _, err := t.readIFD(offset)
+		if err != nil {
+			return err
+		}
+		for _, e := range exifIFD {
+			clear(e.value)
+		}
+	}
+
+	return nil
+}
+
+// orientationTIFF builds a TIFF structure holding only the orientation of
+// tiff, or nil when it has none
+func orientationTIFF(tiff []byte) []byte {
+	t, err := newTIFF(tiff)
+	if err != nil {
+		return nil
+	}
+	ifd0, _, err := t.readIFD(t.firstIFD())
+	if err != nil {
+		return nil
+	}
+	orientation := t.uint(ifd0, tagOrientation)
+	if orientation == 0 {
+		return nil
+	}
+
+	// Header, one entry IFD0 at offset 8 and no next directory
+	out := make([]byte, 8+2+12+4)
+	copy(out, tiff[:4])
+	t.order.PutUint32(out[4:], 8)
+	t.order.PutUint16(out[8:], 1)
+	t.order.PutUint16(out[10:], tagOrientation)
+	t.order.PutUint16(out[12:], typeShort)
+	t.order.PutUint32(out[14:], 1)
+	t.order.PutUint16(out[18:], uint16(orientation))
+	return out
+}
+
+// scrubPNG copies PNG chunks, rewriting or dropping the metadata ones.
+// Image data chunks are streamed without buffering.
+func scrubPNG(dst io.Writer, br *bufio.Reader, policy Policy) error {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(br, signature); err != nil {
+		return err
+	}
+	if _, err := dst.Write(signature); err != nil {
+		return err
+	}
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		chunkType := string(header[4:])
+
+		if !isPNGMetadataChunk(chunkType) {
+			if _, err := dst.Write(header[:]); err != nil {
+				return err
+			}
+			if _, err := io.CopyN(dst, br, int64(length)+4); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if length > maxMetadataChunk {
+			return fmt.Errorf("exif: PNG %s chunk of %d bytes is too large", chunkType, length)
+		}
+		data := make([]byte, length+4)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return err
+		}
+		data = data[:length]
+
+		if policy == PolicyStripAll {
+			continue
+		}
+
+		switch chunkType {
+		case "eXIf":
+			if err := scrubTIFF(data); err != nil {
+				continue
+			}
+		case "iTXt", "tEXt", "zTXt":
+			if !isPlainPNGText(chunkType, data) || leaksPersonalData(data) {
+				continue
+			}
+		}
+
+		if err := writePNGChunk(dst, chunkType, data); err != nil {
+			return err
+		}
+	}
+}
+
+// isPNGMetadataChunk reports whether a chunk only carries metadata
+func isPNGMetadataChunk(chunkType string) bool {
+	switch chunkType {
+	case "eXIf", "iTXt", "tEXt", "zTXt", "tIME":
+		return true
+	default:
+		return false
+	}
+}
+
+// isPlainPNGText reports whether a text chunk can be inspected as is.
+// Compressed text and hex-encoded raw profiles, where tools such as
+// ImageMagick keep whole EXIF blocks, are not.
+func isPlainPNGText(chunkType string, data []byte) bool {
+	keyword, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok || bytes.HasPrefix(keyword, []byte("Raw profile type")) {
+		return false
+	}
+
+	switch chunkType {
+	case "zTXt":
+		return false
+	case "iTXt":
+		// The compression flag follows the keyword
+		return len(rest) > 0 && rest[0] == 0
+	default:
+		return true
+	}
+}
+
+// writePNGChunk writes a chunk with a freshly computed CRC
+func writePNGChunk(dst io.Writer, chunkType string, data []byte) error {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], chunkType)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	_, err := dst.Write(chunk)
+	return err
+}
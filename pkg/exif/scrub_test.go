@@ -0,0 +1,447 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+// testField is an IFD field of a TIFF structure built by buildTIFF
+type testField struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+func asciiField(tag uint16, s string) testField {
+	return testField{tag, typeASCII, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+func shortField(tag uint16, v uint16) testField {
+	return testField{tag, typeShort, 1, binary.LittleEndian.AppendUint16(nil, v)}
+}
+
+func longField(tag uint16, v uint32) testField {
+	return testField{tag, typeLong, 1, binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+func rationalField(tag uint16, values ...uint32) testField {
+	var value []byte
+	for _, v := range values {
+		value = binary.LittleEndian.AppendUint32(value, v)
+		value = binary.LittleEndian.AppendUint32(value, 1)
+	}
+	return testField{tag, typeRational, uint32(len(values)), value}
+}
+
+// ifdSize is the size of a directory followed by its out-of-line values
+func ifdSize(fields []testField) int {
+	size := 2 + len(fields)*12 + 4
+	for _, f := range fields {
+		if len(f.value) > 4 {
+			size += len(f.value)
+		}
+	}
+	return size
+}
+
+// encodeIFD lays out a little-endian directory at offset with its
+// out-of-line values directly after it
+func encodeIFD(fields []testField, offset int) []byte {
+	out := binary.LittleEndian.AppendUint16(nil, uint16(len(fields)))
+	values := offset + 2 + len(fields)*12 + 4
+	var data []byte
+	for _, f := range fields {
+		out = binary.LittleEndian.AppendUint16(out, f.tag)
+		out = binary.LittleEndian.AppendUint16(out, f.typ)
+		out = binary.LittleEndian.AppendUint32(out, f.count)
+		if len(f.value) <= 4 {
+			var inline [4]byte
+			copy(inline[:], f.value)
+			out = append(out, inline[:]...)
+			continue
+		}
+		out = binary.LittleEndian.AppendUint32(out, uint32(values+len(data)))
+		data = append(data, f.value...)
+	}
+	out = binary.LittleEndian.AppendUint32(out, 0)
+	return append(out, data...)
+}
+
+// buildTIFF returns a TIFF structure with IFD0 pointing at an EXIF and a
+// GPS directory
+func buildTIFF(ifd0, exifIFD, gpsIFD []testField) []byte {
+	ifd0 = append(append([]testField{}, ifd0...), longField(tagExifIFD, 0), longField(tagGPSIFD, 0))
+	exifOffset := 8 + ifdSize(ifd0)
+	gpsOffset := exifOffset + ifdSize(exifIFD)
+	ifd0[len(ifd0)-2] = longField(tagExifIFD, uint32(exifOffset))
+	ifd0[len(ifd0)-1] = longField(tagGPSIFD, uint32(gpsOffset))
+
+	out := []byte("II*\x00\x08\x00\x00\x00")
+	out = append(out, encodeIFD(ifd0, 8)...)
+	out = append(out, encodeIFD(exifIFD, exifOffset)...)
+	return append(out, encodeIFD(gpsIFD, gpsOffset)...)
+}
+
+// cameraTIFF is the EXIF block of a photo taken with location services on
+func cameraTIFF() []byte {
+	return buildTIFF(
+		[]testField{
+			asciiField(tagMake, "Canon"),
+			shortField(tagOrientation, 6),
+			asciiField(tagArtist, "Jane Doe"),
+		},
+		[]testField{
+			shortField(tagISO, 400),
+			asciiField(tagBodySerialNumber, "SN-0451"),
+		},
+		[]testField{
+			asciiField(tagGPSLatitudeRef, "N"),
+			rationalField(tagGPSLatitude, 52, 22, 12),
+			asciiField(tagGPSLongitudeRef, "E"),
+			rationalField(tagGPSLongitude, 4, 53, 42),
+		},
+	)
+}
+
+// jpegSegment encodes a marker segment with its length
+func jpegSegment(marker byte, payload []byte) []byte {
+	out := []byte{0xFF, marker}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(payload)+2))
+	return append(out, payload...)
+}
+
+// entropyData stands in for scan data, with a stuffed 0xFF byte and a
+// restart marker that must survive scrubbing
+var entropyData = []byte{0x12, 0xFF, 0x00, 0x34, 0xFF, 0xD0, 0x56}
+
+// buildJPEG returns a JPEG with EXIF, XMP and MPF blocks followed by a
+// secondary image carrying its own EXIF, as cameras write MPF files
+func buildJPEG() []byte {
+	exifPayload := append(append([]byte{}, exifHeader...), cameraTIFF()...)
+	xmpPayload := append(append([]byte{}, xmpHeader...), `<x:xmpmeta><exif:GPSLatitude>52,22N</exif:GPSLatitude></x:xmpmeta>`...)
+
+	var out []byte
+	out = append(out, 0xFF, 0xD8)
+	out = append(out, jpegSegment(0xE0, []byte("JFIF\x00\x01\x02"))...)
+	out = append(out, jpegSegment(0xE1, exifPayload)...)
+	out = append(out, jpegSegment(0xE1, xmpPayload)...)
+	out = append(out, jpegSegment(0xE2, []byte("MPF\x00index"))...)
+	out = append(out, jpegSegment(0xFE, []byte("holiday"))...)
+	out = append(out, jpegSegment(0xDA, []byte{1, 1, 0, 0, 0x3F, 0})...)
+	out = append(out, entropyData...)
+	out = append(out, 0xFF, 0xD9)
+
+	// Secondary image
+	out = append(out, 0xFF, 0xD8)
+	out = append(out, jpegSegment(0xE1, exifPayload)...)
+	out = append(out, jpegSegment(0xDA, []byte{1, 1, 0, 0, 0x3F, 0})...)
+	return append(out, 0x9A, 0xFF, 0xD9)
+}
+
+func scrub(t *testing.T, data []byte, policy Policy) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if err := Scrub(&out, bytes.NewReader(data), policy); err != nil {
+		t.Fatalf("Scrub(%s) error = %v", policy, err)
+	}
+	return out.Bytes()
+}
+
+func TestScrubJPEG(t *testing.T) {
+	input := buildJPEG()
+
+	tests := []struct {
+		name        string
+		policy      Policy
+		make        string
+		iso         int
+		xmp         bool
+		comment     bool
+		removed     []string
+		secondImage bool
+	}{
+		{
+			name:        "keep",
+			policy:      PolicyKeep,
+			make:        "Canon",
+			iso:         400,
+			xmp:         true,
+			comment:     true,
+			secondImage: true,
+		},
+		{
+			name:    "strip gps",
+			policy:  PolicyStripGPS,
+			make:    "Canon",
+			iso:     400,
+			comment: true,
+			removed: []string{"Jane Doe", "SN-0451", "MPF\x00"},
+		},
+		{
+			name:    "strip all",
+			policy:  PolicyStripAll,
+			removed: []string{"Canon", "Jane Doe", "SN-0451", "MPF\x00", "holiday"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := scrub(t, input, tt.policy)
+
+			meta, err := Decode(bytes.NewReader(out))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if meta.Make != tt.make {
+				t.Errorf("Make = %q, want %q", meta.Make, tt.make)
+			}
+			if meta.ISO != tt.iso {
+				t.Errorf("ISO = %d, want %d", meta.ISO, tt.iso)
+			}
+			if meta.Orientation != 6 {
+				t.Errorf("Orientation = %d, want 6", meta.Orientation)
+			}
+			if keep := tt.policy == PolicyKeep; (meta.GPS != nil) != keep {
+				t.Errorf("GPS = %v, want present %v", meta.GPS, keep)
+			}
+			if (meta.XMP != "") != tt.xmp {
+				t.Errorf("XMP = %q, want present %v", meta.XMP, tt.xmp)
+			}
+			if got := bytes.Contains(out, []byte("holiday")); got != tt.comment {
+				t.Errorf("comment kept = %v, want %v", got, tt.comment)
+			}
+			for _, s := range tt.removed {
+				if bytes.Contains(out, []byte(s)) {
+					t.Errorf("output still contains %q", s)
+				}
+			}
+
+			if !bytes.Contains(out, append(append([]byte{}, entropyData...), 0xFF, 0xD9)) {
+				t.Error("image data was not copied verbatim")
+			}
+			if got := bytes.Count(out, []byte{0xFF, 0xD8}) > 1; got != tt.secondImage {
+				t.Errorf("secondary image kept = %v, want %v", got, tt.secondImage)
+			}
+			if !bytes.HasSuffix(out, []byte{0xFF, 0xD9}) {
+				t.Error("output does not end with EOI")
+			}
+		})
+	}
+}
+
+func TestScrubJPEGInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "garbage after SOI", input: []byte{0xFF, 0xD8, 0x00, 0x01}},
+		{name: "short segment length", input: []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01}},
+		{name: "truncated segment", input: []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x10, 0x01}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Scrub(&out, bytes.NewReader(tt.input), PolicyStripGPS); err == nil {
+				t.Error("Scrub() error = nil, want an error")
+			}
+		})
+	}
+}
+
+// pngChunk encodes a chunk with its CRC
+func pngChunk(chunkType string, data []byte) []byte {
+	var out bytes.Buffer
+	if err := writePNGChunk(&out, chunkType, data); err != nil {
+		panic(err)
+	}
+	return out.Bytes()
+}
+
+// pngChunks splits a PNG into its chunks, checking every CRC
+func pngChunks(t *testing.T, data []byte) map[string][][]byte {
+	t.Helper()
+	if !bytes.HasPrefix(data, pngSignature) {
+		t.Fatal("output lost the PNG signature")
+	}
+
+	chunks := make(map[string][][]byte)
+	for pos := len(pngSignature); pos < len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		body := data[pos+4 : pos+8+length]
+		if crc := binary.BigEndian.Uint32(data[pos+8+length:]); crc != crc32.ChecksumIEEE(body) {
+			t.Fatalf("chunk %s has a bad CRC", body[:4])
+		}
+		chunks[string(body[:4])] = append(chunks[string(body[:4])], body[4:])
+		pos += 12 + length
+	}
+	return chunks
+}
+
+func TestScrubPNG(t *testing.T) {
+	var input []byte
+	input = append(input, pngSignature...)
+	input = append(input, pngChunk("IHDR", make([]byte, 13))...)
+	input = append(input, pngChunk("eXIf", cameraTIFF())...)
+	input = append(input, pngChunk("tEXt", []byte("Title\x00Sunset"))...)
+	input = append(input, pngChunk("tEXt", []byte("Comment\x00GPS 52.37N"))...)
+	input = append(input, pngChunk("zTXt", []byte("Raw profile type exif\x00\x00compressed"))...)
+	input = append(input, pngChunk("tIME", []byte{0x07, 0xE8, 1, 2, 3, 4, 5})...)
+	input = append(input, pngChunk("IDAT", []byte{0x78, 0x9C, 0x03, 0x00})...)
+	input = append(input, pngChunk("IEND", nil)...)
+
+	tests := []struct {
+		name   string
+		policy Policy
+		counts map[string]int
+	}{
+		{
+			name:   "keep",
+			policy: PolicyKeep,
+			counts: map[string]int{"eXIf": 1, "tEXt": 2, "zTXt": 1, "tIME": 1},
+		},
+		{
+			name:   "strip gps",
+			policy: PolicyStripGPS,
+			counts: map[string]int{"eXIf": 1, "tEXt": 1, "zTXt": 0, "tIME": 1},
+		},
+		{
+			name:   "strip all",
+			policy: PolicyStripAll,
+			counts: map[string]int{"eXIf": 0, "tEXt": 0, "zTXt": 0, "tIME": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := pngChunks(t, scrub(t, input, tt.policy))
+
+			for _, chunkType := range []string{"IHDR", "IDAT", "IEND"} {
+				if len(chunks[chunkType]) != 1 {
+					t.Errorf("%s chunks = %d, want 1", chunkType, len(chunks[chunkType]))
+				}
+			}
+			for chunkType, want := range tt.counts {
+				if got := len(chunks[chunkType]); got != want {
+					t.Errorf("%s chunks = %d, want %d", chunkType, got, want)
+				}
+			}
+
+			if tt.policy != PolicyStripGPS {
+				return
+			}
+			if got := string(chunks["tEXt"][0]); got != "Title\x00Sunset" {
+				t.Errorf("kept text = %q, want the title", got)
+			}
+			tiff, err := newTIFF(chunks["eXIf"][0])
+			if err != nil {
+				t.Fatalf("newTIFF() error = %v", err)
+			}
+			meta := &Metadata{}
+			tiff.readTIFFMetadata(meta)
+			if meta.GPS != nil || meta.Make != "Canon" {
+				t.Errorf("eXIf GPS = %v, Make = %q, want no GPS and the make", meta.GPS, meta.Make)
+			}
+		})
+	}
+}
+
+func TestScrubTIFF(t *testing.T) {
+	pixels := bytes.Repeat([]byte{0xAB}, 64)
+	input := append(cameraTIFF(), pixels...)
+
+	tests := []struct {
+		name   string
+		policy Policy
+		make   string
+		iso    int
+	}{
+		{name: "strip gps", policy: PolicyStripGPS, make: "Canon", iso: 400},
+		{name: "strip all", policy: PolicyStripAll, make: "Canon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := scrub(t, input, tt.policy)
+
+			if len(out) != len(input) {
+				t.Fatalf("len = %d, want %d, offsets must not move", len(out), len(input))
+			}
+			if !bytes.HasSuffix(out, pixels) {
+				t.Error("image data was not copied verbatim")
+			}
+			for _, s := range []string{"Jane Doe", "SN-0451"} {
+				if bytes.Contains(out, []byte(s)) {
+					t.Errorf("output still contains %q", s)
+				}
+			}
+
+			meta, err := Decode(bytes.NewReader(out))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if meta.GPS != nil {
+				t.Errorf("GPS = %v, want nil", meta.GPS)
+			}
+			if meta.Make != tt.make || meta.ISO != tt.iso || meta.Orientation != 6 {
+				t.Errorf("Make, ISO, Orientation = %q, %d, %d, want %q, %d, 6", meta.Make, meta.ISO, meta.Orientation, tt.make, tt.iso)
+			}
+		})
+	}
+}
+
+func TestScrubTIFFUnscrubbable(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{
+			name:  "IFD0 out of range",
+			input: []byte("II*\x00\xFF\xFF\x00\x00\x00\x00\x00\x00"),
+		},
+		{
+			name: "value out of range",
+			input: func() []byte {
+				data := cameraTIFF()
+				// Point the Make value past the end of the file
+				binary.LittleEndian.PutUint32(data[8+2+8:], uint32(len(data)+100))
+				return data
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Scrub(&out, bytes.NewReader(tt.input), PolicyStripGPS)
+			if !errors.Is(err, ErrUnscrubbable) {
+				t.Errorf("Scrub() error = %v, want ErrUnscrubbable", err)
+			}
+		})
+	}
+}
+
+func TestCanScrub(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		want     bool
+	}{
+		{"image/jpeg", true},
+		{"image/png", true},
+		{"image/tiff", true},
+		{"image/x-canon-cr2", true},
+		{"image/webp", false},
+		{"image/heic", false},
+		{"video/mp4", false},
+	}
+
+	for _, tt := range tests {
+		if got := CanScrub(tt.mimeType); got != tt.want {
+			t.Errorf("CanScrub(%q) = %v, want %v", tt.mimeType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package exif
+
+import (
+	"html"
+	"strings"
+	"time"
+)
+
+// applyXMP fills fields the EXIF block left empty from the XMP packet.
+// Editors such as Lightroom often only keep the lens and dates in XMP.
+func (m *Metadata) applyXMP() {
+	fill := func(dst *string, names ...string) {
+		if *dst != "" {
+			return
+		}
+		for _, name := range names {
+			if v := xmpValue(m.XMP, name); v != "" {
+				*dst = v
+				return
+			}
+		}
+	}
+
+	fill(&m.Make, "tiff:Make")
+	fill(&m.Model, "tiff:Model")
+	fill(&m.LensModel, "exifEX:LensModel", "aux:Lens")
+	fill(&m.Software, "xmp:CreatorTool")
+
+	if m.CapturedAt.IsZero() {
+		for _, name := range []string{"exif:DateTimeOriginal", "photoshop:DateCreated", "xmp:CreateDate"} {
+			if t := parseXMPDate(xmpValue(m.XMP, name)); !t.IsZero() {
+				m.CapturedAt = t
+				break
+			}
+		}
+	}
+}
+
+// xmpValue returns a simple property written either as an attribute,
+// name="value", or as an element, <name>value</name>
+func xmpValue(packet, name string) string {
+	if i := strings.Index(packet, name+`="`); i >= 0 {
+		rest := packet[i+len(name)+2:]
+		if end := strings.IndexByte(rest, '"'); end >= 0 {
+			return strings.TrimSpace(html.UnescapeString(rest[:end]))
+		}
+	}
+
+	open := "<" + name + ">"
+	if i := strings.Index(packet, open); i >= 0 {
+		rest := packet[i+len(open):]
+		if end := strings.Index(rest, "</"+name+">"); end >= 0 {
+			value := rest[:end]
+			// Structured values such as rdf:Seq are not simple properties
+			if strings.Contains(value, "<") {
+				return ""
+			}
+			return strings.TrimSpace(html.UnescapeString(value))
+		}
+	}
+
+	return ""
+}
+
+// parseXMPDate parses the ISO 8601 subsets used by XMP dates
+func parseXMPDate(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04-07:00",
+		"2006-01-02T15:04",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,146 @@
+// Package filetype identifies uploaded files by their magic bytes rather
+// than the Content-Type or filename a client claims.
+package filetype
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"strings"
+
+	"github.com/adorufus/imgupper/pkg/exif"
+)
+
+// SniffLen is how many leading bytes Detect needs, enough for the TIFF
+// directories that tell camera RAW formats apart
+const SniffLen = 64 << 10
+
+// Unknown is reported for content that matches no known signature
+const Unknown = "application/octet-stream"
+
+// extensions maps each detectable MIME type to the extension used in keys
+var extensions = map[string]string{
+	"image/jpeg":       ".jpg",
+	"image/png":        ".png",
+	"image/gif":        ".gif",
+	"image/webp":       ".webp",
+	"image/tiff":       ".tif",
+	"image/heic":       ".heic",
+	"image/avif":       ".avif",
+	"video/mp4":        ".mp4",
+	"video/quicktime":  ".mov",
+	"video/webm":       ".webm",
+	"video/x-matroska": ".mkv",
+	"video/x-msvideo":  ".avi",
+
+	exif.RAWMimeType(exif.FormatCR2): ".cr2",
+	exif.RAWMimeType(exif.FormatNEF): ".nef",
+	exif.RAWMimeType(exif.FormatARW): ".arw",
+	exif.RAWMimeType(exif.FormatDNG): ".dng",
+}
+
+// aliases maps non-canonical MIME types clients send to the canonical one
+var aliases = map[string]string{
+	"image/jpg":         "image/jpeg",
+	"image/pjpeg":       "image/jpeg",
+	"image/x-png":       "image/png",
+	"image/heif":        "image/heic",
+	"video/x-quicktime": "video/quicktime",
+	"video/avi":         "video/x-msvideo",
+	"image/x-dng":       exif.RAWMimeType(exif.FormatDNG),
+}
+
+// ftypBrands maps ISO base media major brands to MIME types
+var ftypBrands = map[string]string{
+	"heic": "image/heic", "heix": "image/heic", "hevc": "image/heic", "heim": "image/heic",
+	"heis": "image/heic", "mif1": "image/heic", "msf1": "image/heic",
+	"avif": "image/avif", "avis": "image/avif",
+	"qt  ": "video/quicktime",
+	"isom": "video/mp4", "iso2": "video/mp4", "iso4": "video/mp4", "iso5": "video/mp4",
+	"iso6": "video/mp4", "mp41": "video/mp4", "mp42": "video/mp4", "avc1": "video/mp4",
+	"dash": "video/mp4", "M4V ": "video/mp4", "MSNV": "video/mp4",
+}
+
+// Detect returns the MIME type of content starting with head, or Unknown
+func Detect(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return "image/gif"
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && string(head[8:12]) == "WEBP":
+		return "image/webp"
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && string(head[8:12]) == "AVI ":
+		return "video/x-msvideo"
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		if raw, err := exif.DetectRAW(bytes.NewReader(head)); err == nil {
+			return exif.RAWMimeType(raw.Format)
+		}
+		return "image/tiff"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		if mimeType, ok := ftypBrands[string(head[8:12])]; ok {
+			return mimeType
+		}
+		return Unknown
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		// Matroska, WebM declares its doc type in the EBML header
+		if bytes.Contains(head[:min(len(head), 64)], []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	default:
+		return Unknown
+	}
+}
+
+// Normalize lower-cases a MIME type, drops its parameters and resolves
+// common aliases
+func Normalize(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(mimeType))
+	}
+	if canonical, ok := aliases[mediaType]; ok {
+		return canonical
+	}
+	return mediaType
+}
+
+// Known reports whether a MIME type is one Detect can report. Clients that
+// send anything else, typically application/octet-stream for RAW files,
+// are treated as not having declared a type.
+func Known(mimeType string) bool {
+	_, ok := extensions[Normalize(mimeType)]
+	return ok
+}
+
+// Extension returns the key extension for a MIME type, or "" when unknown
+func Extension(mimeType string) string {
+	return extensions[Normalize(mimeType)]
+}
+
+// ErrMismatch is returned by Check when the declared type contradicts the content
+var ErrMismatch = errors.New("declared type does not match content")
+
+// ErrNotAllowed is returned by Check when the detected type is not allowed
+var ErrNotAllowed = errors.New("file type not allowed")
+
+// Check detects the type of head and validates it against allowed and
+// against the type the client declared, returning the detected type
+func Check(head []byte, declared string, allowed []string) (string, error) {
+	detected := Detect(head)
+
+	if Known(declared) && Normalize(declared) != detected {
+		return detected, ErrMismatch
+	}
+
+	for _, mimeType := range allowed {
+		if Normalize(mimeType) == detected {
+			return detected, nil
+		}
+	}
+
+	return detected, ErrNotAllowed
+}
@@ -0,0 +1,135 @@
+package filetype
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// tiffWithMake returns a little-endian TIFF header whose IFD0 only holds
+// the camera make
+func tiffWithMake(cameraMake string) []byte {
+	value := append([]byte(cameraMake), 0)
+	out := []byte("II*\x00\x08\x00\x00\x00\x01\x00")
+	out = binary.LittleEndian.AppendUint16(out, 0x010F)
+	out = binary.LittleEndian.AppendUint16(out, 2)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(value)))
+	out = binary.LittleEndian.AppendUint32(out, 26)
+	out = binary.LittleEndian.AppendUint32(out, 0)
+	return append(out, value...)
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{name: "jpeg", head: []byte{0xFF, 0xD8, 0xFF, 0xE0}, want: "image/jpeg"},
+		{name: "png", head: []byte("\x89PNG\r\n\x1a\n\x00\x00"), want: "image/png"},
+		{name: "gif87a", head: []byte("GIF87a"), want: "image/gif"},
+		{name: "gif89a", head: []byte("GIF89a\x01\x00"), want: "image/gif"},
+		{name: "webp", head: []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), want: "image/webp"},
+		{name: "avi", head: []byte("RIFF\x00\x00\x00\x00AVI LIST"), want: "video/x-msvideo"},
+		{name: "riff without form", head: []byte("RIFF\x00\x00"), want: Unknown},
+		{name: "tiff", head: tiffWithMake("Acme Scanner"), want: "image/tiff"},
+		{name: "big-endian tiff", head: []byte("MM\x00*\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00"), want: "image/tiff"},
+		{name: "cr2", head: []byte("II*\x00\x10\x00\x00\x00CR\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), want: "image/x-canon-cr2"},
+		{name: "nef", head: tiffWithMake("NIKON CORPORATION"), want: "image/x-nikon-nef"},
+		{name: "arw", head: tiffWithMake("SONY"), want: "image/x-sony-arw"},
+		{name: "heic", head: []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), want: "image/heic"},
+		{name: "avif", head: []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00"), want: "image/avif"},
+		{name: "mp4", head: []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00"), want: "video/mp4"},
+		{name: "quicktime", head: []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00"), want: "video/quicktime"},
+		{name: "unknown brand", head: []byte("\x00\x00\x00\x14ftypxxxx"), want: Unknown},
+		{name: "webm", head: []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm"), want: "video/webm"},
+		{name: "matroska", head: []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x88matroska"), want: "video/x-matroska"},
+		{name: "html", head: []byte("<!DOCTYPE html>"), want: Unknown},
+		{name: "empty", head: nil, want: Unknown},
+		{name: "truncated jpeg", head: []byte{0xFF, 0xD8}, want: Unknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.head); got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		want     string
+	}{
+		{"image/jpeg", "image/jpeg"},
+		{"IMAGE/JPEG", "image/jpeg"},
+		{"image/jpg", "image/jpeg"},
+		{"image/pjpeg", "image/jpeg"},
+		{"image/png; charset=binary", "image/png"},
+		{"image/heif", "image/heic"},
+		{"image/x-dng", "image/x-adobe-dng"},
+		{" video/mp4 ", "video/mp4"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.mimeType); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.mimeType, got, tt.want)
+		}
+	}
+}
+
+func TestExtension(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		want     string
+	}{
+		{"image/jpeg", ".jpg"},
+		{"image/jpg", ".jpg"},
+		{"image/x-canon-cr2", ".cr2"},
+		{"video/quicktime", ".mov"},
+		{"application/octet-stream", ""},
+		{"text/html", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Extension(tt.mimeType); got != tt.want {
+			t.Errorf("Extension(%q) = %q, want %q", tt.mimeType, got, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE0}
+	cr2 := []byte("II*\x00\x10\x00\x00\x00CR\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	allowed := []string{"image/jpeg", "image/png", "image/x-canon-cr2"}
+
+	tests := []struct {
+		name     string
+		head     []byte
+		declared string
+		allowed  []string
+		want     string
+		wantErr  error
+	}{
+		{name: "matching declaration", head: jpeg, declared: "image/jpeg", allowed: allowed, want: "image/jpeg"},
+		{name: "alias declaration", head: jpeg, declared: "image/jpg", allowed: allowed, want: "image/jpeg"},
+		{name: "no declaration", head: jpeg, allowed: allowed, want: "image/jpeg"},
+		{name: "octet stream raw", head: cr2, declared: "application/octet-stream", allowed: allowed, want: "image/x-canon-cr2"},
+		{name: "spoofed declaration", head: jpeg, declared: "image/png", allowed: allowed, want: "image/jpeg", wantErr: ErrMismatch},
+		{name: "disallowed type", head: []byte("GIF89a"), declared: "image/gif", allowed: allowed, want: "image/gif", wantErr: ErrNotAllowed},
+		{name: "unknown content", head: []byte("<svg"), declared: "image/svg+xml", allowed: allowed, want: Unknown, wantErr: ErrNotAllowed},
+		{name: "allow-list aliases", head: jpeg, allowed: []string{"image/pjpeg"}, want: "image/jpeg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Check(tt.head, tt.declared, tt.allowed)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package imaging
+
+import "unicode"
+
+// Glyph size of the built-in font in font pixels
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// glyphs is a 5x7 pixel font covering capitals, digits and the punctuation
+// common in watermarks. It keeps text watermarks free of font files and
+// external dependencies; lower case is drawn as capitals.
+var glyphs = map[rune][glyphHeight]string{
+	' ':  {"     ", "     ", "     ", "     ", "     ", "     ", "     "},
+	'A':  {" ### ", "#   #", "#   #", "#####", "#   #", "#   #", "#   #"},
+	'B':  {"#### ", "#   #", "#   #", "#### ", "#   #", "#   #", "#### "},
+	'C':  {" ### ", "#   #", "#    ", "#    ", "#    ", "#   #", " ### "},
+	'D':  {"#### ", "#   #", "#   #", "#   #", "#   #", "#   #", "#### "},
+	'E':  {"#####", "#    ", "#    ", "#### ", "#    ", "#    ", "#####"},
+	'F':  {"#####", "#    ", "#    ", "#### ", "#    ", "#    ", "#    "},
+	'G':  {" ### ", "#   #", "#    ", "# ###", "#   #", "#   #", " ####"},
+	'H':  {"#   #", "#   #", "#   #", "#####", "#   #", "#   #", "#   #"},
+	'I':  {" ### ", "  #  ", "  #  ", "  #  ", "  #  ", "  #  ", " ### "},
+	'J':  {"  ###", "   # ", "   # ", "   # ", "   # ", "#  # ", " ##  "},
+	'K':  {"#   #", "#  # ", "# #  ", "##   ", "# #  ", "#  # ", "#   #"},
+	'L':  {"#    ", "#    ", "#    ", "#    ", "#    ", "#    ", "#####"},
+	'M':  {"#   #", "## ##", "# # #", "# # #", "#   #", "#   #", "#   #"},
+	'N':  {"#   #", "#   #", "##  #", "# # #", "#  ##", "#   #", "#   #"},
+	'O':  {" ### ", "#   #", "#   #", "#   #", "#   #", "#   #", " ### "},
+	'P':  {"#### ", "#   #", "#   #", "#### ", "#    ", "#    ", "#    "},
+	'Q':  {" ### ", "#   #", "#   #", "#   #", "# # #", "#  # ", " ## #"},
+	'R':  {"#### ", "#   #", "#   #", "#### ", "# #  ", "#  # ", "#   #"},
+	'S':  {" ####", "#    ", "#    ", " ### ", "    #", "    #", "#### "},
+	'T':  {"#####", "  #  ", "  #  ", "  #  ", "  #  ", "  #  ", "  #  "},
+	'U':  {"#   #", "#   #", "#   #", "#   #", "#   #", "#   #", " ### "},
+	'V':  {"#   #", "#   #", "#   #", "#   #", "#   #", " # # ", "  #  "},
+	'W':  {"#   #", "#   #", "#   #", "# # #", "# # #", "# # #", " # # "},
+	'X':  {"#   #", "#   #", " # # ", "  #  ", " # # ", "#   #", "#   #"},
+	'Y':  {"#   #", "#   #", " # # ", "  #  ", "  #  ", "  #  ", "  #  "},
+	'Z':  {"#####", "    #", "   # ", "  #  ", " #   ", "#    ", "#####"},
+	'0':  {" ### ", "#   #", "#  ##", "# # #", "##  #", "#   #", " ### "},
+	'1':  {"  #  ", " ##  ", "  #  ", "  #  ", "  #  ", "  #  ", " ### "},
+	'2':  {" ### ", "#   #", "    #", "   # ", "  #  ", " #   ", "#####"},
+	'3':  {"#####", "   # ", "  #  ", "   # ", "    #", "#   #", " ### "},
+	'4':  {"   # ", "  ## ", " # # ", "#  # ", "#####", "   # ", "   # "},
+	'5':  {"#####", "#    ", "#### ", "    #", "    #", "#   #", " ### "},
+	'6':  {"  ## ", " #   ", "#    ", "#### ", "#   #", "#   #", " ### "},
+	'7':  {"#####", "    #", "   # ", "  #  ", " #   ", " #   ", " #   "},
+	'8':  {" ### ", "#   #", "#   #", " ### ", "#   #", "#   #", " ### "},
+	'9':  {" ### ", "#   #", "#   #", " ####", "    #", "   # ", " ##  "},
+	'.':  {"     ", "     ", "     ", "     ", "     ", " ##  ", " ##  "},
+	',':  {"     ", "     ", "     ", "     ", " ##  ", "  #  ", " #   "},
+	':':  {"     ", " ##  ", " ##  ", "     ", " ##  ", " ##  ", "     "},
+	'-':  {"     ", "     ", "     ", "#####", "     ", "     ", "     "},
+	'_':  {"     ", "     ", "     ", "     ", "     ", "     ", "#####"},
+	'/':  {"     ", "    #", "   # ", "  #  ", " #   ", "#    ", "     "},
+	'&':  {" ##  ", "#  # ", "# #  ", " #   ", "# # #", "#  # ", " ## #"},
+	'@':  {" ### ", "#   #", "    #", " ## #", "# # #", "# # #", " ### "},
+	'!':  {"  #  ", "  #  ", "  #  ", "  #  ", "  #  ", "     ", "  #  "},
+	'?':  {" ### ", "#   #", "    #", "   # ", "  #  ", "     ", "  #  "},
+	'\'': {" ##  ", "  #  ", " #   ", "     ", "     ", "     ", "     "},
+	'(':  {"   # ", "  #  ", " #   ", " #   ", " #   ", "  #  ", "   # "},
+	')':  {" #   ", "  #  ", "   # ", "   # ", "   # ", "  #  ", " #   "},
+	'+':  {"     ", "  #  ", "  #  ", "#####", "  #  ", "  #  ", "     "},
+	'#':  {" # # ", " # # ", "#####", " # # ", "#####", " # # ", " # # "},
+	'©':  {" ### ", "#   #", "# ###", "# #  ", "# ###", "#   #", " ### "},
+}
+
+// glyph returns the bitmap of r, drawing unknown characters as '?'
+func glyph(r rune) [glyphHeight]string {
+	if g, ok := glyphs[unicode.ToUpper(r)]; ok {
+		return g
+	}
+	return glyphs['?']
+}
@@ -0,0 +1,97 @@
+// Package imaging decodes, resizes and encodes images using only the pure-Go
+// codecs in the standard library.
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Supported formats, as reported by image.Decode
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+)
+
+// ErrUnsupportedFormat is returned for formats the package cannot encode
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// FormatForMimeType maps a MIME type to a decodable format, or "" when unsupported
+func FormatForMimeType(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg", "image/jpg", "image/pjpeg":
+		return FormatJPEG
+	case "image/png":
+		return FormatPNG
+	case "image/gif":
+		return FormatGIF
+	default:
+		return ""
+	}
+}
+
+// MimeType returns the MIME type of a format
+func MimeType(format string) string {
+	switch format {
+	case FormatJPEG:
+		return "image/jpeg"
+	case FormatPNG:
+		return "image/png"
+	case FormatGIF:
+		return "image/gif"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Extension returns the file extension, including the dot, of a format
+func Extension(format string) string {
+	switch format {
+	case FormatJPEG:
+		return ".jpg"
+	case FormatPNG:
+		return ".png"
+	case FormatGIF:
+		return ".gif"
+	default:
+		return ""
+	}
+}
+
+// Decode decodes a JPEG, PNG or GIF image, for GIFs only the first frame
+func Decode(r io.Reader) (image.Image, string, error) {
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, format, nil
+}
+
+// Encode writes img in the given format, quality applies to JPEG only
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case FormatJPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case FormatPNG:
+		return png.Encode(w, img)
+	case FormatGIF:
+		return gif.Encode(w, img, nil)
+	default:
+		return ErrUnsupportedFormat
+	}
+}
+
+// VariantFormat picks the output format for a resized variant: JPEG stays
+// JPEG, anything else becomes PNG so transparency is preserved
+func VariantFormat(sourceFormat string) string {
+	if sourceFormat == FormatJPEG {
+		return FormatJPEG
+	}
+	return FormatPNG
+}
@@ -0,0 +1,281 @@
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"time"
+)
+
+// HeaderLen is how many leading bytes CheckHeader needs, enough for JPEGs
+// whose ICC profile and XMP segments precede the frame header
+const HeaderLen = 1 << 20
+
+// ErrLimitExceeded is returned for images beyond the configured limits
+var ErrLimitExceeded = errors.New("image exceeds processing limits")
+
+// ErrMalformed is returned by LimitFrames for streams that are not valid GIFs
+var ErrMalformed = errors.New("malformed image")
+
+// Limits bound the images accepted for decoding. Zero disables a limit.
+type Limits struct {
+	// MaxDimension is the largest width or height in pixels
+	MaxDimension int
+	// MaxPixels is the largest width times height
+	MaxPixels int64
+	// MaxFrames is the most frames an animated GIF may have
+	MaxFrames int
+	// MaxMemory is the largest decoded size in bytes, all frames included
+	MaxMemory int64
+}
+
+// CheckHeader decodes only the header of a JPEG, PNG or GIF and enforces
+// limits on what decoding it would cost. Other formats are not checked and
+// report an empty format.
+func CheckHeader(head []byte, limits Limits) (image.Config, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(head))
+	if errors.Is(err, image.ErrFormat) {
+		return cfg, "", nil
+	}
+	if err != nil {
+		return cfg, format, fmt.Errorf("failed to read image header: %w", err)
+	}
+
+	if limits.MaxDimension > 0 && (cfg.Width > limits.MaxDimension || cfg.Height > limits.MaxDimension) {
+		return cfg, format, fmt.Errorf("%w: %dx%d pixels, at most %d per side", ErrLimitExceeded, cfg.Width, cfg.Height, limits.MaxDimension)
+	}
+
+	pixels := int64(cfg.Width) * int64(cfg.Height)
+	if limits.MaxPixels > 0 && pixels > limits.MaxPixels {
+		return cfg, format, fmt.Errorf("%w: %d pixels, at most %d", ErrLimitExceeded, pixels, limits.MaxPixels)
+	}
+
+	if memory := pixels * bytesPerPixel(cfg.ColorModel); limits.MaxMemory > 0 && memory > limits.MaxMemory {
+		return cfg, format, fmt.Errorf("%w: %d bytes decoded, at most %d", ErrLimitExceeded, memory, limits.MaxMemory)
+	}
+
+	return cfg, format, nil
+}
+
+// DecodeLimited checks the header of an image against limits before
+// decoding it, so oversized images are rejected without allocating pixels
+func DecodeLimited(r io.Reader, limits Limits) (image.Image, string, error) {
+	br := bufio.NewReaderSize(r, HeaderLen)
+	head, err := br.Peek(HeaderLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", err
+	}
+
+	if _, _, err := CheckHeader(head, limits); err != nil {
+		return nil, "", err
+	}
+
+	return Decode(br)
+}
+
+// bytesPerPixel estimates the decoded size of a pixel in a color model
+func bytesPerPixel(model color.Model) int64 {
+	switch model {
+	case color.GrayModel:
+		return 1
+	case color.Gray16Model:
+		return 2
+	case color.RGBA64Model, color.NRGBA64Model:
+		return 8
+	default:
+		if _, ok := model.(color.Palette); ok {
+			return 1
+		}
+		// YCbCr and CMYK decode smaller, RGBA is the worst common case
+		return 4
+	}
+}
+
+// LimitFrames passes a GIF stream through while counting its frames and
+// the memory decoding all of them would take, failing with
+// ErrLimitExceeded as soon as a limit is crossed. No pixel data is decoded.
+func LimitFrames(r io.Reader, limits Limits) io.Reader {
+	return &frameLimiter{r: r, limits: limits, need: 13, state: gifHeader}
+}
+
+// Animation describes the frames of an animated image
+type Animation struct {
+	Frames int
+	// Duration is one loop as browsers play it
+	Duration time.Duration
+}
+
+// InspectGIF walks a whole GIF stream, enforcing limits like LimitFrames,
+// and reports its frame count and duration. No pixel data is decoded.
+func InspectGIF(r io.Reader, limits Limits) (Animation, error) {
+	f := &frameLimiter{r: r, limits: limits, need: 13, state: gifHeader}
+	if _, err := io.Copy(io.Discard, f); err != nil {
+		return Animation{}, err
+	}
+
+	return Animation{
+		Frames:   f.frames,
+		Duration: time.Duration(f.delay) * 10 * time.Millisecond,
+	}, nil
+}
+
+// GIF parser states
+const (
+	gifHeader = iota
+	gifColorTable
+	gifBlock
+	gifExtensionLabel
+	gifSubBlockSize
+	gifSubBlockData
+	gifImageDescriptor
+	gifLocalColorTable
+	gifLZWCodeSize
+	gifGraphicControl
+	gifTrailer
+)
+
+// frameLimiter walks the GIF block structure incrementally as bytes are read
+type frameLimiter struct {
+	r      io.Reader
+	limits Limits
+	err    error
+
+	state  int
+	need   int
+	buf    []byte
+	frames int
+	memory int64
+	// next is the state after the current run of sub-blocks
+	next int
+
+	// delay sums the frame delays in hundredths of a second, frameDelay is
+	// the delay announced for the next frame
+	delay          int
+	frameDelay     int
+	graphicControl bool
+}
+
+func (f *frameLimiter) Read(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+
+	n, err := f.r.Read(p)
+	if perr := f.feed(p[:n]); perr != nil {
+		f.err = perr
+		return n, perr
+	}
+	return n, err
+}
+
+// feed advances the parser over b
+func (f *frameLimiter) feed(b []byte) error {
+	for len(b) > 0 {
+		if f.state == gifTrailer {
+			return nil
+		}
+
+		// Sub-block payloads are skipped without buffering
+		if f.state == gifSubBlockData {
+			skip := min(f.need, len(b))
+			f.need -= skip
+			b = b[skip:]
+			if f.need == 0 {
+				f.state, f.need = gifSubBlockSize, 1
+			}
+			continue
+		}
+
+		take := min(f.need-len(f.buf), len(b))
+		f.buf = append(f.buf, b[:take]...)
+		b = b[take:]
+		if len(f.buf) < f.need {
+			return nil
+		}
+
+		if err := f.step(f.buf); err != nil {
+			return err
+		}
+		f.buf = f.buf[:0]
+	}
+	return nil
+}
+
+// step handles one complete unit of f.need bytes
+func (f *frameLimiter) step(unit []byte) error {
+	switch f.state {
+	case gifHeader:
+		if !bytes.HasPrefix(unit, []byte("GIF8")) {
+			return fmt.Errorf("%w: not a GIF stream", ErrMalformed)
+		}
+		// Global color table flag and size live in the packed field
+		if packed := unit[10]; packed&0x80 != 0 {
+			f.state, f.need = gifColorTable, 3<<((packed&0x07)+1)
+		} else {
+			f.state, f.need = gifBlock, 1
+		}
+	case gifColorTable:
+		f.state, f.need = gifBlock, 1
+	case gifLocalColorTable:
+		f.state, f.need = gifLZWCodeSize, 1
+	case gifBlock:
+		switch unit[0] {
+		case 0x21:
+			f.state, f.need = gifExtensionLabel, 1
+		case 0x2C:
+			f.state, f.need = gifImageDescriptor, 9
+		case 0x3B:
+			f.state = gifTrailer
+		default:
+			return fmt.Errorf("%w: invalid GIF block 0x%02x", ErrMalformed, unit[0])
+		}
+	case gifExtensionLabel:
+		f.graphicControl = unit[0] == 0xF9
+		f.state, f.need, f.next = gifSubBlockSize, 1, gifBlock
+	case gifGraphicControl:
+		f.frameDelay = int(unit[1]) | int(unit[2])<<8
+		f.graphicControl = false
+		f.state, f.need = gifSubBlockSize, 1
+	case gifImageDescriptor:
+		width := int64(unit[4]) | int64(unit[5])<<8
+		height := int64(unit[6]) | int64(unit[7])<<8
+		f.frames++
+		f.memory += width * height
+
+		// Browsers play delays under 2/100 s at 1/10 s
+		if f.frameDelay < 2 {
+			f.frameDelay = 10
+		}
+		f.delay += f.frameDelay
+		f.frameDelay = 0
+
+		if f.limits.MaxFrames > 0 && f.frames > f.limits.MaxFrames {
+			return fmt.Errorf("%w: more than %d frames", ErrLimitExceeded, f.limits.MaxFrames)
+		}
+		if f.limits.MaxMemory > 0 && f.memory > f.limits.MaxMemory {
+			return fmt.Errorf("%w: frames decode to more than %d bytes", ErrLimitExceeded, f.limits.MaxMemory)
+		}
+
+		if packed := unit[8]; packed&0x80 != 0 {
+			f.state, f.need = gifLocalColorTable, 3<<((packed&0x07)+1)
+		} else {
+			f.state, f.need = gifLZWCodeSize, 1
+		}
+	case gifLZWCodeSize:
+		f.state, f.need, f.next = gifSubBlockSize, 1, gifBlock
+	case gifSubBlockSize:
+		switch {
+		case unit[0] == 0:
+			f.state, f.need = f.next, 1
+		case f.graphicControl && unit[0] >= 3:
+			f.state, f.need = gifGraphicControl, int(unit[0])
+		default:
+			f.state, f.need = gifSubBlockData, int(unit[0])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// encodeGIF returns an animated GIF of size×size frames with the given
+// delays in hundredths of a second, every frame with a local color table
+func encodeGIF(t *testing.T, size int, delays []int) []byte {
+	t.Helper()
+	anim := &gif.GIF{Delay: delays}
+	for range delays {
+		palette := color.Palette{color.Black, color.White}
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, size, size), palette))
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("gif.EncodeAll() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestLimitFrames(t *testing.T) {
+	small := encodeGIF(t, 4, []int{5, 5, 5})
+
+	tests := []struct {
+		name    string
+		input   []byte
+		limits  Limits
+		oneByte bool
+		wantErr error
+	}{
+		{name: "within limits", input: small, limits: Limits{MaxFrames: 3, MaxMemory: 48}},
+		{name: "no limits", input: small},
+		{name: "byte by byte", input: small, limits: Limits{MaxFrames: 3}, oneByte: true},
+		{name: "too many frames", input: small, limits: Limits{MaxFrames: 2}, wantErr: ErrLimitExceeded},
+		{name: "too many frames byte by byte", input: small, limits: Limits{MaxFrames: 2}, oneByte: true, wantErr: ErrLimitExceeded},
+		{name: "too much memory", input: small, limits: Limits{MaxMemory: 47}, wantErr: ErrLimitExceeded},
+		{name: "not a GIF", input: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x00\x00"), wantErr: ErrMalformed},
+		{name: "invalid block", input: append(small[:len(small)-1:len(small)-1], 0x99), wantErr: ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r io.Reader = bytes.NewReader(tt.input)
+			if tt.oneByte {
+				r = iotest.OneByteReader(r)
+			}
+
+			out, err := io.ReadAll(LimitFrames(r, tt.limits))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !bytes.Equal(out, tt.input) {
+				t.Error("stream was altered")
+			}
+		})
+	}
+}
+
+func TestInspectGIF(t *testing.T) {
+	tests := []struct {
+		name     string
+		delays   []int
+		frames   int
+		duration time.Duration
+	}{
+		{name: "single frame", delays: []int{0}, frames: 1, duration: 100 * time.Millisecond},
+		{name: "animation", delays: []int{5, 20, 50}, frames: 3, duration: 750 * time.Millisecond},
+		{name: "too fast delays", delays: []int{1, 1}, frames: 2, duration: 200 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anim, err := InspectGIF(bytes.NewReader(encodeGIF(t, 8, tt.delays)), Limits{})
+			if err != nil {
+				t.Fatalf("InspectGIF() error = %v", err)
+			}
+			if anim.Frames != tt.frames || anim.Duration != tt.duration {
+				t.Errorf("InspectGIF() = %d frames, %v, want %d frames, %v", anim.Frames, anim.Duration, tt.frames, tt.duration)
+			}
+		})
+	}
+}
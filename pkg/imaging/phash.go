@@ -0,0 +1,36 @@
+package imaging
+
+import (
+	"image"
+	"math/bits"
+)
+
+// DHash computes the 64-bit difference hash of an image. The image is
+// shrunk to 9x8 grey pixels and each bit records whether a pixel is
+// brighter than its right neighbour, so resized and recompressed copies
+// hash to the same or nearby values.
+func DHash(img image.Image) uint64 {
+	small := Resize(img, 9, 8)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if luma(small, x, y) > luma(small, x+1, y) {
+				hash |= 1 << uint(y*8+x)
+			}
+		}
+	}
+	return hash
+}
+
+// HashDistance is the number of differing bits between two hashes, 0 for
+// identical images and up to 64
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// luma returns the Rec. 601 brightness of a pixel of an RGBA image
+func luma(img *image.RGBA, x, y int) uint32 {
+	c := img.RGBAAt(x, y)
+	return (299*uint32(c.R) + 587*uint32(c.G) + 114*uint32(c.B)) / 1000
+}
@@ -0,0 +1,203 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// base83 is the BlurHash digit alphabet
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash encodes img as a BlurHash string with xComponents by
+// yComponents DCT components, each between 1 and 9. Pass a small
+// thumbnail: every pixel is visited once per component.
+func BlurHash(img image.Image, xComponents, yComponents int) (string, error) {
+	if xComponents < 1 || xComponents > 9 || yComponents < 1 || yComponents > 9 {
+		return "", fmt.Errorf("blurhash components must be between 1 and 9, got %dx%d", xComponents, yComponents)
+	}
+
+	rgba := ToRGBA(img)
+	width, height := rgba.Rect.Dx(), rgba.Rect.Dy()
+	if width == 0 || height == 0 {
+		return "", fmt.Errorf("blurhash of an empty image")
+	}
+
+	// Linear pixel values, converted once instead of once per component
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := rgba.RGBAAt(x, y)
+			linear[y*width+x] = [3]float64{sRGBToLinear(c.R), sRGBToLinear(c.G), sRGBToLinear(c.B)}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var f [3]float64
+			for y := 0; y < height; y++ {
+				by := math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+				for x := 0; x < width; x++ {
+					basis := by * math.Cos(math.Pi*float64(i)*float64(x)/float64(width))
+					p := linear[y*width+x]
+					f[0] += basis * p[0]
+					f[1] += basis * p[1]
+					f[2] += basis * p[2]
+				}
+			}
+
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var sb strings.Builder
+	encode83(&sb, (xComponents-1)+(yComponents-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+	maximum := 1.0
+	if len(ac) > 0 {
+		var actual float64
+		for _, f := range ac {
+			actual = math.Max(actual, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actual*166-0.5))))
+		maximum = float64(quantised+1) / 166
+		encode83(&sb, quantised, 1)
+	} else {
+		encode83(&sb, 0, 1)
+	}
+
+	encode83(&sb, linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4)
+
+	for _, f := range ac {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+		encode83(&sb, quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2)
+	}
+
+	return sb.String(), nil
+}
+
+// BlurHashComponents picks component counts following the aspect ratio of
+// img, with four along the longer side
+func BlurHashComponents(img image.Image) (int, int) {
+	b := img.Bounds()
+	if b.Dy() > b.Dx() {
+		return 3, 4
+	}
+	return 4, 3
+}
+
+func encode83(sb *strings.Builder, value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		digit := (value / int(math.Pow(83, float64(i)))) % 83
+		sb.WriteByte(base83[digit])
+	}
+}
+
+func sRGBToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+// LQIP renders a low quality image placeholder: img scaled down to size
+// pixels on its longer side, as a base64 JPEG data URI small enough to
+// inline in API responses and HTML
+func LQIP(img image.Image, size, quality int) (string, error) {
+	b := img.Bounds()
+	width, height := size, size
+	if b.Dx() >= b.Dy() {
+		height = max(1, int(math.Round(float64(b.Dy())*float64(size)/float64(b.Dx()))))
+	} else {
+		width = max(1, int(math.Round(float64(b.Dx())*float64(size)/float64(b.Dy()))))
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, Resize(img, width, height), FormatJPEG, quality); err != nil {
+		return "", err
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// Colors returns the dominant and the average colour of img. The dominant
+// colour is the mean of the most populated bucket of a 4 bit per channel
+// histogram, so it is a colour actually present in the image.
+func Colors(img image.Image) (dominant, average color.RGBA) {
+	rgba := ToRGBA(img)
+	width, height := rgba.Rect.Dx(), rgba.Rect.Dy()
+	if width == 0 || height == 0 {
+		return color.RGBA{A: 255}, color.RGBA{A: 255}
+	}
+
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+	var sumR, sumG, sumB int
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := rgba.RGBAAt(x, y)
+			sumR += int(c.R)
+			sumG += int(c.G)
+			sumB += int(c.B)
+
+			id := int(c.R>>4)<<8 | int(c.G>>4)<<4 | int(c.B>>4)
+			bk := buckets[id]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[id] = bk
+			}
+			bk.count++
+			bk.r += int(c.R)
+			bk.g += int(c.G)
+			bk.b += int(c.B)
+		}
+	}
+
+	var best *bucket
+	bestID := -1
+	for id, bk := range buckets {
+		// Ties go to the lower bucket so the result is deterministic
+		if best == nil || bk.count > best.count || (bk.count == best.count && id < bestID) {
+			best, bestID = bk, id
+		}
+	}
+
+	n := width * height
+	average = color.RGBA{uint8(sumR / n), uint8(sumG / n), uint8(sumB / n), 255}
+	dominant = color.RGBA{uint8(best.r / best.count), uint8(best.g / best.count), uint8(best.b / best.count), 255}
+	return dominant, average
+}
+
+// HexColor formats a colour as #rrggbb
+func HexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,150 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// weights holds the filter taps contributing to one output pixel
+type weights struct {
+	start  int
+	values []float32
+}
+
+// catmullRom is the Catmull-Rom cubic, a sharp filter well suited to photos
+func catmullRom(x float64) float64 {
+	x = math.Abs(x)
+	switch {
+	case x < 1:
+		return 1.5*x*x*x - 2.5*x*x + 1
+	case x < 2:
+		return -0.5*x*x*x + 2.5*x*x - 4*x + 2
+	default:
+		return 0
+	}
+}
+
+// computeWeights precomputes the taps for scaling srcLen pixels to dstLen
+func computeWeights(dstLen, srcLen int) []weights {
+	scale := float64(srcLen) / float64(dstLen)
+	filterScale := math.Max(scale, 1)
+	radius := 2 * filterScale
+
+	out := make([]weights, dstLen)
+	for i := range out {
+		center := (float64(i)+0.5)*scale - 0.5
+		start := int(math.Ceil(center - radius))
+		end := int(math.Floor(center + radius))
+		if start < 0 {
+			start = 0
+		}
+		if end > srcLen-1 {
+			end = srcLen - 1
+		}
+
+		values := make([]float32, 0, end-start+1)
+		var sum float64
+		for j := start; j <= end; j++ {
+			w := catmullRom((float64(j) - center) / filterScale)
+			values = append(values, float32(w))
+			sum += w
+		}
+
+		if sum != 0 {
+			for k := range values {
+				values[k] /= float32(sum)
+			}
+		}
+
+		out[i] = weights{start: start, values: values}
+	}
+
+	return out
+}
+
+// ToRGBA converts any image to a zero-origin *image.RGBA
+func ToRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, src, b.Min, draw.Src)
+	return dst
+}
+
+// Resize scales src to exactly width x height with a separable Catmull-Rom filter
+func Resize(src image.Image, width, height int) *image.RGBA {
+	in := ToRGBA(src)
+	srcW, srcH := in.Rect.Dx(), in.Rect.Dy()
+	if width <= 0 || height <= 0 || srcW == 0 || srcH == 0 {
+		return image.NewRGBA(image.Rect(0, 0, max(width, 0), max(height, 0)))
+	}
+
+	// Horizontal pass into a float buffer of width x srcH
+	xw := computeWeights(width, srcW)
+	tmp := make([]float32, width*srcH*4)
+	for y := 0; y < srcH; y++ {
+		row := in.Pix[y*in.Stride:]
+		for x, w := range xw {
+			var r, g, b, a float32
+			for k, v := range w.values {
+				p := row[(w.start+k)*4:]
+				r += float32(p[0]) * v
+				g += float32(p[1]) * v
+				b += float32(p[2]) * v
+				a += float32(p[3]) * v
+			}
+			o := (y*width + x) * 4
+			tmp[o], tmp[o+1], tmp[o+2], tmp[o+3] = r, g, b, a
+		}
+	}
+
+	// Vertical pass into the destination
+	yw := computeWeights(height, srcH)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, w := range yw {
+		out := dst.Pix[y*dst.Stride:]
+		for x := 0; x < width; x++ {
+			var r, g, b, a float32
+			for k, v := range w.values {
+				o := ((w.start+k)*width + x) * 4
+				r += tmp[o] * v
+				g += tmp[o+1] * v
+				b += tmp[o+2] * v
+				a += tmp[o+3] * v
+			}
+			alpha := clamp8(a)
+			// Premultiplied channels may not exceed alpha
+			out[x*4] = min(clamp8(r), alpha)
+			out[x*4+1] = min(clamp8(g), alpha)
+			out[x*4+2] = min(clamp8(b), alpha)
+			out[x*4+3] = alpha
+		}
+	}
+
+	return dst
+}
+
+// ResizeToWidth scales src to width keeping the aspect ratio
+func ResizeToWidth(src image.Image, width int) *image.RGBA {
+	b := src.Bounds()
+	height := int(math.Round(float64(b.Dy()) * float64(width) / float64(b.Dx())))
+	if height < 1 {
+		height = 1
+	}
+	return Resize(src, width, height)
+}
+
+func clamp8(v float32) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
@@ -0,0 +1,264 @@
+package imaging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"net/url"
+	"strconv"
+)
+
+// Fit modes for a transformation with both width and height
+const (
+	FitCover   = "cover"
+	FitContain = "contain"
+	FitFill    = "fill"
+)
+
+// TransformOptions describes an on-the-fly rendering of an image. Rotation
+// is applied first, then the crop region, then the resize.
+type TransformOptions struct {
+	Width   int
+	Height  int
+	Fit     string
+	Crop    image.Rectangle
+	Quality int
+	Format  string
+	// Rotate is a clockwise rotation in degrees, a multiple of 90
+	Rotate int
+}
+
+// Validate checks the options against the maximum output dimension
+func (o TransformOptions) Validate(maxDimension int) error {
+	if o.Width < 0 || o.Height < 0 {
+		return errors.New("width and height must not be negative")
+	}
+
+	if o.Width > maxDimension || o.Height > maxDimension {
+		return fmt.Errorf("width and height must not exceed %d", maxDimension)
+	}
+
+	switch o.Fit {
+	case "", FitCover, FitContain, FitFill:
+	default:
+		return fmt.Errorf("unknown fit %q", o.Fit)
+	}
+
+	if o.Quality < 0 || o.Quality > 100 {
+		return errors.New("quality must be between 1 and 100")
+	}
+
+	switch o.Format {
+	case "", FormatJPEG, FormatPNG, FormatGIF:
+	default:
+		return fmt.Errorf("unsupported format %q", o.Format)
+	}
+
+	if o.Rotate%90 != 0 {
+		return errors.New("rotation must be a multiple of 90 degrees")
+	}
+
+	if !o.Crop.Empty() && (o.Crop.Min.X < 0 || o.Crop.Min.Y < 0) {
+		return errors.New("crop must lie inside the image")
+	}
+
+	return nil
+}
+
+// Normalize fills in defaults so equivalent requests share one cache entry
+func (o TransformOptions) Normalize(sourceFormat string, defaultQuality int) TransformOptions {
+	if o.Format == "" {
+		o.Format = VariantFormat(sourceFormat)
+	}
+	if o.Quality == 0 || o.Format != FormatJPEG {
+		o.Quality = defaultQuality
+	}
+	if o.Fit == "" {
+		o.Fit = FitContain
+	}
+	o.Rotate = ((o.Rotate % 360) + 360) % 360
+	return o
+}
+
+// Canonical returns a stable string form of the options, used for cache
+// keys and URL signatures
+func (o TransformOptions) Canonical() string {
+	return fmt.Sprintf("w=%d&h=%d&fit=%s&crop=%d,%d,%d,%d&q=%d&fmt=%s&rot=%d",
+		o.Width, o.Height, o.Fit,
+		o.Crop.Min.X, o.Crop.Min.Y, o.Crop.Dx(), o.Crop.Dy(),
+		o.Quality, o.Format, o.Rotate)
+}
+
+// Hash returns a stable identifier of the options for cache keys
+func (o TransformOptions) Hash() string {
+	sum := sha256.Sum256([]byte(o.Canonical()))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Query encodes the options as URL query parameters, omitting defaults
+func (o TransformOptions) Query() url.Values {
+	q := url.Values{}
+	setInt := func(name string, v int) {
+		if v != 0 {
+			q.Set(name, strconv.Itoa(v))
+		}
+	}
+
+	setInt("w", o.Width)
+	setInt("h", o.Height)
+	setInt("q", o.Quality)
+	setInt("rotate", o.Rotate)
+	if o.Fit != "" {
+		q.Set("fit", o.Fit)
+	}
+	if o.Format != "" {
+		q.Set("format", o.Format)
+	}
+	if !o.Crop.Empty() {
+		q.Set("crop", fmt.Sprintf("%d,%d,%d,%d", o.Crop.Min.X, o.Crop.Min.Y, o.Crop.Dx(), o.Crop.Dy()))
+	}
+
+	return q
+}
+
+// Transform renders img according to normalized options
+func Transform(img image.Image, o TransformOptions) image.Image {
+	out := Rotate(img, o.Rotate)
+
+	if !o.Crop.Empty() {
+		b := out.Bounds()
+		region := o.Crop.Add(b.Min).Intersect(b)
+		if !region.Empty() {
+			out = Crop(out, region)
+		}
+	}
+
+	if o.Width == 0 && o.Height == 0 {
+		return out
+	}
+
+	b := out.Bounds()
+	srcW, srcH := float64(b.Dx()), float64(b.Dy())
+
+	switch {
+	case o.Height == 0:
+		return Resize(out, o.Width, max(1, int(math.Round(srcH*float64(o.Width)/srcW))))
+	case o.Width == 0:
+		return Resize(out, max(1, int(math.Round(srcW*float64(o.Height)/srcH))), o.Height)
+	}
+
+	switch o.Fit {
+	case FitFill:
+		return Resize(out, o.Width, o.Height)
+	case FitCover:
+		scale := math.Max(float64(o.Width)/srcW, float64(o.Height)/srcH)
+		w := max(o.Width, int(math.Round(srcW*scale)))
+		h := max(o.Height, int(math.Round(srcH*scale)))
+		resized := Resize(out, w, h)
+		x, y := (w-o.Width)/2, (h-o.Height)/2
+		return Crop(resized, image.Rect(x, y, x+o.Width, y+o.Height))
+	default:
+		scale := math.Min(float64(o.Width)/srcW, float64(o.Height)/srcH)
+		return Resize(out, max(1, int(math.Round(srcW*scale))), max(1, int(math.Round(srcH*scale))))
+	}
+}
+
+// Crop copies the region r of img into a new zero-origin image
+func Crop(img image.Image, r image.Rectangle) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Rect, img, r.Min, draw.Src)
+	return dst
+}
+
+// Rotate turns img clockwise by a multiple of 90 degrees
+func Rotate(img image.Image, degrees int) image.Image {
+	degrees = ((degrees % 360) + 360) % 360
+	if degrees == 0 {
+		return img
+	}
+
+	src := ToRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	var dst *image.RGBA
+	if degrees == 180 {
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch degrees {
+			case 90:
+				dx, dy = h-1-y, x
+			case 180:
+				dx, dy = w-1-x, h-1-y
+			default:
+				dx, dy = y, w-1-x
+			}
+			si := y*src.Stride + x*4
+			di := dy*dst.Stride + dx*4
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
+
+// Orient applies an EXIF orientation, 1 to 8, so the image displays upright
+func Orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return flip(img, true)
+	case 3:
+		return Rotate(img, 180)
+	case 4:
+		return flip(img, false)
+	case 5:
+		return Rotate(flip(img, true), 270)
+	case 6:
+		return Rotate(img, 90)
+	case 7:
+		return Rotate(flip(img, true), 90)
+	case 8:
+		return Rotate(img, 270)
+	default:
+		return img
+	}
+}
+
+// OrientedSize returns the displayed size of a width by height image with
+// an EXIF orientation, orientations 5 to 8 swap the sides
+func OrientedSize(width, height, orientation int) (int, int) {
+	if orientation >= 5 && orientation <= 8 {
+		return height, width
+	}
+	return width, height
+}
+
+// flip mirrors img horizontally or vertically
+func flip(img image.Image, horizontal bool) *image.RGBA {
+	src := ToRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := x, h-1-y
+			if horizontal {
+				dx, dy = w-1-x, y
+			}
+			si := y*src.Stride + x*4
+			di := dy*dst.Stride + dx*4
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
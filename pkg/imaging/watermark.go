@@ -0,0 +1,111 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Watermark positions
+const (
+	PositionTopLeft     = "top_left"
+	PositionTopRight    = "top_right"
+	PositionBottomLeft  = "bottom_left"
+	PositionBottomRight = "bottom_right"
+	PositionCenter      = "center"
+)
+
+// Watermark is a text or logo drawn over display images. Text is used when
+// Logo is nil.
+type Watermark struct {
+	Text     string
+	Logo     image.Image
+	Position string
+	// Opacity is between 0 and 1
+	Opacity float64
+	// Scale is the watermark width as a fraction of the image width
+	Scale float64
+}
+
+// Apply returns a copy of img with the watermark drawn over it
+func (w Watermark) Apply(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, img, b.Min, draw.Src)
+
+	width := max(1, int(math.Round(w.Scale*float64(b.Dx()))))
+	var mark image.Image
+	if w.Logo != nil {
+		mark = ResizeToWidth(w.Logo, width)
+	} else if w.Text != "" {
+		mark = renderText(w.Text, width)
+	}
+	if mark == nil {
+		return dst
+	}
+
+	r := placeMark(dst.Rect, mark.Bounds().Size(), w.Position)
+	alpha := uint8(math.Round(math.Max(0, math.Min(1, w.Opacity)) * 255))
+	draw.DrawMask(dst, r, mark, mark.Bounds().Min, image.NewUniform(color.Alpha{A: alpha}), image.Point{}, draw.Over)
+	return dst
+}
+
+// placeMark returns where a mark of size goes in bounds, keeping a margin
+// of 2% of the shorter side from the edges
+func placeMark(bounds image.Rectangle, size image.Point, position string) image.Rectangle {
+	margin := min(bounds.Dx(), bounds.Dy()) / 50
+	left, top := margin, margin
+	right, bottom := bounds.Dx()-size.X-margin, bounds.Dy()-size.Y-margin
+
+	var at image.Point
+	switch position {
+	case PositionTopLeft:
+		at = image.Pt(left, top)
+	case PositionTopRight:
+		at = image.Pt(right, top)
+	case PositionBottomLeft:
+		at = image.Pt(left, bottom)
+	case PositionCenter:
+		at = image.Pt((bounds.Dx()-size.X)/2, (bounds.Dy()-size.Y)/2)
+	default:
+		at = image.Pt(right, bottom)
+	}
+	return image.Rectangle{Min: at, Max: at.Add(size)}
+}
+
+// renderText draws text in white with a dark shadow, scaled by a whole
+// number of pixels per font pixel to about width pixels wide
+func renderText(text string, width int) *image.NRGBA {
+	runes := []rune(text)
+	columns := len(runes)*(glyphWidth+1) - 1
+	scale := max(1, width/columns)
+	shadow := max(1, scale/4)
+
+	mark := image.NewNRGBA(image.Rect(0, 0, columns*scale+shadow, glyphHeight*scale+shadow))
+	for _, layer := range []struct {
+		offset int
+		color  color.NRGBA
+	}{
+		{shadow, color.NRGBA{A: 160}},
+		{0, color.NRGBA{R: 255, G: 255, B: 255, A: 255}},
+	} {
+		for i, r := range runes {
+			g := glyph(r)
+			for y, row := range g {
+				for x, px := range row {
+					if px == ' ' {
+						continue
+					}
+					cell := image.Rect(0, 0, scale, scale).Add(image.Pt(
+						(i*(glyphWidth+1)+x)*scale+layer.offset,
+						y*scale+layer.offset,
+					))
+					draw.Draw(mark, cell, image.NewUniform(layer.color), image.Point{}, draw.Src)
+				}
+			}
+		}
+	}
+
+	return mark
+}
@@ -19,6 +19,7 @@ type JWTConfig struct {
 type UserClaims struct {
 	UserID int64  `json:"user_id"`
 	Email  string `json:"email"`
+	Role   string `json:"role"`
 	jwt.RegisteredClaims
 }
 
@@ -83,11 +84,12 @@ func GetUserFromContext(ctx context.Context) (*UserClaims, error) {
 	return userClaims, nil
 }
 
-func GenerateToken(userID int64, email string, config JWTConfig) (string, error) {
+func GenerateToken(userID int64, email string, role string, config JWTConfig) (string, error) {
 	expirationTime := time.Now().Add(config.ExpirationTime)
 	claims := &UserClaims{
 		UserID: userID,
 		Email:  email,
+		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// Deadline extends the server read and write deadlines of a request to
+// timeout from now, for routes that move whole files over a connection the
+// server timeouts are too short for
+func Deadline(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if timeout > 0 {
+				deadline := time.Now().Add(timeout)
+				rc := http.NewResponseController(w)
+				// Not every ResponseWriter supports deadlines, the server
+				// timeouts then stay in place
+				rc.SetReadDeadline(deadline)
+				rc.SetWriteDeadline(deadline)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// localBackend stores objects as files below a root directory
+type localBackend struct {
+	root string
+}
+
+// NewLocalBackend creates a Backend that keeps objects on the local filesystem
+func NewLocalBackend(root string) (Backend, error) {
+	if root == "" {
+		return nil, errors.New("local storage path is required")
+	}
+
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	return &localBackend{root: root}, nil
+}
+
+// path maps an object key to a file path, rejecting keys escaping the root
+func (b *localBackend) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || strings.HasSuffix(key, "/") || strings.HasPrefix(clean, "/"+multipartDir) {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+
+	return filepath.Join(b.root, filepath.FromSlash(clean)), nil
+}
+
+// Put writes an object atomically
+func (b *localBackend) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("failed to create object directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create object %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write object %s: %w", key, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write object %s: %w", key, err)
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("failed to store object %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Get opens an object for reading
+func (b *localBackend) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	p, err := b.path(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, ObjectInfo{}, wrapFSError(key, "get", err)
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, ObjectInfo{}, wrapFSError(key, "get", err)
+	}
+
+	return f, fileInfo(key, st), nil
+}
+
+// Head returns object metadata
+func (b *localBackend) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	p, err := b.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	st, err := os.Stat(p)
+	if err != nil {
+		return ObjectInfo{}, wrapFSError(key, "head", err)
+	}
+
+	return fileInfo(key, st), nil
+}
+
+// Delete removes an object, deleting a missing object is not an error
+func (b *localBackend) Delete(ctx context.Context, key string) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Copy duplicates an object, the copy is written atomically like Put
+func (b *localBackend) Copy(ctx context.Context, src, dst string, opts PutOptions) error {
+	body, _, err := b.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return b.Put(ctx, dst, body, opts)
+}
+
+// List returns all objects whose key starts with prefix, walking only the
+// directory holding the keys of the prefix
+func (b *localBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	start := b.root
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		start = filepath.Join(b.root, filepath.FromSlash(path.Clean("/"+prefix[:i])))
+	}
+
+	err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == start {
+			return filepath.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == multipartDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.root, p)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		st, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, fileInfo(key, st))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	return objects, nil
+}
+
+// PresignGet is not supported by the local backend
+func (b *localBackend) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
+
+// PresignPut is not supported by the local backend
+func (b *localBackend) PresignPut(ctx context.Context, key string, contentType string, expires time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
+
+func fileInfo(key string, st fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         st.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: st.ModTime(),
+	}
+}
+
+func wrapFSError(key, op string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s %s: %w", op, key, ErrNotFound)
+	}
+
+	return fmt.Errorf("failed to %s object %s: %w", op, key, err)
+}
+
+// multipartDir holds in-progress multipart uploads below the root
+const multipartDir = ".multipart"
+
+func (b *localBackend) uploadDir(uploadID string) (string, error) {
+	if uploadID == "" || strings.ContainsAny(uploadID, `/\.`) {
+		return "", fmt.Errorf("invalid upload id %q", uploadID)
+	}
+
+	return filepath.Join(b.root, multipartDir, uploadID), nil
+}
+
+// CreateMultipart starts a multipart upload backed by a staging directory
+func (b *localBackend) CreateMultipart(ctx context.Context, key string, opts PutOptions) (string, error) {
+	if _, err := b.path(key); err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate upload id: %w", err)
+	}
+	uploadID := hex.EncodeToString(id)
+
+	dir, err := b.uploadDir(uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to start multipart upload %s: %w", key, err)
+	}
+
+	return uploadID, nil
+}
+
+// UploadPart stores one part in the staging directory
+func (b *localBackend) UploadPart(ctx context.Context, key, uploadID string, number int32, body io.Reader, size int64) (Part, error) {
+	dir, err := b.uploadDir(uploadID)
+	if err != nil {
+		return Part{}, err
+	}
+
+	f, err := os.Create(filepath.Join(dir, strconv.Itoa(int(number))))
+	if err != nil {
+		return Part{}, fmt.Errorf("failed to upload part %d of %s: %w", number, key, err)
+	}
+	defer f.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(f, hash), body); err != nil {
+		return Part{}, fmt.Errorf("failed to upload part %d of %s: %w", number, key, err)
+	}
+
+	return Part{Number: number, ETag: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// CompleteMultipart concatenates the parts into the final object
+func (b *localBackend) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error {
+	dir, err := b.uploadDir(uploadID)
+	if err != nil {
+		return err
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		f, err := os.Open(filepath.Join(dir, strconv.Itoa(int(part.Number))))
+		if err != nil {
+			return fmt.Errorf("failed to complete multipart upload %s: %w", key, err)
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	if err := b.Put(ctx, key, io.MultiReader(readers...), PutOptions{ContentLength: -1}); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// AbortMultipart removes the staging directory
+func (b *localBackend) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	dir, err := b.uploadDir(uploadID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to abort multipart upload %s: %w", key, err)
+	}
+
+	return nil
+}
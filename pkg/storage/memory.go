@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+// memoryBackend keeps objects in process memory, intended for tests and local runs
+type memoryBackend struct {
+	mu         sync.RWMutex
+	objects    map[string]memoryObject
+	uploads    map[string]*memoryUpload
+	nextUpload int64
+}
+
+// NewMemoryBackend creates an empty in-memory Backend
+func NewMemoryBackend() Backend {
+	return &memoryBackend{
+		objects: make(map[string]memoryObject),
+		uploads: make(map[string]*memoryUpload),
+	}
+}
+
+// Put stores an object
+func (b *memoryBackend) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+
+	sum := md5.Sum(data)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.objects[key] = memoryObject{
+		data: data,
+		info: ObjectInfo{
+			Key:          key,
+			Size:         int64(len(data)),
+			ContentType:  opts.ContentType,
+			ETag:         hex.EncodeToString(sum[:]),
+			LastModified: time.Now(),
+		},
+	}
+
+	return nil
+}
+
+// Get returns a reader over a stored object
+func (b *memoryBackend) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	obj, ok := b.objects[key]
+	if !ok {
+		return nil, ObjectInfo{}, fmt.Errorf("get %s: %w", key, ErrNotFound)
+	}
+
+	return io.NopCloser(bytes.NewReader(obj.data)), obj.info, nil
+}
+
+// Head returns object metadata
+func (b *memoryBackend) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	obj, ok := b.objects[key]
+	if !ok {
+		return ObjectInfo{}, fmt.Errorf("head %s: %w", key, ErrNotFound)
+	}
+
+	return obj.info, nil
+}
+
+// Delete removes an object, deleting a missing object is not an error
+func (b *memoryBackend) Delete(ctx context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.objects, key)
+	return nil
+}
+
+// Copy duplicates an object
+func (b *memoryBackend) Copy(ctx context.Context, src, dst string, opts PutOptions) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	obj, ok := b.objects[src]
+	if !ok {
+		return fmt.Errorf("copy %s: %w", src, ErrNotFound)
+	}
+
+	obj.info.Key = dst
+	obj.info.LastModified = time.Now()
+	if opts.ContentType != "" {
+		obj.info.ContentType = opts.ContentType
+	}
+	b.objects[dst] = obj
+
+	return nil
+}
+
+// List returns all objects whose key starts with prefix, sorted by key
+func (b *memoryBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var objects []ObjectInfo
+	for key, obj := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, obj.info)
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
+
+// PresignGet is not supported by the memory backend
+func (b *memoryBackend) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
+
+// PresignPut is not supported by the memory backend
+func (b *memoryBackend) PresignPut(ctx context.Context, key string, contentType string, expires time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
+
+type memoryUpload struct {
+	key   string
+	opts  PutOptions
+	parts map[int32][]byte
+}
+
+// CreateMultipart starts an in-memory multipart upload
+func (b *memoryBackend) CreateMultipart(ctx context.Context, key string, opts PutOptions) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextUpload++
+	uploadID := strconv.FormatInt(b.nextUpload, 10)
+	b.uploads[uploadID] = &memoryUpload{
+		key:   key,
+		opts:  opts,
+		parts: make(map[int32][]byte),
+	}
+
+	return uploadID, nil
+}
+
+// UploadPart stores one part of an in-memory multipart upload
+func (b *memoryBackend) UploadPart(ctx context.Context, key, uploadID string, number int32, body io.Reader, size int64) (Part, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return Part{}, fmt.Errorf("failed to upload part %d of %s: %w", number, key, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	upload, ok := b.uploads[uploadID]
+	if !ok || upload.key != key {
+		return Part{}, fmt.Errorf("upload %s: %w", uploadID, ErrNotFound)
+	}
+	upload.parts[number] = data
+
+	sum := md5.Sum(data)
+	return Part{Number: number, ETag: hex.EncodeToString(sum[:])}, nil
+}
+
+// CompleteMultipart joins the parts into the final object
+func (b *memoryBackend) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error {
+	b.mu.Lock()
+	upload, ok := b.uploads[uploadID]
+	if !ok || upload.key != key {
+		b.mu.Unlock()
+		return fmt.Errorf("upload %s: %w", uploadID, ErrNotFound)
+	}
+
+	var buf bytes.Buffer
+	for _, part := range parts {
+		data, ok := upload.parts[part.Number]
+		if !ok {
+			b.mu.Unlock()
+			return fmt.Errorf("part %d of upload %s: %w", part.Number, uploadID, ErrNotFound)
+		}
+		buf.Write(data)
+	}
+	delete(b.uploads, uploadID)
+	b.mu.Unlock()
+
+	return b.Put(ctx, key, &buf, upload.opts)
+}
+
+// AbortMultipart discards an in-memory multipart upload
+func (b *memoryBackend) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.uploads, uploadID)
+	return nil
+}
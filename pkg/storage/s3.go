@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// partSize is the multipart chunk size used for streamed uploads, S3 requires
+// every part except the last to be at least 5 MiB
+const partSize = 8 << 20
+
+// s3Backend stores objects in an S3-compatible bucket such as Cloudflare R2
+type s3Backend struct {
+	client  *s3.Client
+	presign *s3.PresignClient
+	bucket  string
+}
+
+// NewS3Backend creates a Backend on top of an S3 client and bucket
+func NewS3Backend(client *s3.Client, bucket string) Backend {
+	return &s3Backend{
+		client:  client,
+		presign: s3.NewPresignClient(client),
+		bucket:  bucket,
+	}
+}
+
+// Put uploads an object. Bodies of unknown length are streamed in fixed size
+// parts so memory use stays bounded regardless of the object size.
+func (b *s3Backend) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) error {
+	if opts.ContentLength < 0 {
+		return b.putStream(ctx, key, body, opts)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.ContentLength >= 0 {
+		input.ContentLength = aws.Int64(opts.ContentLength)
+	}
+	if opts.Public {
+		input.ACL = types.ObjectCannedACLPublicRead
+	}
+
+	if _, err := b.client.PutObject(ctx, input); err != nil {
+		return fmt.Errorf("failed to put object %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// putStream uploads a body of unknown length, using a single PutObject when
+// it fits in one part and a multipart upload otherwise
+func (b *s3Backend) putStream(ctx context.Context, key string, body io.Reader, opts PutOptions) error {
+	buf := make([]byte, partSize)
+
+	n, err := io.ReadFull(body, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		opts.ContentLength = int64(n)
+		return b.Put(ctx, key, bytes.NewReader(buf[:n]), opts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+
+	uploadID, err := b.CreateMultipart(ctx, key, opts)
+	if err != nil {
+		return err
+	}
+
+	abort := func(cause error) error {
+		// Use a fresh context so the abort still runs when ctx was cancelled
+		return errors.Join(cause, b.AbortMultipart(context.Background(), key, uploadID))
+	}
+
+	var parts []Part
+	for number := int32(1); n > 0; number++ {
+		part, err := b.UploadPart(ctx, key, uploadID, number, bytes.NewReader(buf[:n]), int64(n))
+		if err != nil {
+			return abort(err)
+		}
+		parts = append(parts, part)
+
+		n, err = io.ReadFull(body, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abort(fmt.Errorf("failed to read object %s: %w", key, err))
+		}
+	}
+
+	if err := b.CompleteMultipart(ctx, key, uploadID, parts); err != nil {
+		return abort(err)
+	}
+
+	return nil
+}
+
+// CreateMultipart starts a multipart upload and returns its upload id
+func (b *s3Backend) CreateMultipart(ctx context.Context, key string, opts PutOptions) (string, error) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.Public {
+		input.ACL = types.ObjectCannedACLPublicRead
+	}
+
+	out, err := b.client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to start multipart upload %s: %w", key, err)
+	}
+
+	return aws.ToString(out.UploadId), nil
+}
+
+// UploadPart uploads one part of a multipart upload
+func (b *s3Backend) UploadPart(ctx context.Context, key, uploadID string, number int32, body io.Reader, size int64) (Part, error) {
+	out, err := b.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(b.bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(number),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return Part{}, fmt.Errorf("failed to upload part %d of %s: %w", number, key, err)
+	}
+
+	return Part{Number: number, ETag: aws.ToString(out.ETag)}, nil
+}
+
+// CompleteMultipart assembles the uploaded parts into the final object
+func (b *s3Backend) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error {
+	completed := make([]types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int32(part.Number),
+		})
+	}
+
+	_, err := b.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// AbortMultipart discards a multipart upload and its parts
+func (b *s3Backend) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	_, err := b.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(b.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to abort multipart upload %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Get downloads an object, the caller must close the returned body
+func (b *s3Backend) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	out, err := b.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, ObjectInfo{}, wrapS3Error(key, "get", err)
+	}
+
+	return out.Body, ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		ETag:         aws.ToString(out.ETag),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+// Head returns object metadata without downloading it
+func (b *s3Backend) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	out, err := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ObjectInfo{}, wrapS3Error(key, "head", err)
+	}
+
+	return ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		ETag:         aws.ToString(out.ETag),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+// Delete removes an object, deleting a missing object is not an error
+func (b *s3Backend) Delete(ctx context.Context, key string) error {
+	_, err := b.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Copy duplicates an object server side
+func (b *s3Backend) Copy(ctx context.Context, src, dst string, opts PutOptions) error {
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(b.bucket),
+		Key:        aws.String(dst),
+		CopySource: aws.String(copySource(b.bucket, src)),
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+		input.MetadataDirective = types.MetadataDirectiveReplace
+	}
+	if opts.Public {
+		input.ACL = types.ObjectCannedACLPublicRead
+	}
+
+	if _, err := b.client.CopyObject(ctx, input); err != nil {
+		return wrapS3Error(src, "copy", err)
+	}
+
+	return nil
+}
+
+// copySource renders the URL-encoded bucket/key CopyObject expects
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+// List returns all objects whose key starts with prefix
+func (b *s3Backend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	paginator := s3.NewListObjectsV2Paginator(b.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	var objects []ObjectInfo
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				ETag:         aws.ToString(obj.ETag),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+// PresignGet returns a time-limited download URL
+func (b *s3Backend) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	req, err := b.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign get %s: %w", key, err)
+	}
+
+	return req.URL, nil
+}
+
+// PresignPut returns a time-limited upload URL
+func (b *s3Backend) PresignPut(ctx context.Context, key string, contentType string, expires time.Duration) (string, error) {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	req, err := b.presign.PresignPutObject(ctx, input, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign put %s: %w", key, err)
+	}
+
+	return req.URL, nil
+}
+
+func wrapS3Error(key, op string, err error) error {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return fmt.Errorf("%s %s: %w", op, key, ErrNotFound)
+	}
+
+	return fmt.Errorf("failed to %s object %s: %w", op, key, err)
+}
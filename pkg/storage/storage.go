@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/adorufus/imgupper/config"
+	"github.com/adorufus/imgupper/pkg/cloudflare"
+)
+
+var (
+	// ErrNotFound is returned when the requested object does not exist
+	ErrNotFound = errors.New("object not found")
+	// ErrNotSupported is returned when a backend cannot perform an operation
+	ErrNotSupported = errors.New("operation not supported by storage backend")
+)
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// PutOptions holds optional attributes for an uploaded object
+type PutOptions struct {
+	ContentType string
+	// ContentLength is the size of the body, or -1 when unknown
+	ContentLength int64
+	Public        bool
+}
+
+// Part identifies an uploaded part of a multipart upload
+type Part struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// Backend is the interface every object storage implementation satisfies
+type Backend interface {
+	Put(ctx context.Context, key string, body io.Reader, opts PutOptions) error
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	Head(ctx context.Context, key string) (ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	// Copy duplicates src to dst within the backend without downloading it,
+	// opts set the attributes of the new object
+	Copy(ctx context.Context, src, dst string, opts PutOptions) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	PresignGet(ctx context.Context, key string, expires time.Duration) (string, error)
+	PresignPut(ctx context.Context, key string, contentType string, expires time.Duration) (string, error)
+
+	// Multipart uploads let large objects be assembled from separately
+	// uploaded parts, every part but the last must be at least MinPartSize
+	CreateMultipart(ctx context.Context, key string, opts PutOptions) (string, error)
+	UploadPart(ctx context.Context, key, uploadID string, number int32, body io.Reader, size int64) (Part, error)
+	CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error
+	AbortMultipart(ctx context.Context, key, uploadID string) error
+}
+
+// MinPartSize is the smallest part S3 accepts for all but the last part
+const MinPartSize = 5 << 20
+
+// New creates the storage backend selected by cfg.Driver
+func New(cfg config.StorageConfig, cf config.CloudflareConfig) (Backend, error) {
+	switch cfg.Driver {
+	case "", "r2":
+		client, err := cloudflare.NewR2Client(cf)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Backend(client, cfg.Bucket), nil
+	case "s3":
+		client, err := cloudflare.NewS3Client(cf)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Backend(client, cfg.Bucket), nil
+	case "local":
+		return NewLocalBackend(cfg.LocalPath)
+	case "memory":
+		return NewMemoryBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,21 @@
+// Package urlsign signs and verifies URL payloads with HMAC-SHA256.
+package urlsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// Sign returns the URL-safe signature of payload
+func Sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is valid for payload, in constant time
+func Verify(secret, payload, signature string) bool {
+	expected := Sign(secret, payload)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
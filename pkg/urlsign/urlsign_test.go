@@ -0,0 +1,63 @@
+package urlsign
+
+import "testing"
+
+func TestVerify(t *testing.T) {
+	const secret = "test-secret"
+	const payload = "42:w=640&h=0&fit=cover:0"
+	signature := Sign(secret, payload)
+
+	tests := []struct {
+		name      string
+		secret    string
+		payload   string
+		signature string
+		want      bool
+	}{
+		{name: "valid", secret: secret, payload: payload, signature: signature, want: true},
+		{name: "other payload", secret: secret, payload: "43:w=640&h=0&fit=cover:0", signature: signature},
+		{name: "other secret", secret: "other-secret", payload: payload, signature: signature},
+		{name: "truncated signature", secret: secret, payload: payload, signature: signature[:len(signature)-1]},
+		{name: "padded signature", secret: secret, payload: payload, signature: signature + "="},
+		{name: "empty signature", secret: secret, payload: payload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.payload, tt.signature); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		payload string
+		want    string
+	}{
+		// RFC 4231 test case 2, base64url without padding
+		{
+			name:    "rfc 4231",
+			secret:  "Jefe",
+			payload: "what do ya want for nothing?",
+			want:    "W9zBRr9gdU5qBCQmCJV1x1oAPwidJzmDnexYuWTsOEM",
+		},
+		{
+			name:    "empty payload",
+			secret:  "key",
+			payload: "",
+			want:    "XV0TlWPJW1lnub2ajJsjOp3ttFByeUzSMtwbdIMmB9A",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.payload); got != tt.want {
+				t.Errorf("Sign() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}